@@ -111,6 +111,7 @@ export function useCollaboration({
           handleParticipantLeave(message.participantId)
           break
         case 'room_update':
+        case 'room_renamed':
           handleRoomUpdate(message.roomTitle)
           break
         case 'clear_all':
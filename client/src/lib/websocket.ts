@@ -38,6 +38,7 @@ export type ServerMessage =
   | { type: 'text_delete'; textBlockId: string; participantId: string }
   | { type: 'cursor_move'; participantId: string; x: number; y: number; color: string }
   | { type: 'room_update'; roomTitle: string; participantId: string }
+  | { type: 'room_renamed'; roomTitle: string }
   | { type: 'participant_join'; participant: Participant }
   | { type: 'participant_leave'; participantId: string }
   | { type: 'clear_all'; participantId: string }
@@ -99,7 +100,8 @@ export class WebSocketClient {
       this.reconnectTimeout = null
     }
 
-    const wsUrl = `${this.url}/ws/${this.roomId}`
+    // Rooms created locally while offline don't exist on the server yet
+    const wsUrl = `${this.url}/ws/${this.roomId}?create=true`
     this.ws = new WebSocket(wsUrl)
 
     this.ws.onopen = () => {
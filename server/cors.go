@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+var (
+	// Methods the API is served with
+	defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}
+
+	// Request headers the API reads
+	defaultCORSHeaders = []string{
+		"Content-Type", "Authorization", "Idempotency-Key",
+		"X-Request-ID", "X-Tenant", "X-Owner-Token", "X-Admin-Token",
+	}
+)
+
+// corsOptions builds the CORS policy from ALLOWED_METHODS and
+// ALLOWED_HEADERS. Credentials are always allowed, so a "*" header list,
+// which browsers don't honor on credentialed requests, is replaced with the
+// headers the API uses.
+func corsOptions(origins []string) cors.Options {
+	methods := splitList(os.Getenv("ALLOWED_METHODS"))
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+
+	headers := splitList(os.Getenv("ALLOWED_HEADERS"))
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	} else if slices.Contains(headers, "*") {
+		log.Printf("ALLOWED_HEADERS=* is not allowed with credentials; using %s", strings.Join(defaultCORSHeaders, ","))
+		headers = defaultCORSHeaders
+	}
+
+	return cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   methods,
+		AllowedHeaders:   headers,
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+	}
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/rs/cors"
+)
+
+func TestCORSOptions(t *testing.T) {
+	origins := []string{"https://draw.example.com"}
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("ALLOWED_METHODS", "")
+		t.Setenv("ALLOWED_HEADERS", "")
+		opts := corsOptions(origins)
+		if !slices.Equal(opts.AllowedMethods, defaultCORSMethods) || !slices.Equal(opts.AllowedHeaders, defaultCORSHeaders) {
+			t.Errorf("methods %v, headers %v; want the defaults", opts.AllowedMethods, opts.AllowedHeaders)
+		}
+		if !slices.Equal(opts.AllowedOrigins, origins) || !opts.AllowCredentials {
+			t.Errorf("origins %v, credentials %v", opts.AllowedOrigins, opts.AllowCredentials)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		t.Setenv("ALLOWED_METHODS", "GET, POST,,")
+		t.Setenv("ALLOWED_HEADERS", "Content-Type,X-Custom")
+		opts := corsOptions(origins)
+		if want := []string{"GET", "POST"}; !slices.Equal(opts.AllowedMethods, want) {
+			t.Errorf("methods %v, want %v", opts.AllowedMethods, want)
+		}
+		if want := []string{"Content-Type", "X-Custom"}; !slices.Equal(opts.AllowedHeaders, want) {
+			t.Errorf("headers %v, want %v", opts.AllowedHeaders, want)
+		}
+	})
+
+	t.Run("wildcard headers with credentials", func(t *testing.T) {
+		t.Setenv("ALLOWED_METHODS", "")
+		t.Setenv("ALLOWED_HEADERS", "Content-Type,*")
+		if opts := corsOptions(origins); !slices.Equal(opts.AllowedHeaders, defaultCORSHeaders) {
+			t.Errorf("headers %v, want the wildcard replaced with the defaults", opts.AllowedHeaders)
+		}
+	})
+}
+
+func TestCORSPreflight(t *testing.T) {
+	t.Setenv("ALLOWED_METHODS", "GET,PUT")
+	t.Setenv("ALLOWED_HEADERS", "X-Custom")
+	handler := cors.New(corsOptions([]string{"https://draw.example.com"})).Handler(http.NotFoundHandler())
+
+	// Browsers send the requested header names lowercased
+	preflight := func(method, header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/api/rooms", nil)
+		r.Header.Set("Origin", "https://draw.example.com")
+		r.Header.Set("Access-Control-Request-Method", method)
+		r.Header.Set("Access-Control-Request-Headers", header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := preflight("PUT", "x-custom"); rec.Header().Get("Access-Control-Allow-Origin") != "https://draw.example.com" {
+		t.Errorf("configured method and header not allowed: %v", rec.Header())
+	}
+	for _, tc := range []struct{ method, header string }{{"DELETE", "x-custom"}, {"GET", "x-other"}} {
+		if rec := preflight(tc.method, tc.header); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s with %s allowed: %v", tc.method, tc.header, rec.Header())
+		}
+	}
+}
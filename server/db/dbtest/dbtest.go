@@ -0,0 +1,81 @@
+// Package dbtest provides a migrated database for tests. Tests using it are
+// skipped unless TEST_DATABASE_URL points at a PostgreSQL server, except in
+// CI, where a missing database fails them.
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Schema creates an empty schema for the test, dropped when it finishes,
+// and returns a pool config whose connections use it. The test is skipped
+// when TEST_DATABASE_URL is unset.
+func Schema(t testing.TB) *pgxpool.Config {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_DATABASE_URL must be set in CI")
+		}
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "test_" + hex.EncodeToString(suffix)
+
+	ctx := context.Background()
+	conn, err := pgx.ConnectConfig(ctx, config.ConnConfig)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.ConnectConfig(ctx, config.ConnConfig)
+		if err != nil {
+			t.Errorf("connect to test database: %v", err)
+			return
+		}
+		defer conn.Close(ctx)
+		if _, err := conn.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	return config
+}
+
+// Pool returns a pool on a fresh schema with every migration applied
+func Pool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), Schema(t))
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := db.RunMigrations(pool); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return pool
+}
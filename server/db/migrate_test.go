@@ -0,0 +1,151 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dre4success/bethel/server/db"
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0010_later.sql":  {Data: []byte("SELECT 10")},
+		"migrations/0002_second.sql": {Data: []byte("SELECT 2")},
+		"migrations/0001_first.sql":  {Data: []byte("SELECT 1")},
+	}
+
+	migrations, err := db.LoadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []db.Migration{
+		{Version: 1, Name: "first", SQL: "SELECT 1"},
+		{Version: 2, Name: "second", SQL: "SELECT 2"},
+		{Version: 10, Name: "later", SQL: "SELECT 10"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(migrations), len(want))
+	}
+	for i := range want {
+		if migrations[i] != want[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, migrations[i], want[i])
+		}
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name": {
+			"migrations/initial.sql": {Data: []byte("SELECT 1")},
+		},
+		"version zero": {
+			"migrations/0000_zero.sql": {Data: []byte("SELECT 1")},
+		},
+		"duplicate version": {
+			"migrations/0001_a.sql": {Data: []byte("SELECT 1")},
+			"migrations/01_b.sql":   {Data: []byte("SELECT 1")},
+		},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := db.LoadMigrations(fsys, "migrations"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// appliedVersions counts the rows in schema_migrations
+func appliedVersions(t *testing.T, pool *pgxpool.Pool) int {
+	t.Helper()
+	var n int
+	if err := pool.QueryRow(context.Background(), "SELECT count(*) FROM schema_migrations").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMigrateTwiceAppliesNothing(t *testing.T) {
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, dbtest.Schema(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The insert would run again if the migration were reapplied
+	migrations := []db.Migration{
+		{Version: 1, Name: "notes", SQL: "CREATE TABLE notes (body TEXT NOT NULL)"},
+		{Version: 2, Name: "seed", SQL: "INSERT INTO notes (body) VALUES ('hello')"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.Migrate(ctx, pool, migrations); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+
+	var rows int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM notes").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Errorf("seed migration ran %d times", rows)
+	}
+	if n := appliedVersions(t, pool); n != 2 {
+		t.Errorf("%d migrations recorded, want 2", n)
+	}
+
+	// Upgrading applies only the new migration
+	migrations = append(migrations, db.Migration{
+		Version: 3, Name: "note_author", SQL: "ALTER TABLE notes ADD COLUMN author TEXT",
+	})
+	if err := db.Migrate(ctx, pool, migrations); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if _, err := pool.Exec(ctx, "UPDATE notes SET author = 'ada'"); err != nil {
+		t.Errorf("new migration not applied: %v", err)
+	}
+	if n := appliedVersions(t, pool); n != 3 {
+		t.Errorf("%d migrations recorded, want 3", n)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, dbtest.Schema(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	migrations := []db.Migration{
+		{Version: 1, Name: "notes", SQL: "CREATE TABLE notes (body TEXT NOT NULL)"},
+		{Version: 2, Name: "broken", SQL: "CREATE TABLE jots (body TEXT); SELECT missing FROM nowhere"},
+	}
+	if err := db.Migrate(ctx, pool, migrations); err == nil {
+		t.Fatal("broken migration succeeded")
+	}
+
+	if n := appliedVersions(t, pool); n != 1 {
+		t.Errorf("%d migrations recorded, want 1", n)
+	}
+	if _, err := pool.Exec(ctx, "SELECT 1 FROM jots"); err == nil {
+		t.Error("broken migration left its changes behind")
+	}
+}
+
+func TestRunMigrationsTwice(t *testing.T) {
+	pool := dbtest.Pool(t)
+	before := appliedVersions(t, pool)
+
+	if err := db.RunMigrations(pool); err != nil {
+		t.Fatal(err)
+	}
+	if after := appliedVersions(t, pool); after != before {
+		t.Errorf("second run recorded %d more migrations", after-before)
+	}
+}
@@ -0,0 +1,158 @@
+-- Migration 0001: initial Bethel schema
+-- Existing databases created before versioned migrations are brought up to
+-- date by the idempotent statements below, so this runs safely on them too.
+
+-- Rooms table
+CREATE TABLE IF NOT EXISTS rooms (
+    id VARCHAR(36) PRIMARY KEY,
+    title VARCHAR(255) DEFAULT 'Untitled',
+    ephemeral BOOLEAN NOT NULL DEFAULT FALSE,
+    default_tool VARCHAR(10) NOT NULL DEFAULT '',
+    default_color VARCHAR(7) NOT NULL DEFAULT '',
+    default_width DOUBLE PRECISION NOT NULL DEFAULT 0,
+    tenant VARCHAR(255) NOT NULL DEFAULT '',
+    owner_token_hash VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Strokes table
+CREATE TABLE IF NOT EXISTS strokes (
+    id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    points JSONB NOT NULL,
+    color VARCHAR(7) NOT NULL,
+    tool VARCHAR(10) NOT NULL CHECK (tool IN ('pen', 'eraser')),
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    created_by VARCHAR(36),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Text blocks table
+CREATE TABLE IF NOT EXISTS text_blocks (
+    id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    x DOUBLE PRECISION NOT NULL,
+    y DOUBLE PRECISION NOT NULL,
+    width DOUBLE PRECISION NOT NULL,
+    height DOUBLE PRECISION NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    font_size DOUBLE PRECISION NOT NULL DEFAULT 24,
+    color VARCHAR(7) NOT NULL DEFAULT '#000000',
+    font_family VARCHAR(100) NOT NULL,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Participant sessions (presence analytics)
+CREATE TABLE IF NOT EXISTS participant_sessions (
+    participant_id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    left_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Idempotency keys for room creation retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Shapes table
+CREATE TABLE IF NOT EXISTS shapes (
+    id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    type VARCHAR(10) NOT NULL CHECK (type IN ('rect', 'ellipse', 'line')),
+    x DOUBLE PRECISION NOT NULL,
+    y DOUBLE PRECISION NOT NULL,
+    width DOUBLE PRECISION NOT NULL,
+    height DOUBLE PRECISION NOT NULL,
+    stroke_color VARCHAR(7) NOT NULL DEFAULT '#000000',
+    fill_color VARCHAR(7) NOT NULL DEFAULT '',
+    stroke_width DOUBLE PRECISION NOT NULL DEFAULT 2,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Images table (files live in upload storage under storage_key)
+CREATE TABLE IF NOT EXISTS images (
+    id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(36) REFERENCES rooms(id) ON DELETE CASCADE,
+    x DOUBLE PRECISION NOT NULL,
+    y DOUBLE PRECISION NOT NULL,
+    width DOUBLE PRECISION NOT NULL,
+    height DOUBLE PRECISION NOT NULL,
+    url TEXT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    created_by VARCHAR(36)
+);
+
+-- Indexes for faster queries
+CREATE INDEX IF NOT EXISTS idx_strokes_room ON strokes(room_id);
+CREATE INDEX IF NOT EXISTS idx_strokes_created ON strokes(created_at);
+CREATE INDEX IF NOT EXISTS idx_text_blocks_room ON text_blocks(room_id);
+CREATE INDEX IF NOT EXISTS idx_text_blocks_updated ON text_blocks(updated_at);
+CREATE INDEX IF NOT EXISTS idx_shapes_room ON shapes(room_id);
+CREATE INDEX IF NOT EXISTS idx_images_room ON images(room_id);
+CREATE INDEX IF NOT EXISTS idx_participant_sessions_room ON participant_sessions(room_id);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys(created_at);
+
+-- Migrations (Idempotent)
+DO $$ 
+BEGIN 
+    -- Migrate Room IDs and Foreign Keys if they are short strings (from VARCHAR(12))
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'rooms' AND column_name = 'id' AND character_maximum_length < 36) THEN
+        ALTER TABLE text_blocks DROP CONSTRAINT IF EXISTS text_blocks_room_id_fkey;
+        ALTER TABLE strokes DROP CONSTRAINT IF EXISTS strokes_room_id_fkey;
+        
+        ALTER TABLE rooms ALTER COLUMN id TYPE VARCHAR(36);
+        ALTER TABLE strokes ALTER COLUMN room_id TYPE VARCHAR(36);
+        ALTER TABLE text_blocks ALTER COLUMN room_id TYPE VARCHAR(36);
+        
+        ALTER TABLE strokes ADD CONSTRAINT strokes_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+        ALTER TABLE text_blocks ADD CONSTRAINT text_blocks_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+    END IF;
+
+    -- Migrate IDs from UUID type to VARCHAR(36) if needed (for consistency)
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'strokes' AND column_name = 'id' AND data_type = 'uuid') THEN
+        ALTER TABLE strokes ALTER COLUMN id TYPE VARCHAR(36);
+        ALTER TABLE text_blocks ALTER COLUMN id TYPE VARCHAR(36);
+    END IF;
+
+    -- Element locking
+    ALTER TABLE strokes ADD COLUMN IF NOT EXISTS locked BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE text_blocks ADD COLUMN IF NOT EXISTS locked BOOLEAN NOT NULL DEFAULT FALSE;
+
+    -- Soft-deleted strokes
+    ALTER TABLE strokes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+    -- Ephemeral (memory-only) rooms
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS ephemeral BOOLEAN NOT NULL DEFAULT FALSE;
+
+    -- Room default tool settings
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS default_tool VARCHAR(10) NOT NULL DEFAULT '';
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS default_color VARCHAR(7) NOT NULL DEFAULT '';
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS default_width DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+    -- Tenant scoping (empty for single-tenant deployments)
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS tenant VARCHAR(255) NOT NULL DEFAULT '';
+
+    -- Soft-deleted rooms
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+    -- Owner token (SHA-256 hex; empty for rooms created before ownership)
+    ALTER TABLE rooms ADD COLUMN IF NOT EXISTS owner_token_hash VARCHAR(64) NOT NULL DEFAULT '';
+END $$;
+
+-- Indexes on columns added by the migrations above
+CREATE INDEX IF NOT EXISTS idx_strokes_deleted ON strokes(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_rooms_tenant ON rooms(tenant);
+CREATE INDEX IF NOT EXISTS idx_rooms_title_search ON rooms USING GIN (to_tsvector('simple', coalesce(title, '')));
+CREATE INDEX IF NOT EXISTS idx_rooms_deleted ON rooms(deleted_at) WHERE deleted_at IS NOT NULL;
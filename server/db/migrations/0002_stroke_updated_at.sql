@@ -0,0 +1,9 @@
+-- Migration 0002: track when strokes change, for incremental resync
+
+ALTER TABLE strokes ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE;
+UPDATE strokes SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE strokes ALTER COLUMN updated_at SET DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_strokes_room_updated ON strokes(room_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_text_blocks_room_updated ON text_blocks(room_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_shapes_room_updated ON shapes(room_id, updated_at);
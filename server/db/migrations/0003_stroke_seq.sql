@@ -0,0 +1,16 @@
+-- Migration 0003: explicit stroke z-order. Existing strokes are numbered in
+-- creation order; new strokes take the next value from the sequence
+
+CREATE SEQUENCE IF NOT EXISTS strokes_seq_seq;
+ALTER TABLE strokes ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+UPDATE strokes SET seq = ordered.n
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY created_at, id) AS n FROM strokes) AS ordered
+WHERE strokes.id = ordered.id;
+
+SELECT setval('strokes_seq_seq', COALESCE((SELECT MAX(seq) FROM strokes), 0) + 1, false);
+ALTER TABLE strokes ALTER COLUMN seq SET DEFAULT nextval('strokes_seq_seq');
+ALTER TABLE strokes ALTER COLUMN seq SET NOT NULL;
+ALTER SEQUENCE strokes_seq_seq OWNED BY strokes.seq;
+
+CREATE INDEX IF NOT EXISTS idx_strokes_room_seq ON strokes(room_id, seq);
@@ -0,0 +1,8 @@
+-- Migration 0004: allow the highlighter tool ("highlighter" is longer than
+-- the original VARCHAR(10) tool columns)
+
+ALTER TABLE strokes DROP CONSTRAINT IF EXISTS strokes_tool_check;
+ALTER TABLE strokes ALTER COLUMN tool TYPE VARCHAR(20);
+ALTER TABLE strokes ADD CONSTRAINT strokes_tool_check CHECK (tool IN ('pen', 'eraser', 'highlighter'));
+
+ALTER TABLE rooms ALTER COLUMN default_tool TYPE VARCHAR(20);
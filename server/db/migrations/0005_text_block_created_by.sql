@@ -0,0 +1,3 @@
+-- Migration 0005: record who added each text block (participant ID)
+
+ALTER TABLE text_blocks ADD COLUMN IF NOT EXISTS created_by VARCHAR(36);
@@ -0,0 +1,4 @@
+-- Migration 0006: record who last edited each text block (participant ID)
+
+ALTER TABLE text_blocks ADD COLUMN IF NOT EXISTS updated_by VARCHAR(36);
+UPDATE text_blocks SET updated_by = created_by WHERE updated_by IS NULL;
@@ -0,0 +1,3 @@
+-- Migration 0007: version text blocks so concurrent updates can detect each other
+
+ALTER TABLE text_blocks ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
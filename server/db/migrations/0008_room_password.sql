@@ -0,0 +1,3 @@
+-- Migration 0008: optional shareable room passwords (bcrypt hash, '' for none)
+
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
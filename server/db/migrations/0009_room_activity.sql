@@ -0,0 +1,4 @@
+-- Migration 0009: per-room engagement (peak concurrent participants, last message)
+
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS peak_participants INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMPTZ;
@@ -0,0 +1,18 @@
+-- Migration 0010: per-stroke bounding boxes for spatial lookups (NULL for strokes without points)
+
+ALTER TABLE strokes ADD COLUMN IF NOT EXISTS min_x DOUBLE PRECISION;
+ALTER TABLE strokes ADD COLUMN IF NOT EXISTS min_y DOUBLE PRECISION;
+ALTER TABLE strokes ADD COLUMN IF NOT EXISTS max_x DOUBLE PRECISION;
+ALTER TABLE strokes ADD COLUMN IF NOT EXISTS max_y DOUBLE PRECISION;
+
+UPDATE strokes s SET min_x = b.min_x, min_y = b.min_y, max_x = b.max_x, max_y = b.max_y
+FROM (
+    SELECT id,
+           MIN((p->>'x')::DOUBLE PRECISION) AS min_x, MIN((p->>'y')::DOUBLE PRECISION) AS min_y,
+           MAX((p->>'x')::DOUBLE PRECISION) AS max_x, MAX((p->>'y')::DOUBLE PRECISION) AS max_y
+    FROM strokes, jsonb_array_elements(points) AS p
+    GROUP BY id
+) b
+WHERE s.id = b.id AND s.min_x IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_strokes_bounds ON strokes(room_id, min_x, max_x);
@@ -0,0 +1,8 @@
+-- Migration 0011: scope room creation idempotency keys by tenant, so two tenants reusing a key don't collide
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS tenant VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE idempotency_keys k SET tenant = r.tenant FROM rooms r WHERE r.id = k.room_id;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (tenant, key);
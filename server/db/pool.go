@@ -0,0 +1,79 @@
+package db
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolSettings overrides pgxpool defaults; zero fields keep the default
+type PoolSettings struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+// PoolSettingsFromEnv reads DB_MAX_CONNS, DB_MIN_CONNS, DB_MAX_CONN_LIFETIME
+// and DB_MAX_CONN_IDLE_TIME. Invalid values are logged and ignored
+func PoolSettingsFromEnv() PoolSettings {
+	var s PoolSettings
+	s.MaxConns = envConns("DB_MAX_CONNS", 1)
+	s.MinConns = envConns("DB_MIN_CONNS", 0)
+	s.MaxConnLifetime = envDuration("DB_MAX_CONN_LIFETIME")
+	s.MaxConnIdleTime = envDuration("DB_MAX_CONN_IDLE_TIME")
+	return s
+}
+
+func envConns(name string, min int64) int32 {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil || n < min {
+		log.Printf("Warning: ignoring invalid %s=%q, using default", name, v)
+		return 0
+	}
+	return int32(n)
+}
+
+func envDuration(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: ignoring invalid %s=%q, using default", name, v)
+		return 0
+	}
+	return d
+}
+
+// apply copies the non-zero settings onto config, dropping MinConns if it
+// would exceed the effective MaxConns
+func (s PoolSettings) apply(config *pgxpool.Config) {
+	if s.MaxConns > 0 {
+		config.MaxConns = s.MaxConns
+	}
+	if s.MinConns > 0 {
+		if s.MinConns > config.MaxConns {
+			log.Printf("Warning: DB_MIN_CONNS (%d) exceeds max connections (%d), using default", s.MinConns, config.MaxConns)
+		} else {
+			config.MinConns = s.MinConns
+		}
+	}
+	if s.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = s.MaxConnLifetime
+	}
+	if s.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = s.MaxConnIdleTime
+	}
+
+	log.Printf("Database pool: max_conns=%d min_conns=%d max_conn_lifetime=%v max_conn_idle_time=%v",
+		config.MaxConns, config.MinConns, config.MaxConnLifetime, config.MaxConnIdleTime)
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPoolSettingsFromEnv(t *testing.T) {
+	t.Setenv("DB_MAX_CONNS", "20")
+	t.Setenv("DB_MIN_CONNS", "2")
+	t.Setenv("DB_MAX_CONN_LIFETIME", "30m")
+	t.Setenv("DB_MAX_CONN_IDLE_TIME", "5m")
+
+	want := PoolSettings{
+		MaxConns:        20,
+		MinConns:        2,
+		MaxConnLifetime: 30 * time.Minute,
+		MaxConnIdleTime: 5 * time.Minute,
+	}
+	if got := PoolSettingsFromEnv(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPoolSettingsFromEnvInvalid(t *testing.T) {
+	captureLog(t)
+
+	tests := []struct{ name, value string }{
+		{"DB_MAX_CONNS", "lots"},
+		{"DB_MAX_CONNS", "0"},
+		{"DB_MIN_CONNS", "-1"},
+		{"DB_MAX_CONN_LIFETIME", "forever"},
+		{"DB_MAX_CONN_IDLE_TIME", "-5m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+			if got := PoolSettingsFromEnv(); got != (PoolSettings{}) {
+				t.Errorf("invalid value was used: %+v", got)
+			}
+		})
+	}
+}
+
+func TestPoolSettingsApply(t *testing.T) {
+	captureLog(t)
+
+	config, err := pgxpool.ParseConfig(unreachableURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := *config
+
+	// Zero settings keep pgxpool's defaults
+	PoolSettings{}.apply(config)
+	if config.MaxConns != defaults.MaxConns || config.MinConns != defaults.MinConns ||
+		config.MaxConnLifetime != defaults.MaxConnLifetime || config.MaxConnIdleTime != defaults.MaxConnIdleTime {
+		t.Errorf("zero settings changed the defaults")
+	}
+
+	PoolSettings{MaxConns: 8, MinConns: 3, MaxConnLifetime: time.Hour, MaxConnIdleTime: time.Minute}.apply(config)
+	if config.MaxConns != 8 || config.MinConns != 3 || config.MaxConnLifetime != time.Hour || config.MaxConnIdleTime != time.Minute {
+		t.Errorf("settings not applied: max=%d min=%d lifetime=%v idle=%v",
+			config.MaxConns, config.MinConns, config.MaxConnLifetime, config.MaxConnIdleTime)
+	}
+
+	// MinConns above MaxConns is dropped
+	PoolSettings{MinConns: 9}.apply(config)
+	if config.MinConns != 3 {
+		t.Errorf("MinConns above MaxConns was applied: %d", config.MinConns)
+	}
+}
@@ -2,47 +2,64 @@ package db
 
 import (
 	"context"
-	_ "embed"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-//go:embed schema.sql
-var schemaSQL string
+// maxRetryDelay caps the exponential backoff between connection attempts
+const maxRetryDelay = 30 * time.Second
 
-// Connect establishes a connection pool to PostgreSQL
-func Connect(databaseURL string) (*pgxpool.Pool, error) {
+// Options controls how Connect reaches the database
+type Options struct {
+	// MaxAttempts is how many times to ping before giving up (minimum 1)
+	MaxAttempts int
+	// BaseDelay is the wait after the first failed attempt; it doubles on
+	// each further failure
+	BaseDelay time.Duration
+	// Pool tunes the connection pool
+	Pool PoolSettings
+}
+
+// Connect establishes a connection pool to PostgreSQL, retrying with
+// exponential backoff while the database isn't reachable yet. It gives up
+// early if ctx is cancelled or its deadline passes
+func Connect(ctx context.Context, databaseURL string, opts Options) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse database URL: %w", err)
 	}
+	opts.Pool.apply(config)
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
-	// Test connection
-	if err := pool.Ping(context.Background()); err != nil {
-		return nil, fmt.Errorf("unable to ping database: %w", err)
-	}
-
-	return pool, nil
-}
-
-// RunMigrations creates the database tables if they don't exist
-func RunMigrations(pool *pgxpool.Pool) error {
-	ctx := context.Background()
+	attempts := max(opts.MaxAttempts, 1)
+	delay := opts.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			break
+		}
 
-	log.Println("Running database migrations from schema.sql...")
-
-	// Execute the embedded SQL schema
-	if _, err := pool.Exec(ctx, schemaSQL); err != nil {
-		return fmt.Errorf("migration failed: %w", err)
+		log.Printf("Database not ready (attempt %d/%d): %v; retrying in %v", attempt, attempts, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		delay = min(delay*2, maxRetryDelay)
 	}
 
-	log.Println("Migrations completed successfully.")
-	return nil
+	pool.Close()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("unable to ping database: %w", ctx.Err())
+	}
+	return nil, fmt.Errorf("unable to ping database after %d attempts: %w", attempts, err)
 }
@@ -0,0 +1,106 @@
+// Package export renders room content to downloadable formats
+package export
+
+import (
+	"math"
+	"strings"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// Stroke widths and layout match the client's renderer (client/src/lib)
+const (
+	minStrokeWidth = 1
+	maxStrokeWidth = 12
+	eraserWidth    = 20
+	padding        = 20
+	lineHeight     = 1.2 // multiple of font size
+	textInset      = 4
+)
+
+// Highlighter strokes are broad and translucent so ink shows through
+const (
+	highlighterWidth   = 16
+	highlighterOpacity = 0.35
+)
+
+// strokeWidth returns the rendered width for a point's pressure
+func strokeWidth(tool string, pressure float64) float64 {
+	switch tool {
+	case "eraser":
+		return eraserWidth
+	case "highlighter":
+		return highlighterWidth
+	}
+	return minStrokeWidth + pressure*(maxStrokeWidth-minStrokeWidth)
+}
+
+// Bounds is the canvas area covered by a room's content, including padding
+type Bounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// Width returns the width of the bounds
+func (b Bounds) Width() float64 { return b.MaxX - b.MinX }
+
+// Height returns the height of the bounds
+func (b Bounds) Height() float64 { return b.MaxY - b.MinY }
+
+// ContentBounds computes the padded bounding box of the visible strokes,
+// text blocks, shapes and images, which may extend to negative coordinates.
+// Erasers are ignored since they only remove ink.
+func ContentBounds(state *models.RoomState) Bounds {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+
+	for _, stroke := range state.Strokes {
+		if stroke.Tool == "eraser" {
+			continue
+		}
+		for _, p := range stroke.Points {
+			half := strokeWidth(stroke.Tool, p.Pressure) / 2
+			minX = math.Min(minX, p.X-half)
+			minY = math.Min(minY, p.Y-half)
+			maxX = math.Max(maxX, p.X+half)
+			maxY = math.Max(maxY, p.Y+half)
+		}
+	}
+
+	for _, tb := range state.TextBlocks {
+		lines := strings.Count(tb.Content, "\n") + 1
+		textHeight := float64(lines)*tb.FontSize*lineHeight + 2*textInset
+		minX = math.Min(minX, tb.X)
+		minY = math.Min(minY, tb.Y)
+		maxX = math.Max(maxX, tb.X+tb.Width)
+		maxY = math.Max(maxY, tb.Y+textHeight)
+	}
+
+	for _, shape := range state.Shapes {
+		half := shape.StrokeWidth / 2
+		x0, x1 := math.Min(shape.X, shape.X+shape.Width), math.Max(shape.X, shape.X+shape.Width)
+		y0, y1 := math.Min(shape.Y, shape.Y+shape.Height), math.Max(shape.Y, shape.Y+shape.Height)
+		minX = math.Min(minX, x0-half)
+		minY = math.Min(minY, y0-half)
+		maxX = math.Max(maxX, x1+half)
+		maxY = math.Max(maxY, y1+half)
+	}
+
+	for _, img := range state.Images {
+		minX = math.Min(minX, img.X)
+		minY = math.Min(minY, img.Y)
+		maxX = math.Max(maxX, img.X+img.Width)
+		maxY = math.Max(maxY, img.Y+img.Height)
+	}
+
+	// Empty canvas
+	if math.IsInf(minX, 1) {
+		return Bounds{MinX: 0, MinY: 0, MaxX: 100, MaxY: 100}
+	}
+
+	return Bounds{
+		MinX: minX - padding,
+		MinY: minY - padding,
+		MaxX: maxX + padding,
+		MaxY: maxY + padding,
+	}
+}
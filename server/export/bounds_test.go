@@ -0,0 +1,48 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestContentBoundsEmpty(t *testing.T) {
+	got := ContentBounds(&models.RoomState{})
+	if got != (Bounds{MaxX: 100, MaxY: 100}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestContentBoundsNegative(t *testing.T) {
+	state := &models.RoomState{
+		Strokes: []models.Stroke{{
+			Tool:   "pen",
+			Points: []models.Point{{X: -500, Y: -300}, {X: -100, Y: -50}},
+		}},
+	}
+
+	got := ContentBounds(state)
+	half := strokeWidth("pen", 0) / 2
+	want := Bounds{
+		MinX: -500 - half - padding,
+		MinY: -300 - half - padding,
+		MaxX: -100 + half + padding,
+		MaxY: -50 + half + padding,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestContentBoundsIgnoresErasers(t *testing.T) {
+	state := &models.RoomState{
+		Strokes: []models.Stroke{
+			{Tool: "pen", Points: []models.Point{{X: 10, Y: 10}}},
+			{Tool: "eraser", Points: []models.Point{{X: 5000, Y: 5000}}},
+		},
+	}
+
+	if got := ContentBounds(state); got.MaxX > 100 || got.MaxY > 100 {
+		t.Errorf("eraser widened the bounds: %+v", got)
+	}
+}
@@ -0,0 +1,223 @@
+package export
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dre4success/bethel/server/models"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// capSegments is the number of sides used to approximate round line caps
+const capSegments = 16
+
+// MaxPixels caps the size of a rendered PNG (64 MB of RGBA); larger boards
+// are scaled down to fit
+const MaxPixels = 16 << 20
+
+// PNG renders the room's content onto a white background and writes it as a
+// PNG. scale multiplies the output size, reduced as needed to stay within
+// MaxPixels. Text is drawn with a fixed bitmap face, so font family and size
+// are approximated. Images are not fetched and are left out.
+func PNG(w io.Writer, state *models.RoomState, scale float64) error {
+	bounds := ContentBounds(state)
+	width := int(math.Ceil(bounds.Width() * scale))
+	height := int(math.Ceil(bounds.Height() * scale))
+	if pixels := float64(width) * float64(height); pixels > MaxPixels {
+		scale *= math.Sqrt(MaxPixels / pixels)
+		width = max(int(bounds.Width()*scale), 1)
+		height = max(int(bounds.Height()*scale), 1)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// Map canvas coordinates onto the image
+	project := func(p models.Point) (float32, float32) {
+		return float32((p.X - bounds.MinX) * scale), float32((p.Y - bounds.MinY) * scale)
+	}
+
+	for _, stroke := range state.Strokes {
+		ink := parseColor(stroke.Color)
+		switch stroke.Tool {
+		case "eraser":
+			ink = color.White
+		case "highlighter":
+			c := ink.(color.RGBA)
+			alpha := highlighterOpacity * 0xff
+			ink = color.NRGBA{R: c.R, G: c.G, B: c.B, A: uint8(alpha)}
+		}
+		tool := stroke.Tool
+		width := func(p models.Point) float64 { return strokeWidth(tool, p.Pressure) }
+		drawStroke(img, stroke.Points, width, scale, project, ink)
+	}
+
+	for _, shape := range state.Shapes {
+		outline := shapeOutline(shape)
+		if shape.FillColor != "" && shape.Type != "line" {
+			fillPolygon(img, outline, project, parseColor(shape.FillColor))
+		}
+		width := func(models.Point) float64 { return shape.StrokeWidth }
+		drawStroke(img, outline, width, scale, project, parseColor(shape.StrokeColor))
+	}
+
+	for _, tb := range state.TextBlocks {
+		drawer := &font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(parseColor(tb.Color)),
+			Face: basicfont.Face7x13,
+		}
+		x := (tb.X - bounds.MinX + textInset) * scale
+		y := (tb.Y - bounds.MinY + textInset) * scale
+		for i, line := range strings.Split(tb.Content, "\n") {
+			baseline := y + (float64(i)*tb.FontSize*lineHeight+tb.FontSize)*scale
+			drawer.Dot = fixed.P(int(x), int(baseline))
+			drawer.DrawString(line)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// drawStroke fills a stroke as round-capped segments whose width is the
+// average of their end points' widths, like the client canvas
+func drawStroke(img *image.RGBA, points []models.Point, width func(models.Point) float64, scale float64, project func(models.Point) (float32, float32), ink color.Color) {
+	if len(points) == 0 {
+		return
+	}
+
+	// Rasterize only the stroke's own bounding box
+	maxWidth := 0.0
+	minX, minY := float32(math.Inf(1)), float32(math.Inf(1))
+	maxX, maxY := float32(math.Inf(-1)), float32(math.Inf(-1))
+	for _, p := range points {
+		x, y := project(p)
+		minX, minY = min(minX, x), min(minY, y)
+		maxX, maxY = max(maxX, x), max(maxY, y)
+		maxWidth = max(maxWidth, width(p)*scale)
+	}
+	pad := float32(maxWidth/2) + 1
+	area := image.Rect(int(minX-pad), int(minY-pad), int(math.Ceil(float64(maxX+pad))), int(math.Ceil(float64(maxY+pad))))
+	area = area.Intersect(img.Bounds())
+	if area.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(area.Dx(), area.Dy())
+	local := func(p models.Point) (float32, float32) {
+		x, y := project(p)
+		return x - float32(area.Min.X), y - float32(area.Min.Y)
+	}
+
+	if len(points) == 1 {
+		x, y := local(points[0])
+		addCircle(z, x, y, float32(width(points[0])*scale/2))
+	}
+	for i := 1; i < len(points); i++ {
+		x0, y0 := local(points[i-1])
+		x1, y1 := local(points[i])
+		r := float32((width(points[i-1]) + width(points[i])) / 2 * scale / 2)
+		addSegment(z, x0, y0, x1, y1, r)
+		addCircle(z, x0, y0, r)
+		addCircle(z, x1, y1, r)
+	}
+
+	z.Draw(img, area, image.NewUniform(ink), image.Point{})
+}
+
+// ellipseSegments is the number of sides used to approximate ellipses
+const ellipseSegments = 64
+
+// shapeOutline returns the points tracing a shape's outline, closed for
+// rects and ellipses
+func shapeOutline(shape models.Shape) []models.Point {
+	x0, y0 := shape.X, shape.Y
+	x1, y1 := shape.X+shape.Width, shape.Y+shape.Height
+
+	switch shape.Type {
+	case "rect":
+		return []models.Point{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}, {X: x0, Y: y0}}
+	case "ellipse":
+		cx, cy := (x0+x1)/2, (y0+y1)/2
+		rx, ry := math.Abs(shape.Width)/2, math.Abs(shape.Height)/2
+		points := make([]models.Point, ellipseSegments+1)
+		for i := range points {
+			angle := 2 * math.Pi * float64(i) / ellipseSegments
+			points[i] = models.Point{X: cx + rx*math.Cos(angle), Y: cy + ry*math.Sin(angle)}
+		}
+		return points
+	case "line":
+		return []models.Point{{X: x0, Y: y0}, {X: x1, Y: y1}}
+	}
+	return nil
+}
+
+// fillPolygon fills the closed outline with ink
+func fillPolygon(img *image.RGBA, outline []models.Point, project func(models.Point) (float32, float32), ink color.Color) {
+	if len(outline) < 3 {
+		return
+	}
+
+	bounds := img.Bounds()
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	for i, p := range outline {
+		x, y := project(p)
+		if i == 0 {
+			z.MoveTo(x, y)
+		} else {
+			z.LineTo(x, y)
+		}
+	}
+	z.ClosePath()
+	z.Draw(img, bounds, image.NewUniform(ink), image.Point{})
+}
+
+// addSegment adds a rectangle of half-width r around the segment. Paths are
+// all wound the same way so overlaps accumulate instead of cancelling.
+func addSegment(z *vector.Rasterizer, x0, y0, x1, y1, r float32) {
+	dx, dy := x1-x0, y1-y0
+	length := float32(math.Hypot(float64(dx), float64(dy)))
+	if length == 0 {
+		return
+	}
+	nx, ny := -dy/length*r, dx/length*r
+
+	z.MoveTo(x0+nx, y0+ny)
+	z.LineTo(x1+nx, y1+ny)
+	z.LineTo(x1-nx, y1-ny)
+	z.LineTo(x0-nx, y0-ny)
+	z.ClosePath()
+}
+
+// addCircle adds a polygon approximating a circle, wound like addSegment
+func addCircle(z *vector.Rasterizer, cx, cy, r float32) {
+	for i := 0; i <= capSegments; i++ {
+		angle := -2 * math.Pi * float64(i) / capSegments
+		x := cx + r*float32(math.Cos(angle))
+		y := cy + r*float32(math.Sin(angle))
+		if i == 0 {
+			z.MoveTo(x, y)
+		} else {
+			z.LineTo(x, y)
+		}
+	}
+	z.ClosePath()
+}
+
+// parseColor converts #RRGGBB to a color, falling back to black
+func parseColor(hex string) color.Color {
+	if !models.IsValidColor(hex) {
+		return color.RGBA{A: 0xff}
+	}
+	v, _ := strconv.ParseUint(hex[1:], 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// render exports the state and decodes the result
+func render(t *testing.T, state *models.RoomState, scale float64) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := PNG(&buf, state, scale); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// inked reports whether any pixel of img is not white
+func inked(img image.Image) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, bl, _ := img.At(x, y).RGBA(); r != 0xffff || g != 0xffff || bl != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestPNGHugeBoard(t *testing.T) {
+	state := &models.RoomState{
+		Strokes: []models.Stroke{{
+			Tool:   "pen",
+			Color:  "#000000",
+			Points: []models.Point{{X: 0, Y: 0, Pressure: 1}, {X: 1e6, Y: 1e6, Pressure: 1}},
+		}},
+	}
+
+	img := render(t, state, 4)
+	size := img.Bounds().Size()
+	if pixels := size.X * size.Y; pixels > MaxPixels {
+		t.Fatalf("rendered %dx%d = %d pixels, over the %d cap", size.X, size.Y, pixels, MaxPixels)
+	}
+	if size.X != size.Y {
+		t.Errorf("aspect ratio changed: %dx%d", size.X, size.Y)
+	}
+	if !inked(img) {
+		t.Error("downscaled stroke not drawn")
+	}
+}
+
+func TestPNGNegativeCoordinates(t *testing.T) {
+	state := &models.RoomState{
+		Strokes: []models.Stroke{{
+			Tool:   "pen",
+			Color:  "#ff0000",
+			Points: []models.Point{{X: -200, Y: -100, Pressure: 1}, {X: -150, Y: -60, Pressure: 1}},
+		}},
+	}
+
+	img := render(t, state, 1)
+	size := img.Bounds().Size()
+	bounds := ContentBounds(state)
+	if size.X < int(bounds.Width()) || size.Y < int(bounds.Height()) {
+		t.Errorf("image %v smaller than the content %+v", size, bounds)
+	}
+
+	// The stroke's midpoint, relative to the content's top left corner
+	x := int(-175 - bounds.MinX)
+	y := int(-80 - bounds.MinY)
+	if got := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA); got.R != 0xff || got.G != 0 || got.B != 0 {
+		t.Errorf("pixel at the stroke is %v, want red", got)
+	}
+}
+
+func TestPNGScale(t *testing.T) {
+	state := &models.RoomState{
+		Strokes: []models.Stroke{{Tool: "pen", Points: []models.Point{{X: 0, Y: 0}, {X: 100, Y: 50}}}},
+	}
+
+	one := render(t, state, 1).Bounds().Size()
+	two := render(t, state, 2).Bounds().Size()
+	if two.X < 2*one.X-1 || two.Y < 2*one.Y-1 {
+		t.Errorf("scale 2 gave %v, scale 1 gave %v", two, one)
+	}
+}
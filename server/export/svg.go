@@ -0,0 +1,138 @@
+package export
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// SVG writes the room's content as an SVG document. Strokes become smoothed
+// paths, shapes their SVG primitives and text blocks text elements, so the
+// result stays editable.
+// Eraser strokes are drawn in the background color.
+func SVG(w io.Writer, state *models.RoomState) error {
+	bounds := ContentBounds(state)
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%s %s %s %s" width="%s" height="%s">`+"\n",
+		num(bounds.MinX), num(bounds.MinY), num(bounds.Width()), num(bounds.Height()),
+		num(bounds.Width()), num(bounds.Height()))
+	fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" fill="#ffffff"/>`+"\n",
+		num(bounds.MinX), num(bounds.MinY), num(bounds.Width()), num(bounds.Height()))
+
+	// Images sit beneath the ink drawn over them
+	for _, img := range state.Images {
+		fmt.Fprintf(out, `<image href="%s" x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none"/>`+"\n",
+			escape(img.URL), num(img.X), num(img.Y), num(img.Width), num(img.Height))
+	}
+
+	for _, stroke := range state.Strokes {
+		if len(stroke.Points) == 0 {
+			continue
+		}
+		ink := svgColor(stroke.Color)
+		opacity := ""
+		switch stroke.Tool {
+		case "eraser":
+			ink = "#ffffff"
+		case "highlighter":
+			opacity = ` stroke-opacity="` + num(highlighterOpacity) + `"`
+		}
+
+		var pressure float64
+		for _, p := range stroke.Points {
+			pressure += p.Pressure
+		}
+		width := strokeWidth(stroke.Tool, pressure/float64(len(stroke.Points)))
+
+		fmt.Fprintf(out, `<path d="%s" fill="none" stroke="%s" stroke-width="%s"%s stroke-linecap="round" stroke-linejoin="round"/>`+"\n",
+			smoothPath(stroke.Points), ink, num(width), opacity)
+	}
+
+	for _, shape := range state.Shapes {
+		writeShape(out, shape)
+	}
+
+	for _, tb := range state.TextBlocks {
+		fmt.Fprintf(out, `<text x="%s" y="%s" font-size="%s" font-family="%s" font-weight="600" fill="%s" dominant-baseline="hanging">`,
+			num(tb.X+textInset), num(tb.Y+textInset), num(tb.FontSize), escape(tb.FontFamily), svgColor(tb.Color))
+		for i, line := range strings.Split(tb.Content, "\n") {
+			fmt.Fprintf(out, `<tspan x="%s" y="%s">%s</tspan>`,
+				num(tb.X+textInset), num(tb.Y+textInset+float64(i)*tb.FontSize*lineHeight), escape(line))
+		}
+		out.WriteString("</text>\n")
+	}
+
+	out.WriteString("</svg>\n")
+	return out.Flush()
+}
+
+// writeShape writes a shape as the matching SVG primitive
+func writeShape(out io.Writer, shape models.Shape) {
+	fill := "none"
+	if shape.FillColor != "" {
+		fill = svgColor(shape.FillColor)
+	}
+	style := fmt.Sprintf(`fill="%s" stroke="%s" stroke-width="%s"`, fill, svgColor(shape.StrokeColor), num(shape.StrokeWidth))
+
+	// Rects and ellipses are drawn from normalized bounds
+	x, y := min(shape.X, shape.X+shape.Width), min(shape.Y, shape.Y+shape.Height)
+	w, h := math.Abs(shape.Width), math.Abs(shape.Height)
+
+	switch shape.Type {
+	case "rect":
+		fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" %s/>`+"\n", num(x), num(y), num(w), num(h), style)
+	case "ellipse":
+		fmt.Fprintf(out, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`+"\n", num(x+w/2), num(y+h/2), num(w/2), num(h/2), style)
+	case "line":
+		fmt.Fprintf(out, `<line x1="%s" y1="%s" x2="%s" y2="%s" %s stroke-linecap="round"/>`+"\n",
+			num(shape.X), num(shape.Y), num(shape.X+shape.Width), num(shape.Y+shape.Height), style)
+	}
+}
+
+// smoothPath builds path data through the points using quadratic curves
+// between midpoints, matching the client's stroke smoothing
+func smoothPath(points []models.Point) string {
+	var d strings.Builder
+	fmt.Fprintf(&d, "M %s %s", num(points[0].X), num(points[0].Y))
+
+	if len(points) == 1 {
+		// Zero-length segment so the round cap renders a dot
+		fmt.Fprintf(&d, " L %s %s", num(points[0].X), num(points[0].Y))
+		return d.String()
+	}
+
+	for i := 1; i < len(points)-1; i++ {
+		midX := (points[i].X + points[i+1].X) / 2
+		midY := (points[i].Y + points[i+1].Y) / 2
+		fmt.Fprintf(&d, " Q %s %s %s %s", num(points[i].X), num(points[i].Y), num(midX), num(midY))
+	}
+	last := points[len(points)-1]
+	fmt.Fprintf(&d, " L %s %s", num(last.X), num(last.Y))
+	return d.String()
+}
+
+// svgColor passes through valid #RRGGBB colors and falls back to black
+func svgColor(hex string) string {
+	if !models.IsValidColor(hex) {
+		return "#000000"
+	}
+	return hex
+}
+
+// num formats a coordinate compactly
+func num(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+// escape makes s safe for XML text and attribute values
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
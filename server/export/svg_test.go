@@ -0,0 +1,138 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// svgElement is a parsed element with its attributes and character data
+type svgElement struct {
+	name  string
+	attrs map[string]string
+	text  string
+}
+
+// parseSVG exports the state and decodes the result as XML, failing on
+// anything that isn't well formed
+func parseSVG(t *testing.T, state *models.RoomState) []svgElement {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := SVG(&buf, state); err != nil {
+		t.Fatal(err)
+	}
+
+	var elements []svgElement
+	var open []int // indexes of the elements not yet closed
+	dec := xml.NewDecoder(&buf)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return elements
+		}
+		if err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			el := svgElement{name: tok.Name.Local, attrs: map[string]string{}}
+			for _, a := range tok.Attr {
+				el.attrs[a.Name.Local] = a.Value
+			}
+			open = append(open, len(elements))
+			elements = append(elements, el)
+		case xml.EndElement:
+			open = open[:len(open)-1]
+		case xml.CharData:
+			if len(open) > 0 {
+				elements[open[len(open)-1]].text += string(tok)
+			}
+		}
+	}
+}
+
+func findElements(elements []svgElement, name string) []svgElement {
+	var found []svgElement
+	for _, el := range elements {
+		if el.name == name {
+			found = append(found, el)
+		}
+	}
+	return found
+}
+
+func TestSVGRoundTrip(t *testing.T) {
+	state := &models.RoomState{
+		Strokes: []models.Stroke{{
+			Tool:   "pen",
+			Color:  "#ff0000",
+			Points: []models.Point{{X: 10, Y: 10, Pressure: 0.5}, {X: 50, Y: 30, Pressure: 0.5}, {X: 90, Y: 10, Pressure: 0.5}},
+		}},
+		TextBlocks: []models.TextBlock{{
+			X: 20, Y: 60, Width: 100, Height: 40,
+			Content:    "Tom & <Jerry>\nsecond line",
+			FontSize:   18,
+			Color:      "#0000ff",
+			FontFamily: "Georgia",
+		}},
+	}
+	elements := parseSVG(t, state)
+
+	if len(elements) == 0 || elements[0].name != "svg" {
+		t.Fatal("document does not start with an svg element")
+	}
+	b := ContentBounds(state)
+	wantViewBox := strings.Join([]string{num(b.MinX), num(b.MinY), num(b.Width()), num(b.Height())}, " ")
+	if got := elements[0].attrs["viewBox"]; got != wantViewBox {
+		t.Errorf("viewBox %q, want %q", got, wantViewBox)
+	}
+
+	paths := findElements(elements, "path")
+	if len(paths) != 1 {
+		t.Fatalf("got %d paths, want 1", len(paths))
+	}
+	if paths[0].attrs["stroke"] != "#ff0000" || !strings.HasPrefix(paths[0].attrs["d"], "M 10.00 10.00") {
+		t.Errorf("stroke path %v", paths[0].attrs)
+	}
+
+	texts := findElements(elements, "text")
+	if len(texts) != 1 {
+		t.Fatalf("got %d text elements, want 1", len(texts))
+	}
+	attrs := texts[0].attrs
+	if attrs["font-size"] != "18.00" || attrs["font-family"] != "Georgia" || attrs["fill"] != "#0000ff" {
+		t.Errorf("text attributes %v", attrs)
+	}
+	spans := findElements(elements, "tspan")
+	if len(spans) != 2 || spans[0].text != "Tom & <Jerry>" || spans[1].text != "second line" {
+		t.Errorf("text lines %+v, want the content split on newlines", spans)
+	}
+}
+
+func TestSVGEraser(t *testing.T) {
+	state := &models.RoomState{Strokes: []models.Stroke{{
+		Tool:   "eraser",
+		Color:  "#ff0000",
+		Points: []models.Point{{X: 0, Y: 0, Pressure: 1}, {X: 10, Y: 10, Pressure: 1}},
+	}}}
+	paths := findElements(parseSVG(t, state), "path")
+	if len(paths) != 1 || paths[0].attrs["stroke"] != "#ffffff" {
+		t.Errorf("eraser paths %+v, want one in the background color", paths)
+	}
+}
+
+func TestSVGHighlighter(t *testing.T) {
+	state := &models.RoomState{Strokes: []models.Stroke{{
+		Tool:   "highlighter",
+		Color:  "#ffcc00",
+		Points: []models.Point{{X: 0, Y: 0, Pressure: 1}, {X: 10, Y: 10, Pressure: 1}},
+	}}}
+	paths := findElements(parseSVG(t, state), "path")
+	if len(paths) != 1 || paths[0].attrs["stroke-opacity"] != num(highlighterOpacity) || paths[0].attrs["stroke"] != "#ffcc00" {
+		t.Errorf("highlighter paths %+v, want one translucent path in its color", paths)
+	}
+}
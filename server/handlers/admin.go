@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+)
+
+// RequireAdmin guards a handler with the X-Admin-Token header.
+// Admin endpoints are disabled entirely when no token is configured.
+func RequireAdmin(adminToken string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.Error(w, "Admin API disabled", http.StatusForbidden)
+			return
+		}
+
+		token := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// DisconnectConnection handles POST /api/admin/connections/{clientId}/disconnect
+func DisconnectConnection(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		clientID := vars["clientId"]
+
+		if !h.DisconnectClient(clientID, "Disconnected by administrator") {
+			http.Error(w, "Connection not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CleanupResponse reports how many rooms a cleanup removed
+type CleanupResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+// CleanupEmptyRooms handles POST /api/admin/cleanup, permanently removing
+// every room with no content and no connected clients, whatever its age
+func CleanupEmptyRooms(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		removed, keys, err := models.PurgeStaleRooms(r.Context(), h.DB, time.Now(), h.ActiveRoomIDs())
+		if err != nil {
+			http.Error(w, "Failed to clean up rooms", http.StatusInternalServerError)
+			return
+		}
+		h.DeleteUploads(keys)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CleanupResponse{Removed: removed})
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		status     int
+	}{
+		{"disabled", "", "anything", http.StatusForbidden},
+		{"missing token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "guess", http.StatusUnauthorized},
+		{"valid token", "s3cret", "s3cret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := RequireAdmin(tt.adminToken, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/cleanup", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Admin-Token", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			if called != (tt.status == http.StatusNoContent) {
+				t.Errorf("handler called = %v", called)
+			}
+		})
+	}
+}
+
+func TestCleanupEmptyRooms(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+
+	create := func(title string) *models.Room {
+		room, err := models.CreateRoom(ctx, pool, "", title, models.RoomOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return room
+	}
+	empty := create("Empty")
+	withContent := create("Content")
+	active := create("Active")
+
+	if err := models.CreateTextBlock(ctx, pool, &models.TextBlock{RoomID: withContent.ID, Content: "keep me"}); err != nil {
+		t.Fatal(err)
+	}
+	// A connected client keeps an empty room alive
+	h.Rooms[active.ID] = map[*hub.Client]bool{{ID: "c1", RoomID: active.ID}: true}
+
+	rec := httptest.NewRecorder()
+	CleanupEmptyRooms(h)(rec, httptest.NewRequest(http.MethodPost, "/api/admin/cleanup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+
+	var resp CleanupResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Removed != 1 {
+		t.Errorf("removed %d rooms, want 1", resp.Removed)
+	}
+
+	if _, err := models.GetRoom(ctx, pool, "", empty.ID); err == nil {
+		t.Error("empty room was kept")
+	}
+	for _, room := range []*models.Room{withContent, active} {
+		if _, err := models.GetRoom(ctx, pool, "", room.ID); err != nil {
+			t.Errorf("room %q was removed: %v", room.Title, err)
+		}
+	}
+}
+
+func TestDisconnectConnection(t *testing.T) {
+	h := hub.NewHub(nil)
+
+	// A live connection for the hub to close
+	upgrader := websocket.Upgrader{}
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := &hub.Client{ID: "c1", RoomID: "room", Hub: h, Conn: <-accepted}
+	h.Rooms["room"] = map[*hub.Client]bool{client: true}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/connections/{clientId}/disconnect", DisconnectConnection(h)).Methods("POST")
+	disconnect := func(id string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/connections/"+id+"/disconnect", nil))
+		return rec.Code
+	}
+
+	if code := disconnect("nobody"); code != http.StatusNotFound {
+		t.Errorf("unknown connection: status %d, want 404", code)
+	}
+
+	done := make(chan int, 1)
+	go func() { done <- disconnect("c1") }()
+	if got := <-h.Unregister; got != client {
+		t.Error("a different client was unregistered")
+	}
+	if code := <-done; code != http.StatusNoContent {
+		t.Errorf("live connection: status %d, want 204", code)
+	}
+
+	// The client is told why before the connection goes
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("client read %v, want a policy violation close", err)
+	}
+}
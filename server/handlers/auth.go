@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type userKey struct{}
+
+// User is the identity carried by a verified JWT
+type User struct {
+	ID   string
+	Name string
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+// AuthMiddleware requires an HS256 JWT signed with secret, sent as an
+// "Authorization: Bearer" header or, for WebSocket clients that cannot set
+// headers, as ?token=. Requests pass through anonymously when secret is empty.
+func AuthMiddleware(secret string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if secret == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				token = r.URL.Query().Get("token")
+			}
+			if token == "" {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			user, err := verifyJWT(token, []byte(secret), time.Now())
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+		})
+	}
+}
+
+// UserFrom returns the authenticated user, if the request carried a token
+func UserFrom(r *http.Request) (User, bool) {
+	user, ok := r.Context().Value(userKey{}).(User)
+	return user, ok
+}
+
+// verifyJWT checks an HS256 token's signature and validity window and
+// returns its subject and name
+func verifyJWT(token string, secret []byte, now time.Time) (User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return User{}, errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return User{}, errInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return User{}, errInvalidToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return User{}, errInvalidToken
+	}
+
+	var claims struct {
+		Sub  string `json:"sub"`
+		Name string `json:"name"`
+		Exp  int64  `json:"exp"`
+		Nbf  int64  `json:"nbf"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil || claims.Sub == "" {
+		return User{}, errInvalidToken
+	}
+	if claims.Exp != 0 && now.Unix() >= claims.Exp {
+		return User{}, errInvalidToken
+	}
+	if claims.Nbf != 0 && now.Unix() < claims.Nbf {
+		return User{}, errInvalidToken
+	}
+
+	return User{ID: claims.Sub, Name: claims.Name}, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
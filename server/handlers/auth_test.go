@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// signJWT builds an HS256 token over claims with secret
+func signJWT(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := header + "." + base64.RawURLEncoding.EncodeToString(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// serveAuth sends a request through AuthMiddleware(secret) and returns the
+// status and the user the handler saw
+func serveAuth(secret, url, authorization string) (int, User, bool) {
+	var user User
+	var ok bool
+	handler := AuthMiddleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok = UserFrom(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code, user, ok
+}
+
+func TestAuthValidToken(t *testing.T) {
+	token := signJWT(t, testSecret, map[string]any{
+		"sub": "user-1", "name": "Ada", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	// WebSocket clients send the token as ?token=
+	for _, tt := range []struct{ url, authorization string }{
+		{"/api/rooms", "Bearer " + token},
+		{"/ws/room?token=" + token, ""},
+	} {
+		code, user, ok := serveAuth(testSecret, tt.url, tt.authorization)
+		if code != http.StatusOK || !ok {
+			t.Errorf("%s: status %d, user set %v; want 200 with a user", tt.url, code, ok)
+		}
+		if user != (User{ID: "user-1", Name: "Ada"}) {
+			t.Errorf("%s: user %+v, want user-1 Ada", tt.url, user)
+		}
+	}
+}
+
+func TestAuthRejectsInvalidTokens(t *testing.T) {
+	now := time.Now()
+	tokens := map[string]string{
+		"missing":       "",
+		"malformed":     "not-a-jwt",
+		"wrong secret":  signJWT(t, "other-secret", map[string]any{"sub": "user-1"}),
+		"expired":       signJWT(t, testSecret, map[string]any{"sub": "user-1", "exp": now.Add(-time.Minute).Unix()}),
+		"not yet valid": signJWT(t, testSecret, map[string]any{"sub": "user-1", "nbf": now.Add(time.Hour).Unix()}),
+		"no subject":    signJWT(t, testSecret, map[string]any{"name": "Ada"}),
+		"unsigned (none)": base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`)) + ".",
+	}
+	for name, token := range tokens {
+		authorization := ""
+		if token != "" {
+			authorization = "Bearer " + token
+		}
+		if code, _, ok := serveAuth(testSecret, "/api/rooms", authorization); code != http.StatusUnauthorized || ok {
+			t.Errorf("%s token: status %d, want 401", name, code)
+		}
+	}
+}
+
+func TestAuthAnonymousWithoutSecret(t *testing.T) {
+	code, _, ok := serveAuth("", "/api/rooms", "")
+	if code != http.StatusOK || ok {
+		t.Errorf("no secret: status %d, user set %v; want 200 anonymously", code, ok)
+	}
+
+	// Tokens are ignored rather than rejected when auth is off
+	code, _, ok = serveAuth("", "/api/rooms", "Bearer not-a-jwt")
+	if code != http.StatusOK || ok {
+		t.Errorf("no secret with a token: status %d, user set %v; want 200 anonymously", code, ok)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dre4success/bethel/server/hub"
+)
+
+// exportFormats are the formats served under /api/rooms/{id}/export.*
+var exportFormats = []string{"png", "svg", "json"}
+
+// ServerCapabilities describes the server for clients feature-detecting
+// before they connect: the WebSocket protocol the hub speaks plus the HTTP
+// features this deployment has enabled
+type ServerCapabilities struct {
+	*hub.Capabilities
+
+	Auth           bool     `json:"auth"` // a JWT is required on /api and /ws
+	RoomPasswords  bool     `json:"roomPasswords"`
+	ExportFormats  []string `json:"exportFormats"`
+	MaxUploadBytes int64    `json:"maxUploadBytes"`
+}
+
+// GetCapabilities handles GET /api/capabilities. It is served without
+// authentication so clients can find out whether they need a token.
+func GetCapabilities(h *hub.Hub, authRequired bool, maxUploadBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ServerCapabilities{
+			Capabilities:   h.Capabilities(),
+			Auth:           authRequired,
+			RoomPasswords:  true,
+			ExportFormats:  exportFormats,
+			MaxUploadBytes: maxUploadBytes,
+		})
+	}
+}
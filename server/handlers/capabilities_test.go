@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/hub"
+)
+
+// getCapabilities fetches and decodes GET /api/capabilities
+func getCapabilities(t *testing.T, h *hub.Hub, authRequired bool) map[string]any {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	GetCapabilities(h, authRequired, 10<<20)(rec, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestGetCapabilitiesStructure(t *testing.T) {
+	body := getCapabilities(t, hub.NewHub(nil), false)
+
+	// Hub capabilities are flattened alongside the HTTP ones
+	for _, key := range []string{
+		"protocolVersion", "messageTypes", "maxMessageSize", "maxStrokePoints",
+		"cursorThrottleMs", "tools", "compression", "strokeMerging",
+		"protocolVersions", "codecs", "maxParticipants",
+		"auth", "roomPasswords", "exportFormats", "maxUploadBytes",
+	} {
+		if _, ok := body[key]; !ok {
+			t.Errorf("missing %q", key)
+		}
+	}
+
+	if got := body["maxUploadBytes"]; got != float64(10<<20) {
+		t.Errorf("maxUploadBytes = %v", got)
+	}
+	if got, _ := body["exportFormats"].([]any); len(got) != len(exportFormats) {
+		t.Errorf("exportFormats = %v", body["exportFormats"])
+	}
+	if got, _ := body["messageTypes"].([]any); len(got) == 0 {
+		t.Error("no message types listed")
+	}
+}
+
+func TestGetCapabilitiesFlags(t *testing.T) {
+	h := hub.NewHub(nil)
+
+	body := getCapabilities(t, h, false)
+	for _, key := range []string{"auth", "compression", "strokeMerging"} {
+		if body[key] != false {
+			t.Errorf("%s = %v, want false", key, body[key])
+		}
+	}
+
+	h.Compression = true
+	h.StrokeMergeWindow = time.Second
+	h.CursorInterval = 50 * time.Millisecond
+	h.MaxParticipants = 7
+
+	body = getCapabilities(t, h, true)
+	for _, key := range []string{"auth", "compression", "strokeMerging"} {
+		if body[key] != true {
+			t.Errorf("%s = %v, want true", key, body[key])
+		}
+	}
+	if body["cursorThrottleMs"] != float64(50) {
+		t.Errorf("cursorThrottleMs = %v", body["cursorThrottleMs"])
+	}
+	if body["maxParticipants"] != float64(7) {
+		t.Errorf("maxParticipants = %v", body["maxParticipants"])
+	}
+}
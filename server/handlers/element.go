@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// elementTypes are the {type} values GetElement serves
+var elementTypes = map[string]bool{"stroke": true, "text": true, "shape": true, "image": true}
+
+// GetElement handles GET /api/rooms/{id}/elements/{type}/{elementId}
+// so clients can re-fetch a single element after a conflict
+func GetElement(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+		elementID := vars["elementId"]
+
+		if !elementTypes[vars["type"]] {
+			http.Error(w, "Unknown element type", http.StatusBadRequest)
+			return
+		}
+		// Also answers 404 for rooms outside the tenant
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		element, err := h.GetElement(r.Context(), roomID, vars["type"], elementID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Element not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load element", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(element)
+	}
+}
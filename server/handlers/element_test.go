@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+)
+
+func TestGetElement(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}/elements/{type}/{elementId}", GetElement(h)).Methods("GET")
+
+	room, err := models.CreateRoom(ctx, pool, "", "Elements", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stroke := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}}}
+	deleted := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: 2, Y: 2}}}
+	for _, s := range []*models.Stroke{stroke, deleted} {
+		if err := models.CreateStroke(ctx, pool, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.DeleteStroke(ctx, pool, room.ID, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	text := &models.TextBlock{RoomID: room.ID, Content: "note"}
+	if err := models.CreateTextBlock(ctx, pool, text); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/"+path, nil))
+		return rec
+	}
+
+	rec := get(room.ID + "/elements/stroke/" + stroke.ID)
+	var gotStroke models.Stroke
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&gotStroke) != nil || gotStroke.ID != stroke.ID {
+		t.Errorf("stroke: status %d, id %q", rec.Code, gotStroke.ID)
+	}
+	rec = get(room.ID + "/elements/text/" + text.ID)
+	var gotText models.TextBlock
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&gotText) != nil || gotText.Content != "note" {
+		t.Errorf("text: status %d, content %q", rec.Code, gotText.Content)
+	}
+
+	for path, want := range map[string]int{
+		room.ID + "/elements/stroke/" + deleted.ID:  http.StatusNotFound,
+		room.ID + "/elements/text/" + stroke.ID:     http.StatusNotFound,
+		room.ID + "/elements/shape/missing":         http.StatusNotFound,
+		"no-such-room/elements/stroke/" + stroke.ID: http.StatusNotFound,
+		room.ID + "/elements/widget/" + stroke.ID:   http.StatusBadRequest,
+	} {
+		if rec := get(path); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/dre4success/bethel/server/export"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxExportScale bounds ?scale= so a single request can't allocate a huge image
+const maxExportScale = 4
+
+// ExportPNG handles GET /api/rooms/{id}/export.png
+func ExportPNG(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		scale := 1.0
+		if raw := r.URL.Query().Get("scale"); raw != "" {
+			parsed, err := strconv.ParseFloat(raw, 64)
+			if err != nil || parsed <= 0 || parsed > maxExportScale {
+				http.Error(w, "Invalid scale", http.StatusBadRequest)
+				return
+			}
+			scale = parsed
+		}
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		roomState, err := h.RoomState(r.Context(), TenantFrom(r), roomID)
+		if err != nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		// Render into a buffer so a failure can still return an error status
+		var buf bytes.Buffer
+		if err := export.PNG(&buf, roomState, scale); err != nil {
+			http.Error(w, "Failed to export room", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+roomID+`.png"`)
+		w.Write(buf.Bytes())
+	}
+}
+
+// ExportSVG handles GET /api/rooms/{id}/export.svg
+func ExportSVG(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		roomState, err := h.RoomState(r.Context(), TenantFrom(r), roomID)
+		if err != nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := export.SVG(&buf, roomState); err != nil {
+			http.Error(w, "Failed to export room", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+roomID+`.svg"`)
+		w.Write(buf.Bytes())
+	}
+}
+
+// ExportJSON handles GET /api/rooms/{id}/export.json
+func ExportJSON(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		roomState, err := h.RoomState(r.Context(), TenantFrom(r), roomID)
+		if err != nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+roomID+`.json"`)
+		json.NewEncoder(w).Encode(roomState)
+	}
+}
+
+// maxImportBytes caps the size of an uploaded room export
+const maxImportBytes = 10 << 20
+
+// ImportRoom handles POST /api/rooms/import. The body is a room export;
+// ?title= overrides the exported title, and ?password= is required when the
+// exported room is a password-protected room on this server. Images must be
+// uploads from this server; their files are copied into the new room.
+func ImportRoom(pool *pgxpool.Pool, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var state models.RoomState
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&state); err != nil {
+			http.Error(w, "Invalid room export", http.StatusBadRequest)
+			return
+		}
+
+		if err := state.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// An export of a password-protected room still on this server needs
+		// its password, or the import would be a way around it
+		if state.Room.ID != "" {
+			err := models.VerifyRoomPassword(r.Context(), pool, TenantFrom(r), state.Room.ID, r.URL.Query().Get("password"))
+			if errors.Is(err, models.ErrWrongPassword) {
+				http.Error(w, "Room password required", http.StatusForbidden)
+				return
+			}
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "Failed to verify password", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Find every image's file before copying any
+		sources := make([]string, len(state.Images))
+		for i, img := range state.Images {
+			key, ok := store.Key(img.URL)
+			if !ok {
+				http.Error(w, fmt.Sprintf("image %d: not an upload on this server", i), http.StatusBadRequest)
+				return
+			}
+			sources[i] = key
+		}
+
+		// The copies belong to the new room, so clearing or deleting the
+		// exported one leaves them alone
+		roomID := models.GenerateRoomID()
+		var copied []string
+		for i, src := range sources {
+			img := &state.Images[i]
+			img.Key = roomID + "/" + uuid.New().String() + path.Ext(src)
+			url, err := store.Copy(r.Context(), src, img.Key)
+			if err != nil {
+				log.Printf("Failed to copy imported image %s: %v", src, err)
+				deleteUploads(store, copied)
+				http.Error(w, fmt.Sprintf("image %d: failed to copy file", i), http.StatusBadRequest)
+				return
+			}
+			img.URL = url
+			copied = append(copied, img.Key)
+		}
+
+		imported, err := models.ImportRoom(r.Context(), pool, &state, roomID, r.URL.Query().Get("title"), TenantFrom(r))
+		if err != nil {
+			deleteUploads(store, copied)
+			http.Error(w, "Failed to import room", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(imported)
+	}
+}
+
+// deleteUploads removes files stored for a request that then failed
+func deleteUploads(store storage.Store, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete image file %s: %v", key, err)
+		}
+	}
+}
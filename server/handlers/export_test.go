@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+)
+
+// postImport sends state to ImportRoom and returns the response
+func postImport(t *testing.T, handler http.HandlerFunc, state *models.RoomState) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/rooms/import", bytes.NewReader(body)))
+	return rec
+}
+
+func TestImportRoomRejectsForeignImages(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := ImportRoom(nil, store)
+
+	for _, url := range []string{
+		"https://elsewhere.example/uploads/room/a.png",
+		"javascript:alert(1)",
+		"/static/logo.png",
+		"/uploads/../secret.png",
+	} {
+		state := &models.RoomState{Images: []models.Image{{URL: url, Width: 10, Height: 10}}}
+		if rec := postImport(t, handler, state); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", url, rec.Code)
+		}
+	}
+}
+
+func TestImportRoomCopiesImages(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := store.Put(ctx, "source/a.png", strings.NewReader("png"), 3, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := &models.RoomState{Images: []models.Image{{URL: url, Width: 10, Height: 10, ContentType: "image/png"}}}
+	rec := postImport(t, ImportRoom(pool, store), state)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var imported models.RoomState
+	if err := json.NewDecoder(rec.Body).Decode(&imported); err != nil {
+		t.Fatal(err)
+	}
+
+	img := imported.Images[0]
+	if !strings.HasPrefix(img.URL, "/uploads/"+imported.Room.ID+"/") {
+		t.Fatalf("imported image URL %s is not in the new room", img.URL)
+	}
+
+	// The copy outlives the source's file
+	if err := store.Delete(ctx, "source/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := store.Key(img.URL)
+	if _, err := os.Stat(filepath.Join(store.Dir, key)); err != nil {
+		t.Errorf("imported copy missing: %v", err)
+	}
+
+	// And is the imported room's to delete
+	saved, err := models.GetImagesByRoom(ctx, pool, imported.Room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Key != key {
+		t.Errorf("saved images %+v, want one with key %s", saved, key)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// healthTimeout bounds the database ping so readiness checks stay fast
+const healthTimeout = 2 * time.Second
+
+// HealthResponse is the body returned by the health endpoints
+type HealthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Readiness records startup steps the server needs before taking traffic
+type Readiness struct {
+	migrated atomic.Bool
+}
+
+// SetMigrated marks database migrations as complete
+func (rd *Readiness) SetMigrated() {
+	rd.migrated.Store(true)
+}
+
+// Livez handles GET /livez: the process is up and serving
+func Livez() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+	}
+}
+
+// Readyz handles GET /readyz, reporting 503 until migrations have run and
+// whenever the database is unreachable
+func Readyz(pool *pgxpool.Pool, rd *Readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !rd.migrated.Load() {
+			writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Error: "migrations not complete"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+
+		if err := pool.Ping(ctx); err != nil {
+			writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Error: "database unreachable: " + err.Error()})
+			return
+		}
+
+		writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, body HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	_ "golang.org/x/image/webp"
+)
+
+// imageExtensions maps the accepted upload types to file extensions
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UploadImage handles POST /api/rooms/{id}/images. The multipart form
+// carries the file in "file" and optional x, y, width and height fields;
+// the size defaults to the image's own dimensions.
+func UploadImage(h *hub.Hub, store storage.Store, maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		// Leave room for the form fields around the file
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid upload", http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if header.Size > maxBytes {
+			http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Trust the content, not the client's declared type
+		sniff := make([]byte, 512)
+		n, _ := io.ReadFull(file, sniff)
+		contentType := http.DetectContentType(sniff[:n])
+		ext, ok := imageExtensions[contentType]
+		if !ok {
+			http.Error(w, "Unsupported image type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+			return
+		}
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			http.Error(w, "Invalid image", http.StatusBadRequest)
+			return
+		}
+
+		img := &models.Image{
+			RoomID:      roomID,
+			Width:       float64(config.Width),
+			Height:      float64(config.Height),
+			ContentType: contentType,
+		}
+		for field, dst := range map[string]*float64{"x": &img.X, "y": &img.Y, "width": &img.Width, "height": &img.Height} {
+			v := r.FormValue(field)
+			if v == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+field, http.StatusBadRequest)
+				return
+			}
+			*dst = f
+		}
+		if img.Width <= 0 || img.Height <= 0 {
+			http.Error(w, "Invalid image size", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+			return
+		}
+		img.Key = roomID + "/" + uuid.New().String() + ext
+		img.URL, err = store.Put(r.Context(), img.Key, file, header.Size, contentType)
+		if err != nil {
+			log.Printf("Failed to store image: %v", err)
+			http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+			return
+		}
+
+		if err := h.AddImage(r.Context(), img); err != nil {
+			log.Printf("Failed to save image: %v", err)
+			store.Delete(r.Context(), img.Key)
+			http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(img)
+	}
+}
+
+// ServeUploads serves locally stored uploads without directory listings
+func ServeUploads(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || r.URL.Path[len(r.URL.Path)-1] == '/' {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/gorilla/mux"
+)
+
+// pngBytes encodes a blank w×h PNG
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// imageForm builds a multipart upload carrying data as "file"
+func imageForm(t *testing.T, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.WriteField("x", "10")
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+func TestUploadImage(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}/images", UploadImage(h, store, 4<<10)).Methods("POST")
+	router.HandleFunc("/api/rooms/{id}/elements/{type}/{elementId}", GetElement(h)).Methods("GET")
+
+	room, err := models.CreateRoom(ctx, pool, "", "Pictures", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(roomID string, data []byte) *httptest.ResponseRecorder {
+		body, contentType := imageForm(t, data)
+		req := httptest.NewRequest(http.MethodPost, "/api/rooms/"+roomID+"/images", body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload(room.ID, pngBytes(t, 3, 2))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", rec.Code, rec.Body)
+	}
+	var img models.Image
+	if err := json.NewDecoder(rec.Body).Decode(&img); err != nil {
+		t.Fatal(err)
+	}
+	if img.X != 10 || img.Width != 3 || img.Height != 2 || img.ContentType != "image/png" {
+		t.Errorf("image = %+v, want x 10, 3×2 png", img)
+	}
+
+	// The file is stored and the image is part of the room
+	stored, err := models.GetImage(ctx, pool, room.ID, img.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, stored.Key)); err != nil {
+		t.Errorf("uploaded file not stored: %v", err)
+	}
+	state, err := models.GetRoomState(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Images) != 1 || state.Images[0].ID != img.ID {
+		t.Errorf("room state images = %+v, want the upload", state.Images)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms/"+room.ID+"/elements/image/"+img.ID, nil)
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, req)
+	if get.Code != http.StatusOK {
+		t.Errorf("GET image element: status %d, want 200", get.Code)
+	}
+
+	// Rejected uploads store nothing
+	rejected := []struct {
+		name   string
+		roomID string
+		data   []byte
+		want   int
+	}{
+		{"oversized", room.ID, make([]byte, 8<<10), http.StatusRequestEntityTooLarge},
+		{"not an image", room.ID, []byte("just some text, not a picture"), http.StatusUnsupportedMediaType},
+		{"missing room", "no-such-room", pngBytes(t, 1, 1), http.StatusNotFound},
+	}
+	for _, tt := range rejected {
+		if rec := upload(tt.roomID, tt.data); rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Errorf("%d files stored, want only the accepted upload", len(objects))
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RequireOwner guards a destructive room handler with the X-Owner-Token
+// header returned when the room was created
+func RequireOwner(pool *pgxpool.Pool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		err := models.VerifyRoomOwner(r.Context(), pool, TenantFrom(r), roomID, r.Header.Get("X-Owner-Token"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrNotOwner) {
+			http.Error(w, "Owner token required", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to verify owner", http.StatusInternalServerError)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ClearRoom handles POST /api/rooms/{id}/clear. It is refused while
+// participants hold elements in the room.
+func ClearRoom(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		err := h.ClearRoom(r.Context(), roomID)
+		if errors.Is(err, models.ErrLocked) {
+			http.Error(w, "Elements are locked by participants", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to clear room", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteStroke handles DELETE /api/rooms/{id}/strokes/{strokeId}, letting
+// the owner remove a single stroke. Clients see a stroke_delete.
+func DeleteStroke(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+		strokeID := vars["strokeId"]
+
+		err := h.DeleteStroke(r.Context(), roomID, strokeID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Stroke not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrLocked) {
+			http.Error(w, "Stroke is locked", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete stroke", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteRoom handles DELETE /api/rooms/{id}, soft-deleting the room and
+// disconnecting anyone still in it
+func DeleteRoom(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		err := models.DeleteRoom(r.Context(), h.DB, roomID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete room", http.StatusInternalServerError)
+			return
+		}
+
+		h.CloseRoom(roomID, "Room deleted")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RenameRoomRequest represents the request body for renaming a room
+type RenameRoomRequest struct {
+	Title string `json:"title"`
+}
+
+// RenameRoom handles PUT /api/rooms/{id}
+func RenameRoom(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		var req RenameRoomRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		title, err := models.NormalizeTitle(req.Title)
+		if err != nil {
+			http.Error(w, "Invalid title: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := models.UpdateRoomTitle(r.Context(), h.DB, roomID, title); err != nil {
+			http.Error(w, "Failed to rename room", http.StatusInternalServerError)
+			return
+		}
+		room, err := models.GetRoom(r.Context(), h.DB, TenantFrom(r), roomID)
+		if err != nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		h.RenameRoom(roomID, title)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(room)
+	}
+}
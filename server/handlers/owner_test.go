@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestRequireOwner(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}", RequireOwner(pool, RenameRoom(h))).Methods("PUT")
+	router.HandleFunc("/api/rooms/{id}", RequireOwner(pool, DeleteRoom(h))).Methods("DELETE")
+
+	room, err := models.CreateRoom(ctx, pool, "", "Original", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, roomID, token, body string) int {
+		req := httptest.NewRequest(method, "/api/rooms/"+roomID, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-Owner-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Unauthorized destructive calls are refused and change nothing
+	for _, token := range []string{"", "not-the-token"} {
+		if code := serve("PUT", room.ID, token, `{"title":"Hijacked"}`); code != http.StatusForbidden {
+			t.Errorf("rename with token %q: status %d, want 403", token, code)
+		}
+		if code := serve("DELETE", room.ID, token, ""); code != http.StatusForbidden {
+			t.Errorf("delete with token %q: status %d, want 403", token, code)
+		}
+	}
+	got, err := models.GetRoom(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatalf("room gone after unauthorized delete: %v", err)
+	}
+	if got.Title != "Original" {
+		t.Errorf("title changed by unauthorized rename: %q", got.Title)
+	}
+
+	if code := serve("DELETE", "no-such-room", room.OwnerToken, ""); code != http.StatusNotFound {
+		t.Errorf("delete of a missing room: status %d, want 404", code)
+	}
+
+	// The owner token authorizes them
+	if code := serve("PUT", room.ID, room.OwnerToken, `{"title":"Renamed"}`); code != http.StatusOK {
+		t.Errorf("owner rename: status %d, want 200", code)
+	}
+	if got, err := models.GetRoom(ctx, pool, "", room.ID); err != nil || got.Title != "Renamed" {
+		t.Errorf("owner rename not applied: %v, %v", got, err)
+	}
+	if code := serve("DELETE", room.ID, room.OwnerToken, ""); code != http.StatusNoContent {
+		t.Errorf("owner delete: status %d, want 204", code)
+	}
+	if _, err := models.GetRoom(ctx, pool, "", room.ID); err == nil {
+		t.Error("room still found after owner delete")
+	}
+}
+
+func TestRenameRoomInvalidTitle(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}", RenameRoom(hub.NewHub(nil))).Methods("PUT")
+
+	for _, body := range []string{
+		`{"title":""}`,
+		`{"title":"   "}`,
+		`{"title":"` + strings.Repeat("a", models.MaxTitleLength+1) + `"}`,
+		`not json`,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/rooms/abc", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("body %.30q: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestDeleteRoomDisconnectsClients(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	room, err := models.CreateRoom(ctx, pool, "", "Doomed", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/{roomId}", WebSocketHandler(h, []string{"*"}))
+	router.HandleFunc("/api/rooms/{id}", DeleteRoom(h)).Methods("DELETE")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/"+room.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for len(h.GetRoomParticipants(room.ID)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/rooms/"+room.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want 204", rec.Code)
+	}
+
+	// The live client is told why and dropped
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != "Room deleted" {
+			t.Errorf("connection ended with %v, want close 1001 \"Room deleted\"", err)
+		}
+		break
+	}
+	for len(h.GetRoomParticipants(room.ID)) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeleteStroke(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	room, err := models.CreateRoom(ctx, pool, "", "Moderated", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := models.CreateRoom(ctx, pool, "", "Elsewhere", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stroke := &models.Stroke{RoomID: room.ID, Points: []models.Point{{X: 1, Y: 1}}, Color: "#000000", Tool: "pen"}
+	if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &hub.Client{ID: "c1", RoomID: room.ID, Hub: h, Send: make(chan []byte, 64)}
+	h.Register <- client
+	for len(h.GetRoomParticipants(room.ID)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}/strokes/{strokeId}", DeleteStroke(h)).Methods("DELETE")
+	del := func(roomID string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/rooms/"+roomID+"/strokes/"+stroke.ID, nil))
+		return rec.Code
+	}
+
+	// The stroke must belong to the room in the path
+	if code := del(other.ID); code != http.StatusNotFound {
+		t.Errorf("delete through another room: status %d, want 404", code)
+	}
+	if _, err := models.GetStroke(ctx, pool, room.ID, stroke.ID); err != nil {
+		t.Errorf("stroke gone after a wrong-room delete: %v", err)
+	}
+
+	if code := del(room.ID); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d, want 204", code)
+	}
+	if _, err := models.GetStroke(ctx, pool, room.ID, stroke.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetStroke after delete: got %v, want ErrNoRows", err)
+	}
+
+	// Live clients are told
+	timeout := time.After(5 * time.Second)
+	for deleted := false; !deleted; {
+		select {
+		case data := <-client.Send:
+			var msg hub.ServerMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == "stroke_delete" {
+				deleted = true
+				if msg.StrokeID != stroke.ID {
+					t.Errorf("stroke_delete for %q, want %q", msg.StrokeID, stroke.ID)
+				}
+			}
+		case <-timeout:
+			t.Fatal("no stroke_delete broadcast")
+		}
+	}
+
+	if code := del(room.ID); code != http.StatusNotFound {
+		t.Errorf("deleting twice: status %d, want 404", code)
+	}
+}
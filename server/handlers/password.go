@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// checkRoomPassword verifies the request's ?password= against the room's,
+// writing the error response and returning false when access is denied
+func checkRoomPassword(w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool, roomID string) bool {
+	err := models.VerifyRoomPassword(r.Context(), pool, TenantFrom(r), roomID, r.URL.Query().Get("password"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return false
+	}
+	if errors.Is(err, models.ErrWrongPassword) {
+		http.Error(w, "Room password required", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify password", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// SetRoomPasswordRequest represents the request body for changing a room's
+// password; an empty password removes it
+type SetRoomPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// SetRoomPassword handles PUT /api/rooms/{id}/password
+func SetRoomPassword(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		var req SetRoomPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Password) > models.MaxPasswordLength {
+			http.Error(w, "Password too long", http.StatusBadRequest)
+			return
+		}
+
+		if err := models.SetRoomPassword(r.Context(), pool, roomID, req.Password); err != nil {
+			http.Error(w, "Failed to set password", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
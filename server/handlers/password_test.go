@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestRoomPassword(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}", GetRoom(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/elements/{type}/{elementId}", GetElement(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/summary", GetRoomSummary(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/strokes", GetRoomStrokes(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/presence", GetRoomPresence(pool)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/participants", GetRoomParticipants(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/export.json", ExportJSON(h)).Methods("GET")
+
+	protected, err := models.CreateRoom(ctx, pool, "", "Secret", models.RoomOptions{Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := models.CreateRoom(ctx, pool, "", "Open", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := func(roomID string) []string {
+		tb := &models.TextBlock{RoomID: roomID, Content: "hello"}
+		if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+			t.Fatal(err)
+		}
+		base := "/api/rooms/" + roomID
+		return []string{
+			base,
+			base + "/elements/text/" + tb.ID,
+			base + "/summary",
+			base + "/strokes",
+			base + "/presence",
+			base + "/participants",
+			base + "/export.json",
+		}
+	}
+
+	get := func(path, password string) int {
+		if password != "" {
+			path += "?password=" + url.QueryEscape(password)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	for _, path := range paths(protected.ID) {
+		if code := get(path, "hunter2"); code != http.StatusOK {
+			t.Errorf("%s with the password: status %d, want 200", path, code)
+		}
+		if code := get(path, "wrong"); code != http.StatusForbidden {
+			t.Errorf("%s with a wrong password: status %d, want 403", path, code)
+		}
+		if code := get(path, ""); code != http.StatusForbidden {
+			t.Errorf("%s without a password: status %d, want 403", path, code)
+		}
+	}
+
+	// Rooms without a password need none
+	for _, path := range paths(open.ID) {
+		if code := get(path, ""); code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", path, code)
+		}
+	}
+}
+
+func TestRoomPasswordWrites(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/import", ImportRoom(pool, store)).Methods("POST")
+	router.HandleFunc("/api/rooms/{id}/images", UploadImage(h, store, 1<<20)).Methods("POST")
+
+	protected, err := models.CreateRoom(ctx, pool, "", "Secret", models.RoomOptions{Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(password string) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", "dot.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+			t.Fatal(err)
+		}
+		form.Close()
+
+		path := "/api/rooms/" + protected.ID + "/images"
+		if password != "" {
+			path += "?password=" + url.QueryEscape(password)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := upload(""); code != http.StatusForbidden {
+		t.Errorf("upload without the password: status %d, want 403", code)
+	}
+	if code := upload("wrong"); code != http.StatusForbidden {
+		t.Errorf("upload with a wrong password: status %d, want 403", code)
+	}
+	if code := upload("hunter2"); code != http.StatusCreated {
+		t.Errorf("upload with the password: status %d, want 201", code)
+	}
+
+	importRoom := func(roomID, password string) int {
+		body, err := json.Marshal(models.RoomState{Room: models.Room{ID: roomID, Title: "Copy"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := "/api/rooms/import"
+		if password != "" {
+			path += "?password=" + url.QueryEscape(password)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := importRoom(protected.ID, ""); code != http.StatusForbidden {
+		t.Errorf("import of a protected room without the password: status %d, want 403", code)
+	}
+	if code := importRoom(protected.ID, "hunter2"); code != http.StatusCreated {
+		t.Errorf("import of a protected room with the password: status %d, want 201", code)
+	}
+	// Exports of rooms this server doesn't have import freely
+	if code := importRoom("elsewhere", ""); code != http.StatusCreated {
+		t.Errorf("import of an unknown room: status %d, want 201", code)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+)
+
+// maxReplayGap caps the pause between strokes in a realtime replay, so long
+// breaks in drawing don't stall playback
+const maxReplayGap = 5 * time.Second
+
+// ReplayRoom handles GET /api/rooms/{id}/replay, streaming the room's strokes
+// oldest first as server-sent "stroke" events followed by an "end" event.
+// With ?realtime=true strokes are paced by the time between their creation.
+func ReplayRoom(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+		realtime := r.URL.Query().Get("realtime") == "true"
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		strokes, err := h.RoomStrokes(r.Context(), roomID, nil)
+		if err != nil {
+			http.Error(w, "Failed to load strokes", http.StatusInternalServerError)
+			return
+		}
+		slices.SortStableFunc(strokes, func(a, b models.Stroke) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		// Middleware wrappers expose the underlying writer's Flush via Unwrap
+		rc := http.NewResponseController(w)
+
+		for i, stroke := range strokes {
+			if realtime && i > 0 {
+				gap := min(stroke.CreatedAt.Sub(strokes[i-1].CreatedAt), maxReplayGap)
+				if gap > 0 {
+					timer := time.NewTimer(gap)
+					select {
+					case <-timer.C:
+					case <-r.Context().Done():
+						timer.Stop()
+						return
+					}
+				}
+			}
+
+			data, err := json.Marshal(stroke)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: stroke\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+
+		fmt.Fprintf(w, "event: end\ndata: {\"count\":%d}\n\n", len(strokes))
+		rc.Flush()
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+)
+
+// replayEvent is one server-sent event and when it arrived
+type replayEvent struct {
+	name string
+	data string
+	at   time.Time
+}
+
+// readReplay collects a replay stream's events as they arrive
+func readReplay(t *testing.T, url string) []replayEvent {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var events []replayEvent
+	var current replayEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			current.at = time.Now()
+			events = append(events, current)
+			current = replayEvent{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestReplayRoom(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Lesson", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drawn 200ms then 400ms apart; stacking order differs from drawing order
+	start := time.Now().Add(-time.Hour)
+	offsets := []time.Duration{0, 200 * time.Millisecond, 600 * time.Millisecond}
+	var ids []string
+	for _, offset := range offsets {
+		stroke := &models.Stroke{RoomID: room.ID, Points: []models.Point{{X: 1, Y: 1}}, Color: "#000000", Tool: "pen"}
+		if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, `UPDATE strokes SET created_at = $1 WHERE id = $2`, start.Add(offset), stroke.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, stroke.ID)
+	}
+	if err := models.ReorderStrokes(ctx, pool, room.ID, []string{ids[2], ids[1], ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}/replay", ReplayRoom(h)).Methods("GET")
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := server.URL + "/api/rooms/" + room.ID + "/replay"
+
+	check := func(events []replayEvent) {
+		t.Helper()
+		if len(events) != len(ids)+1 {
+			t.Fatalf("got %d events, want %d strokes and the end", len(events), len(ids))
+		}
+		for i, id := range ids {
+			var stroke models.Stroke
+			if err := json.Unmarshal([]byte(events[i].data), &stroke); err != nil || events[i].name != "stroke" {
+				t.Fatalf("event %d: %s %s (%v)", i, events[i].name, events[i].data, err)
+			}
+			if stroke.ID != id {
+				t.Errorf("event %d is stroke %s, want %s in creation order", i, stroke.ID, id)
+			}
+		}
+		if end := events[len(ids)]; end.name != "end" || end.data != `{"count":3}` {
+			t.Errorf("last event %s %s, want end with the count", end.name, end.data)
+		}
+	}
+
+	events := readReplay(t, url)
+	check(events)
+	if took := events[len(events)-1].at.Sub(events[0].at); took > 150*time.Millisecond {
+		t.Errorf("plain replay took %v, want no pacing", took)
+	}
+
+	// Realtime replay waits out the gaps between strokes
+	events = readReplay(t, url+"?realtime=true")
+	check(events)
+	for i := 1; i < len(offsets); i++ {
+		want := offsets[i] - offsets[i-1]
+		if got := events[i].at.Sub(events[i-1].at); got < want-20*time.Millisecond || got > want+150*time.Millisecond {
+			t.Errorf("gap before stroke %d = %v, want about %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return &buf
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	logs := captureLog(t)
+
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	serve := func(id string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Request-ID"); got != seen {
+			t.Errorf("response header %q, handler saw %q", got, seen)
+		}
+		return seen
+	}
+
+	if got := serve("trace-1234"); got != "trace-1234" {
+		t.Errorf("supplied ID became %q", got)
+	}
+	if !strings.Contains(logs.String(), "[trace-1234] GET /api/rooms 418") {
+		t.Errorf("request not logged under its ID: %s", logs)
+	}
+
+	// Missing or unsafe IDs are replaced with generated ones
+	for _, id := range []string{"", "has spaces", "line\nbreak", strings.Repeat("a", 129)} {
+		if got := serve(id); got == id || got == "" {
+			t.Errorf("ID %.20q kept as %.20q, want a generated one", id, got)
+		}
+	}
+}
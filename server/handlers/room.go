@@ -2,69 +2,206 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"math/rand"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/dre4success/bethel/server/hub"
 	"github.com/dre4success/bethel/server/models"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // CreateRoomRequest represents the request body for room creation
 type CreateRoomRequest struct {
-	Title string `json:"title"`
+	ID        string              `json:"id"` // optional; generated when empty
+	Title     string              `json:"title"`
+	Ephemeral bool                `json:"ephemeral"`
+	Defaults  models.RoomDefaults `json:"defaults"`
+
+	// Optional password required to open the room
+	Password string `json:"password,omitempty"`
 }
 
 // CreateRoom handles POST /api/rooms
-func CreateRoom(pool *pgxpool.Pool) http.HandlerFunc {
+func CreateRoom(pool *pgxpool.Pool, names NameGenerator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateRoomRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			// Default title if none provided
-			req.Title = generateFunName()
+			req.Title = names.Generate()
 		}
 
 		if req.Title == "" {
-			req.Title = generateFunName()
+			req.Title = names.Generate()
+		}
+
+		if req.ID != "" && !models.IsValidRoomID(req.ID) {
+			http.Error(w, "Invalid room ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := req.Defaults.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Password) > models.MaxPasswordLength {
+			http.Error(w, "Password too long", http.StatusBadRequest)
+			return
+		}
+
+		opts := models.RoomOptions{
+			Ephemeral: req.Ephemeral,
+			Defaults:  req.Defaults,
+			Tenant:    TenantFrom(r),
+			Password:  req.Password,
 		}
 
-		room, err := models.CreateRoom(r.Context(), pool, "", req.Title)
+		// Retries with the same Idempotency-Key get the original room back
+		var room *models.Room
+		var err error
+		created := true
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			if !models.IsValidIdempotencyKey(key) {
+				http.Error(w, "Invalid Idempotency-Key", http.StatusBadRequest)
+				return
+			}
+			room, created, err = models.CreateRoomOnce(r.Context(), pool, key, req.ID, req.Title, opts)
+		} else {
+			room, err = models.CreateRoom(r.Context(), pool, req.ID, req.Title, opts)
+		}
+		if errors.Is(err, models.ErrRoomExists) {
+			http.Error(w, "Room already exists", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to create room", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
 		json.NewEncoder(w).Encode(room)
 	}
 }
 
-func generateFunName() string {
-	adjectives := []string{
+// NameGenerator produces titles for rooms created without one
+type NameGenerator interface {
+	Generate() string
+}
+
+var (
+	nameAdjectives = []string{
 		"Cosmic", "Velvet", "Neon", "Quiet", "Paper", "Wild", "Lazy", "Hidden", "Silent", "Rapid",
 		"Misty", "Golden", "Silver", "Electric", "Secret", "Hollow", "Living", "Dancing", "Flying",
 	}
-	nouns := []string{
+	nameNouns = []string{
 		"Sketch", "Canvas", "Thoughts", "Storm", "Dreams", "Ink", "River", "Forest", "Mountain", "Sky",
 		"Ocean", "Spark", "Flame", "Shadow", "Light", "Echo", "Galaxy", "Star", "Moon",
 	}
+)
+
+// FunNameGenerator builds "Adjective Noun" titles from a random source.
+// Seed the source deterministically to replay a known sequence of names.
+type FunNameGenerator struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewFunNameGenerator creates a generator drawing from rng
+func NewFunNameGenerator(rng *rand.Rand) *FunNameGenerator {
+	return &FunNameGenerator{rng: rng}
+}
+
+// NewSeededFunNameGenerator creates a generator seeded from the current time
+func NewSeededFunNameGenerator() *FunNameGenerator {
+	return NewFunNameGenerator(rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// Generate returns the next name. Both words are drawn independently.
+func (g *FunNameGenerator) Generate() string {
+	// *rand.Rand is not safe for concurrent use
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	adj := nameAdjectives[g.rng.Intn(len(nameAdjectives))]
+	noun := nameNouns[g.rng.Intn(len(nameNouns))]
 
-    // Use current time purely for pseudo-random selection to avoid global seed issues
-    nano := time.Now().UnixNano()
-    adj := adjectives[int(nano)%len(adjectives)]
-    noun := nouns[int(nano/2)%len(nouns)]
-    
 	return adj + " " + noun
 }
 
+// Pagination bounds for ListRooms
+const (
+	defaultRoomsLimit = 20
+	maxRoomsLimit     = 100
+)
+
+// ListRoomsResponse is a page of rooms
+type ListRoomsResponse struct {
+	Rooms  []models.Room `json:"rooms"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// ListRooms handles GET /api/rooms?limit=&offset=
+func ListRooms(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset := defaultRoomsLimit, 0
+
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxRoomsLimit)
+		}
+		if v := r.URL.Query().Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		rooms, total, err := models.ListRooms(r.Context(), pool, TenantFrom(r), limit, offset)
+		if err != nil {
+			http.Error(w, "Failed to list rooms", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListRoomsResponse{
+			Rooms:  rooms,
+			Total:  total,
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+}
+
 // GetRoom handles GET /api/rooms/{id}
-func GetRoom(pool *pgxpool.Pool) http.HandlerFunc {
+func GetRoom(h *hub.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		roomID := vars["id"]
 
-		roomState, err := models.GetRoomState(r.Context(), pool, roomID)
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		roomState, err := h.RoomState(r.Context(), TenantFrom(r), roomID)
 		if err != nil {
 			http.Error(w, "Room not found", http.StatusNotFound)
 			return
@@ -74,3 +211,157 @@ func GetRoom(pool *pgxpool.Pool) http.HandlerFunc {
 		json.NewEncoder(w).Encode(roomState)
 	}
 }
+
+// GetRoomSummary handles GET /api/rooms/{id}/summary, returning the room's
+// metadata and content counts without the content
+func GetRoomSummary(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		summary, err := h.RoomSummary(r.Context(), TenantFrom(r), roomID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load room", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// GetRoomStrokes handles GET /api/rooms/{id}/strokes?since=, for clients
+// polling without a WebSocket. since (RFC 3339) limits the result to strokes
+// created after it; without it every stroke is returned. Strokes are ordered
+// oldest first.
+func GetRoomStrokes(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		var since *time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				http.Error(w, "Invalid since, expected an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			since = &t
+		}
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		strokes, err := h.RoomStrokes(r.Context(), roomID, since)
+		if err != nil {
+			http.Error(w, "Failed to load strokes", http.StatusInternalServerError)
+			return
+		}
+
+		// Stacking order can differ from creation order after a reorder
+		slices.SortStableFunc(strokes, func(a, b models.Stroke) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(strokes)
+	}
+}
+
+// maxSearchResults caps the rooms returned by SearchRooms
+const maxSearchResults = 50
+
+// SearchRooms handles GET /api/rooms/search?q=
+func SearchRooms(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Search query required", http.StatusBadRequest)
+			return
+		}
+		if len(query) > 255 {
+			http.Error(w, "Search query too long", http.StatusBadRequest)
+			return
+		}
+
+		rooms, err := models.SearchRooms(r.Context(), pool, TenantFrom(r), query, maxSearchResults)
+		if err != nil {
+			http.Error(w, "Failed to search rooms", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rooms)
+	}
+}
+
+// RoomExists handles HEAD /api/rooms/{id}
+func RoomExists(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		exists, err := models.RoomExists(r.Context(), pool, TenantFrom(r), roomID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetRoomPresence handles GET /api/rooms/{id}/presence
+func GetRoomPresence(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		if !checkRoomPassword(w, r, pool, roomID) {
+			return
+		}
+
+		presence, err := models.GetRoomPresence(r.Context(), pool, roomID)
+		if err != nil {
+			http.Error(w, "Failed to load presence", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(presence)
+	}
+}
+
+// GetRoomParticipants handles GET /api/rooms/{id}/participants, listing who
+// is connected to the room right now
+func GetRoomParticipants(h *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		roomID := vars["id"]
+
+		if !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		participants := h.GetRoomParticipants(roomID)
+		if participants == nil {
+			participants = []hub.Participant{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(participants)
+	}
+}
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+)
+
+func TestListRoomsInvalidParams(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=-5", "limit=ten", "offset=-1", "offset=x"} {
+		t.Run(query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ListRooms(nil)(rec, httptest.NewRequest(http.MethodGet, "/api/rooms?"+query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestListRoomsLimits(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	const rooms = 25
+	for i := 0; i < rooms; i++ {
+		if _, err := models.CreateRoom(ctx, pool, "", fmt.Sprintf("Room %d", i), models.RoomOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query       string
+		limit, page int
+	}{
+		{"", defaultRoomsLimit, defaultRoomsLimit},
+		{"?limit=5", 5, 5},
+		{"?limit=5&offset=23", 5, 2},
+		{"?limit=500", maxRoomsLimit, rooms},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ListRooms(pool)(rec, httptest.NewRequest(http.MethodGet, "/api/rooms"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d", rec.Code)
+			}
+
+			var resp ListRoomsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Limit != tt.limit {
+				t.Errorf("limit = %d, want %d", resp.Limit, tt.limit)
+			}
+			if len(resp.Rooms) != tt.page {
+				t.Errorf("got %d rooms, want %d", len(resp.Rooms), tt.page)
+			}
+			if resp.Total != rooms {
+				t.Errorf("total = %d, want %d", resp.Total, rooms)
+			}
+		})
+	}
+}
+
+func TestEphemeralRoomReaders(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	room, err := models.CreateRoom(ctx, pool, "", "Scratch", models.RoomOptions{Ephemeral: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ephemeral content only exists in memory while someone is connected
+	client := &hub.Client{ID: "c1", RoomID: room.ID, Hub: h, Ephemeral: true, Send: make(chan []byte, 64)}
+	h.Register <- client
+	for len(h.GetRoomParticipants(room.ID)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	h.HandleMessage(client, &hub.ClientMessage{Type: "stroke_add", Stroke: &models.Stroke{
+		ID:     "s1",
+		Points: []models.Point{{X: 0, Y: 0}, {X: 300, Y: 10}},
+		Color:  "#000000",
+		Tool:   "pen",
+	}})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}", GetRoom(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/summary", GetRoomSummary(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/strokes", GetRoomStrokes(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/replay", ReplayRoom(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/export.json", ExportJSON(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/export.png", ExportPNG(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/export.svg", ExportSVG(h)).Methods("GET")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/"+room.ID+path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, rec.Code)
+		}
+		return rec
+	}
+
+	for _, path := range []string{"", "/export.json"} {
+		var state models.RoomState
+		if err := json.NewDecoder(get(path).Body).Decode(&state); err != nil {
+			t.Fatal(err)
+		}
+		if len(state.Strokes) != 1 || state.Strokes[0].ID != "s1" {
+			t.Errorf("%s: strokes %+v, want the in-memory stroke", path, state.Strokes)
+		}
+	}
+
+	var strokes []models.Stroke
+	if err := json.NewDecoder(get("/strokes").Body).Decode(&strokes); err != nil {
+		t.Fatal(err)
+	}
+	if len(strokes) != 1 {
+		t.Errorf("/strokes: %d strokes, want 1", len(strokes))
+	}
+
+	var summary models.RoomSummary
+	if err := json.NewDecoder(get("/summary").Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.StrokeCount != 1 {
+		t.Errorf("/summary: stroke count %d, want 1", summary.StrokeCount)
+	}
+
+	if body := get("/replay").Body.String(); !strings.Contains(body, `"id":"s1"`) {
+		t.Errorf("/replay did not stream the in-memory stroke: %s", body)
+	}
+
+	// An empty room renders as a 100x100 canvas; the stroke is wider
+	img, err := png.DecodeConfig(get("/export.png").Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width <= 300 {
+		t.Errorf("/export.png is %d wide, want the stroke's bounds", img.Width)
+	}
+
+	svg := get("/export.svg")
+	if ct := svg.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("/export.svg content type %q", ct)
+	}
+	if body := svg.Body.String(); strings.Count(body, "<path ") != 1 {
+		t.Errorf("/export.svg did not draw the in-memory stroke: %s", body)
+	}
+}
+
+func TestFunNameGeneratorReplays(t *testing.T) {
+	a := NewFunNameGenerator(rand.New(rand.NewSource(42)))
+	b := NewFunNameGenerator(rand.New(rand.NewSource(42)))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		name := a.Generate()
+		if other := b.Generate(); other != name {
+			t.Fatalf("name %d: %q and %q from the same seed", i, name, other)
+		}
+		adj, noun, ok := strings.Cut(name, " ")
+		if !ok || !slices.Contains(nameAdjectives, adj) || !slices.Contains(nameNouns, noun) {
+			t.Errorf("name %q is not an adjective and a noun", name)
+		}
+		seen[name] = true
+	}
+	if len(seen) < 10 {
+		t.Errorf("only %d distinct names in 20 draws", len(seen))
+	}
+}
+
+// fixedName is a NameGenerator that always returns itself
+type fixedName string
+
+func (n fixedName) Generate() string { return string(n) }
+
+func TestCreateRoomGeneratedTitle(t *testing.T) {
+	pool := dbtest.Pool(t)
+	handler := CreateRoom(pool, fixedName("Quiet River"))
+
+	for _, body := range []string{`{}`, `{"title":""}`, `not json`} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%s: status %d", body, rec.Code)
+		}
+		var room models.Room
+		if err := json.NewDecoder(rec.Body).Decode(&room); err != nil {
+			t.Fatal(err)
+		}
+		if room.Title != "Quiet River" {
+			t.Errorf("%s: title %q, want the generated name", body, room.Title)
+		}
+	}
+}
+
+func TestRoomExists(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}", RoomExists(pool)).Methods("HEAD")
+
+	room, err := models.CreateRoom(ctx, pool, "", "Here", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := models.CreateRoom(ctx, pool, "", "Gone", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DeleteRoom(ctx, pool, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]int{room.ID: http.StatusOK, deleted.ID: http.StatusNotFound, "no-such-room": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/rooms/"+id, nil))
+		if rec.Code != want {
+			t.Errorf("HEAD %s: status %d, want %d", id, rec.Code, want)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("HEAD %s: %d byte body, want none", id, rec.Body.Len())
+		}
+	}
+}
+
+func TestCreateRoomInvalidDefaults(t *testing.T) {
+	for _, body := range []string{
+		`{"defaults":{"tool":"crayon"}}`,
+		`{"defaults":{"color":"red"}}`,
+		`{"defaults":{"width":-2}}`,
+	} {
+		rec := httptest.NewRecorder()
+		CreateRoom(nil, fixedName("Room"))(rec, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestCreateRoomIdempotencyKey(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "bad key")
+	CreateRoom(nil, fixedName("Room"))(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid key: status %d, want 400", rec.Code)
+	}
+
+	pool := dbtest.Pool(t)
+	create := func(key string) (int, models.Room) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(`{"title":"Retry me"}`))
+		req.Header.Set("Idempotency-Key", key)
+		CreateRoom(pool, fixedName("Room"))(rec, req)
+		var room models.Room
+		json.NewDecoder(rec.Body).Decode(&room)
+		return rec.Code, room
+	}
+
+	code, first := create("retry-key-0001")
+	if code != http.StatusCreated {
+		t.Fatalf("first request: status %d", code)
+	}
+	code, retried := create("retry-key-0001")
+	if code != http.StatusOK || retried.ID != first.ID {
+		t.Errorf("retry: status %d, room %q; want 200 with %q", code, retried.ID, first.ID)
+	}
+	if code, other := create("retry-key-0002"); code != http.StatusCreated || other.ID == first.ID {
+		t.Errorf("new key: status %d, room %q; want a new room", code, other.ID)
+	}
+}
+
+func TestCreateRoomInvalidID(t *testing.T) {
+	for _, id := range []string{"has space", "slash/id", strings.Repeat("a", 37)} {
+		rec := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"id":%q}`, id)
+		CreateRoom(nil, fixedName("Room"))(rec, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", id, rec.Code)
+		}
+	}
+}
+
+func TestCreateRoomID(t *testing.T) {
+	pool := dbtest.Pool(t)
+	create := func(body string) (int, models.Room) {
+		rec := httptest.NewRecorder()
+		CreateRoom(pool, fixedName("Room"))(rec, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(body)))
+		var room models.Room
+		json.NewDecoder(rec.Body).Decode(&room)
+		return rec.Code, room
+	}
+
+	code, generated := create(`{"title":"Generated"}`)
+	if code != http.StatusCreated || generated.ID == "" {
+		t.Errorf("no id: status %d, room %q; want 201 with a generated ID", code, generated.ID)
+	}
+
+	slug := fmt.Sprintf("team-standup-%d", rand.Int())
+	code, explicit := create(fmt.Sprintf(`{"id":%q}`, slug))
+	if code != http.StatusCreated || explicit.ID != slug {
+		t.Errorf("explicit id: status %d, room %q; want 201 with %q", code, explicit.ID, slug)
+	}
+
+	if code, _ := create(fmt.Sprintf(`{"id":%q}`, slug)); code != http.StatusConflict {
+		t.Errorf("duplicate id: status %d, want 409", code)
+	}
+}
+
+func TestGetRoomParticipants(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	room, err := models.CreateRoom(ctx, pool, "", "Lobby", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}/participants", GetRoomParticipants(h)).Methods("GET")
+	list := func() []hub.Participant {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/"+room.ID+"/participants", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+		var participants []hub.Participant
+		if err := json.NewDecoder(rec.Body).Decode(&participants); err != nil {
+			t.Fatal(err)
+		}
+		return participants
+	}
+
+	// An empty room lists nobody, as an array rather than null
+	if got := list(); got == nil || len(got) != 0 {
+		t.Errorf("empty room: %v, want []", got)
+	}
+
+	for _, name := range []string{"Ada", "Grace"} {
+		h.Register <- &hub.Client{ID: name, Name: name, RoomID: room.ID, Hub: h, Send: make(chan []byte, 64)}
+	}
+	for len(h.GetRoomParticipants(room.ID)) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	names := map[string]bool{}
+	for _, p := range list() {
+		names[p.Name] = true
+	}
+	if !names["Ada"] || !names["Grace"] || len(names) != 2 {
+		t.Errorf("participants %v, want Ada and Grace", names)
+	}
+}
+
+func TestSearchRoomsInvalidQuery(t *testing.T) {
+	for _, q := range []string{"", "q=", "q=%20%20", "q=" + strings.Repeat("a", 256)} {
+		rec := httptest.NewRecorder()
+		SearchRooms(nil)(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/search?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%.20q: status %d, want 400", q, rec.Code)
+		}
+	}
+}
+
+func TestGetRoomStrokesSince(t *testing.T) {
+	rec := httptest.NewRecorder()
+	GetRoomStrokes(hub.NewHub(nil))(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/r/strokes?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status %d, want 400", rec.Code)
+	}
+
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	room, err := models.CreateRoom(ctx, pool, "", "Polling", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		stroke := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: float64(i), Y: 0}}}
+		if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	stored, err := models.GetStrokesByRoom(ctx, pool, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reordering changes stacking, not the oldest-first listing
+	if err := models.ReorderStrokes(ctx, pool, room.ID, []string{stored[2].ID, stored[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/rooms/{id}/strokes", GetRoomStrokes(h)).Methods("GET")
+	list := func(query string) []string {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/"+room.ID+"/strokes"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", query, rec.Code)
+		}
+		var strokes []models.Stroke
+		if err := json.NewDecoder(rec.Body).Decode(&strokes); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, s := range strokes {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	all := []string{stored[0].ID, stored[1].ID, stored[2].ID}
+	if got := list(""); !slices.Equal(got, all) {
+		t.Errorf("unfiltered: %v, want %v", got, all)
+	}
+	// since is exclusive
+	since := url.QueryEscape(stored[1].CreatedAt.Format(time.RFC3339Nano))
+	if got := list("?since=" + since); !slices.Equal(got, all[2:]) {
+		t.Errorf("since the second stroke: %v, want %v", got, all[2:])
+	}
+}
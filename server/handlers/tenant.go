@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+type tenantKey struct{}
+
+// Tenant modes for TenantMiddleware
+const (
+	TenantModeNone   = ""       // single tenant; every room is visible
+	TenantModeHeader = "header" // X-Tenant header, or ?tenant= for WebSocket clients
+	TenantModeOrigin = "origin" // host of the Origin header
+)
+
+// TenantMiddleware resolves the request's tenant according to mode and stores
+// it in the request context for TenantFrom
+func TenantMiddleware(mode string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var tenant string
+			switch mode {
+			case TenantModeHeader:
+				tenant = r.Header.Get("X-Tenant")
+				if tenant == "" {
+					tenant = r.URL.Query().Get("tenant")
+				}
+			case TenantModeOrigin:
+				if origin, err := url.Parse(r.Header.Get("Origin")); err == nil {
+					tenant = origin.Host
+				}
+			}
+
+			if len(tenant) > 255 {
+				http.Error(w, "Invalid tenant", http.StatusBadRequest)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+		})
+	}
+}
+
+// TenantFrom returns the tenant resolved for the request ("" when single-tenant)
+func TenantFrom(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantKey{}).(string)
+	return tenant
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		mode   string
+		url    string
+		header http.Header
+		want   string
+	}{
+		{TenantModeNone, "/", http.Header{"X-Tenant": {"acme"}}, ""},
+		{TenantModeHeader, "/", http.Header{"X-Tenant": {"acme"}}, "acme"},
+		{TenantModeHeader, "/?tenant=acme", nil, "acme"},
+		{TenantModeHeader, "/?tenant=other", http.Header{"X-Tenant": {"acme"}}, "acme"},
+		{TenantModeOrigin, "/", http.Header{"Origin": {"https://acme.example.com"}}, "acme.example.com"},
+		{TenantModeOrigin, "/", http.Header{"X-Tenant": {"acme"}}, ""},
+	}
+	for _, tt := range tests {
+		var got string
+		handler := TenantMiddleware(tt.mode)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = TenantFrom(r)
+		}))
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		req.Header = tt.header
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("mode %q, %s %v: tenant %q, want %q", tt.mode, tt.url, tt.header, got, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant", strings.Repeat("a", 256))
+	TenantMiddleware(TenantModeHeader)(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("overlong tenant: status %d, want 400", rec.Code)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(TenantMiddleware(TenantModeHeader))
+	router.HandleFunc("/api/rooms", ListRooms(pool)).Methods("GET")
+	router.HandleFunc("/api/rooms/search", SearchRooms(pool)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}", GetRoom(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}", RoomExists(pool)).Methods("HEAD")
+	router.HandleFunc("/api/rooms/{id}", RequireOwner(pool, RenameRoom(h))).Methods("PUT")
+	router.HandleFunc("/api/rooms/{id}", RequireOwner(pool, DeleteRoom(h))).Methods("DELETE")
+	router.HandleFunc("/api/rooms/{id}/summary", GetRoomSummary(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/strokes", GetRoomStrokes(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/elements/{type}/{elementId}", GetElement(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/export.json", ExportJSON(h)).Methods("GET")
+	router.HandleFunc("/api/rooms/{id}/clear", RequireOwner(pool, ClearRoom(h))).Methods("POST")
+	router.HandleFunc("/api/rooms/{id}/images", UploadImage(h, store, 1<<20)).Methods("POST")
+
+	room, err := models.CreateRoom(ctx, pool, "", "Acme plans", models.RoomOptions{Tenant: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stroke := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}}}
+	if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(tenant, method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("X-Tenant", tenant)
+		req.Header.Set("X-Owner-Token", room.OwnerToken)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	base := "/api/rooms/" + room.ID
+	reads := []string{base, base + "/summary", base + "/strokes", base + "/export.json", base + "/elements/stroke/" + stroke.ID}
+	for _, url := range reads {
+		if rec := serve("acme", "GET", url, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s by its tenant: status %d, want 200", url, rec.Code)
+		}
+		if rec := serve("globex", "GET", url, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s by another tenant: status %d, want 404", url, rec.Code)
+		}
+	}
+	if rec := serve("globex", "HEAD", base, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD by another tenant: status %d, want 404", rec.Code)
+	}
+
+	var list ListRoomsResponse
+	json.NewDecoder(serve("globex", "GET", "/api/rooms", "").Body).Decode(&list)
+	if list.Total != 0 || len(list.Rooms) != 0 {
+		t.Errorf("another tenant lists %d rooms, want none", list.Total)
+	}
+	var found []models.Room
+	json.NewDecoder(serve("globex", "GET", "/api/rooms/search?q=Acme", "").Body).Decode(&found)
+	if len(found) != 0 {
+		t.Errorf("another tenant's search found %d rooms, want none", len(found))
+	}
+
+	// Writes from another tenant are refused even with the owner token
+	writes := []struct{ method, url, body string }{
+		{"PUT", base, `{"title":"Hijacked"}`},
+		{"POST", base + "/clear", ""},
+		{"DELETE", base, ""},
+	}
+	for _, w := range writes {
+		if rec := serve("globex", w.method, w.url, w.body); rec.Code < 400 {
+			t.Errorf("%s %s by another tenant: status %d, want refused", w.method, w.url, rec.Code)
+		}
+	}
+	if rec := serve("globex", "POST", base+"/images", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("image upload by another tenant: status %d, want 404", rec.Code)
+	}
+
+	state, err := models.GetRoomState(ctx, pool, "acme", room.ID)
+	if err != nil {
+		t.Fatalf("room gone after another tenant's writes: %v", err)
+	}
+	if state.Room.Title != "Acme plans" || len(state.Strokes) != 1 {
+		t.Errorf("room changed by another tenant: title %q, %d strokes", state.Room.Title, len(state.Strokes))
+	}
+}
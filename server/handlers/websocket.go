@@ -1,27 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for development
-		// In production, check against allowed origins
-		return true
-	},
-}
+// WebSocketHandler handles WebSocket connections. Browsers may only connect
+// from allowedOrigins; "*" allows any origin and is meant for development.
+func WebSocketHandler(h *hub.Hub, allowedOrigins []string) http.HandlerFunc {
+	upgrader := newUpgrader(h, allowedOrigins)
 
-// WebSocketHandler handles WebSocket connections
-func WebSocketHandler(h *hub.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		roomID := vars["roomId"]
@@ -31,20 +30,121 @@ func WebSocketHandler(h *hub.Hub) http.HandlerFunc {
 			return
 		}
 
+		// Rooms belonging to another tenant are invisible; unknown rooms are
+		// only created on connect when asked with ?create=true
+		tenant := TenantFrom(r)
+		owner, found, err := models.GetRoomTenant(r.Context(), h.DB, roomID)
+		if err != nil {
+			http.Error(w, "Failed to look up room", http.StatusInternalServerError)
+			return
+		}
+		createdRoom := false
+		if !found && r.URL.Query().Get("create") == "true" {
+			if !models.IsValidRoomID(roomID) {
+				http.Error(w, "Invalid room ID", http.StatusBadRequest)
+				return
+			}
+			_, err := models.CreateRoom(r.Context(), h.DB, roomID, "Untitled", models.RoomOptions{Tenant: tenant})
+			if errors.Is(err, models.ErrRoomExists) {
+				// Created concurrently, possibly by another tenant
+				owner, found, err = models.GetRoomTenant(r.Context(), h.DB, roomID)
+			} else if err == nil {
+				owner, found, createdRoom = tenant, true, true
+			}
+			if err != nil {
+				http.Error(w, "Failed to create room", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !found || owner != tenant {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		room, err := models.GetRoom(r.Context(), h.DB, tenant, roomID)
+		if err != nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if !createdRoom && !checkRoomPassword(w, r, h.DB, roomID) {
+			return
+		}
+
+		// Owners may rename, clear and lock content; a wrong token just connects
+		// as a participant
+		isOwner := createdRoom
+		if token := r.URL.Query().Get("ownerToken"); token != "" && !isOwner {
+			err := models.VerifyRoomOwner(r.Context(), h.DB, tenant, roomID, token)
+			if err != nil && !errors.Is(err, models.ErrNotOwner) {
+				http.Error(w, "Failed to verify owner", http.StatusInternalServerError)
+				return
+			}
+			isOwner = err == nil
+		}
+
+		codec, err := hub.ParseCodec(r.URL.Query().Get("codec"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Negotiate the protocol version offered in Sec-WebSocket-Protocol
+		protocol, subprotocol, protocolErr := hub.NegotiateProtocol(websocket.Subprotocols(r))
+		var responseHeader http.Header
+		if subprotocol != "" {
+			responseHeader = http.Header{"Sec-Websocket-Protocol": {subprotocol}}
+		}
+
 		// Upgrade to WebSocket
-		conn, err := upgrader.Upgrade(w, r, nil)
+		conn, err := upgrader.Upgrade(w, r, responseHeader)
 		if err != nil {
 			log.Printf("WebSocket upgrade failed: %v", err)
 			return
 		}
 
-		// Create client
+		// Reject unsupported versions with a close frame the client can read
+		if protocolErr != nil {
+			log.Printf("[%s] Rejected WebSocket client: %v", RequestIDFrom(r), protocolErr)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseProtocolError, protocolErr.Error()),
+				time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+
+		// Create client (a requested color is honored by the hub if free,
+		// and clients without a name are given a guest name)
 		client := &hub.Client{
-			ID:     uuid.New().String(),
-			RoomID: roomID,
-			Hub:    h,
-			Conn:   conn,
-			Send:   make(chan []byte, 256),
+			ID:        uuid.New().String(),
+			RequestID: RequestIDFrom(r),
+			RoomID:    roomID,
+			Tenant:    tenant,
+			Name:      hub.SanitizeName(r.URL.Query().Get("name")),
+			Color:     r.URL.Query().Get("color"),
+			Hub:       h,
+			Conn:      conn,
+			Send:      make(chan []byte, h.SendBufferSize),
+			Include:   hub.ParseInclude(r.URL.Query().Get("include")),
+			ReadOnly:  r.URL.Query().Get("mode") == "view",
+			Owner:     isOwner,
+			Ephemeral: room.Ephemeral,
+			Gzip:      r.URL.Query().Get("compress") == "gzip",
+			Codec:     codec,
+
+			CreatedRoom:     createdRoom,
+			ProtocolVersion: protocol,
+		}
+		if user, ok := UserFrom(r); ok {
+			client.UserID = user.ID
+			if name := hub.SanitizeName(user.Name); name != "" {
+				client.Name = name
+			}
+		}
+		client.Simplify = h.SimplifyStrokes
+		if simplify, err := strconv.ParseBool(r.URL.Query().Get("simplify")); err == nil {
+			client.Simplify = simplify
+		}
+		if since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since")); err == nil {
+			client.Since = &since
 		}
 
 		// Register client with hub
@@ -55,3 +155,36 @@ func WebSocketHandler(h *hub.Hub) http.HandlerFunc {
 		go client.ReadPump()
 	}
 }
+
+// newUpgrader builds the upgrader for the hub's buffer and compression
+// settings
+func newUpgrader(h *hub.Hub, allowedOrigins []string) *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:    h.ReadBufferSize,
+		WriteBufferSize:   h.WriteBufferSize,
+		EnableCompression: h.Compression,
+		CheckOrigin:       checkOrigin(allowedOrigins),
+	}
+	if h.WriteBufferPool {
+		upgrader.WriteBufferPool = &sync.Pool{}
+	}
+	return upgrader
+}
+
+// checkOrigin builds an upgrader CheckOrigin that accepts requests without
+// an Origin header (non-browser clients) and those from an allowed origin
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowedOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		log.Printf("Rejected WebSocket connection from origin %s", origin)
+		return false
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := []string{"https://draw.example.com", "http://localhost:5173"}
+	tests := []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{allowed, "https://draw.example.com", true},
+		{allowed, "HTTPS://Draw.Example.com", true},
+		{allowed, "http://localhost:5173", true},
+		{allowed, "https://evil.example.com", false},
+		{allowed, "https://draw.example.com.evil.com", false},
+		{allowed, "", true}, // non-browser clients send no Origin
+		{nil, "https://draw.example.com", false},
+		{[]string{"*"}, "https://anything.example", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws/room", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(tt.allowed)(r); got != tt.want {
+			t.Errorf("checkOrigin(%v) for %q = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestWebSocketUnknownRoom(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/{roomId}", WebSocketHandler(h, []string{"*"}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/"
+
+	// Unknown rooms are refused before the upgrade
+	missing := fmt.Sprintf("missing-%d", rand.Int())
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+missing, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("connect to a missing room: %v, want 404", err)
+	}
+	if _, err := models.GetRoom(ctx, pool, "", missing); err == nil {
+		t.Error("refused connection created the room")
+	}
+	if _, resp, _ := websocket.DefaultDialer.Dial(wsURL+"bad%20id?create=true", nil); resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Error("create with an invalid room ID was not refused with 400")
+	}
+
+	// ?create=true makes the room first
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+missing+"?create=true", nil)
+	if err != nil {
+		t.Fatalf("create on connect: %v", err)
+	}
+	defer conn.Close()
+	for {
+		var msg hub.ServerMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "connected" {
+			break
+		}
+	}
+	if _, err := models.GetRoom(ctx, pool, "", missing); err != nil {
+		t.Errorf("room not created on connect: %v", err)
+	}
+}
+
+func TestRoomStateIsNew(t *testing.T) {
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/{roomId}", WebSocketHandler(h, []string{"*"}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/"
+
+	roomState := func(query string) *models.RoomState {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg hub.ServerMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == "room_state" {
+				if msg.RoomState == nil {
+					t.Fatalf("room_state without a state: %+v", msg)
+				}
+				return msg.RoomState
+			}
+		}
+	}
+
+	roomID := fmt.Sprintf("fresh-%d", rand.Int())
+	created := roomState(roomID + "?create=true")
+	if !created.IsNew {
+		t.Error("room_state for the connection that created the room not marked isNew")
+	}
+	if created.Room.ID != roomID || created.Room.CreatedAt.IsZero() || created.Room.UpdatedAt.IsZero() {
+		t.Errorf("new room %q created %v, updated %v; want real timestamps", created.Room.ID, created.Room.CreatedAt, created.Room.UpdatedAt)
+	}
+
+	// Later connections, with or without create, load an existing room
+	for _, query := range []string{roomID, roomID + "?create=true"} {
+		state := roomState(query)
+		if state.IsNew {
+			t.Errorf("%s: existing room marked isNew", query)
+		}
+		if !state.Room.CreatedAt.Equal(created.Room.CreatedAt) {
+			t.Errorf("%s: created %v, want %v", query, state.Room.CreatedAt, created.Room.CreatedAt)
+		}
+	}
+}
+
+func TestWebSocketSubprotocol(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := hub.NewHub(pool)
+	go h.Run()
+
+	room, err := models.CreateRoom(ctx, pool, "", "Versioned", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/{roomId}", WebSocketHandler(h, []string{"*"}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/" + room.ID
+
+	dial := func(offered ...string) *websocket.Conn {
+		t.Helper()
+		dialer := websocket.Dialer{Subprotocols: offered}
+		conn, _, err := dialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("dial offering %v: %v", offered, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	// A supported version is accepted, and no offer means the current one
+	current := hub.Subprotocol(hub.ProtocolVersion)
+	for offered, want := range map[string]string{current: current, "": ""} {
+		var conn *websocket.Conn
+		if offered == "" {
+			conn = dial()
+		} else {
+			conn = dial("bethel.v0", offered)
+		}
+		if conn.Subprotocol() != want {
+			t.Errorf("offering %q: accepted subprotocol %q, want %q", offered, conn.Subprotocol(), want)
+		}
+		for {
+			var msg hub.ServerMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("offering %q: %v", offered, err)
+			}
+			if msg.Type == "connected" {
+				break
+			}
+		}
+	}
+
+	// Only unsupported versions get a clean protocol error close
+	conn := dial("bethel.v999")
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseProtocolError || !strings.Contains(closeErr.Text, current) {
+		t.Errorf("unsupported version ended with %v, want close 1002 naming %s", err, current)
+	}
+}
+
+func TestUpgraderBuffers(t *testing.T) {
+	h := hub.NewHub(nil)
+	if u := newUpgrader(h, nil); u.ReadBufferSize != 4096 || u.WriteBufferSize != 4096 || u.WriteBufferPool != nil {
+		t.Errorf("default upgrader: read %d, write %d, pool %v; want 4096, 4096 and no pool", u.ReadBufferSize, u.WriteBufferSize, u.WriteBufferPool)
+	}
+
+	h.ReadBufferSize = 8192
+	h.WriteBufferSize = 16384
+	h.WriteBufferPool = true
+	h.Compression = true
+	u := newUpgrader(h, nil)
+	if u.ReadBufferSize != 8192 || u.WriteBufferSize != 16384 || u.WriteBufferPool == nil || !u.EnableCompression {
+		t.Errorf("configured upgrader: read %d, write %d, pool %v, compression %v", u.ReadBufferSize, u.WriteBufferSize, u.WriteBufferPool, u.EnableCompression)
+	}
+}
@@ -0,0 +1,55 @@
+package hub
+
+import "sync/atomic"
+
+// pendingAck tracks the outcome of a mutating message sent with a clientSeq
+type pendingAck struct {
+	seq int64
+
+	// Server-assigned ID of an element the message created
+	id string
+
+	// First error reported to the client while handling the message
+	failure atomic.Pointer[string]
+}
+
+// beginAck starts tracking a message's outcome if the client asked for an
+// acknowledgement. Messages are handled one at a time from ReadPump, so at
+// most one is pending per client.
+func (c *Client) beginAck(msg *ClientMessage) bool {
+	if msg.ClientSeq == nil || !isMutating(msg.Type) {
+		return false
+	}
+	c.ack.Store(&pendingAck{seq: *msg.ClientSeq})
+	return true
+}
+
+// setAckID records the ID the server gave the element a message created
+func (c *Client) setAckID(id string) {
+	if p := c.ack.Load(); p != nil {
+		p.id = id
+	}
+}
+
+// noteFailure marks the pending message, if any, as failed with errMsg
+func (c *Client) noteFailure(errMsg string) {
+	if p := c.ack.Load(); p != nil {
+		p.failure.CompareAndSwap(nil, &errMsg)
+	}
+}
+
+// finishAck replies to the pending message with an ack, or a nack carrying
+// the error if handling it failed
+func (h *Hub) finishAck(client *Client) {
+	p := client.ack.Swap(nil)
+	if p == nil {
+		return
+	}
+
+	seq := p.seq
+	if errMsg := p.failure.Load(); errMsg != nil {
+		h.sendToClient(client, &ServerMessage{Type: "nack", ClientSeq: &seq, Error: *errMsg})
+		return
+	}
+	h.sendToClient(client, &ServerMessage{Type: "ack", ClientSeq: &seq, ID: p.id})
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// roomActivity is a room's engagement since its last flush
+type roomActivity struct {
+	peak       int
+	lastActive time.Time
+}
+
+// recordJoin raises the room's peak to its current participant count.
+// Callers hold RoomsMu.
+func (h *Hub) recordJoin(roomID string, count int) {
+	h.activityMu.Lock()
+	defer h.activityMu.Unlock()
+
+	a := h.activityFor(roomID)
+	a.peak = max(a.peak, count)
+}
+
+// recordActivity notes a message received in the room
+func (h *Hub) recordActivity(roomID string) {
+	h.activityMu.Lock()
+	defer h.activityMu.Unlock()
+
+	h.activityFor(roomID).lastActive = time.Now()
+}
+
+// activityFor returns the room's activity entry, creating it if needed.
+// Callers hold activityMu.
+func (h *Hub) activityFor(roomID string) *roomActivity {
+	a := h.roomActivity[roomID]
+	if a == nil {
+		a = &roomActivity{}
+		h.roomActivity[roomID] = a
+	}
+	return a
+}
+
+// persistActivity writes room activity to the database every
+// ActivityFlushInterval
+func (h *Hub) persistActivity() {
+	ticker := time.NewTicker(h.ActivityFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.FlushActivity()
+	}
+}
+
+// FlushActivity writes the activity recorded since the last flush. Peaks
+// restart from each active room's current participant count, so a peak
+// stored in the database is only ever raised by later flushes.
+func (h *Hub) FlushActivity() {
+	h.RoomsMu.RLock()
+	h.activityMu.Lock()
+	pending := h.roomActivity
+	h.roomActivity = make(map[string]*roomActivity, len(h.Rooms))
+	for roomID, clients := range h.Rooms {
+		h.roomActivity[roomID] = &roomActivity{peak: len(clients)}
+	}
+	h.activityMu.Unlock()
+	h.RoomsMu.RUnlock()
+
+	for roomID, a := range pending {
+		var lastActive *time.Time
+		if !a.lastActive.IsZero() {
+			lastActive = &a.lastActive
+		}
+		if err := models.RecordRoomActivity(context.Background(), h.DB, roomID, a.peak, lastActive); err != nil {
+			log.Printf("Failed to record activity for room %s: %v", roomID, err)
+		}
+	}
+}
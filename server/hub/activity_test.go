@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRoomActivityPeak(t *testing.T) {
+	// Leaving and flushing write to a pool that fails
+	h := NewHub(unreachablePool(t))
+
+	peak := func() int {
+		h.activityMu.Lock()
+		defer h.activityMu.Unlock()
+		return h.activityFor("room").peak
+	}
+
+	clients := make([]*Client, 3)
+	for i := range clients {
+		clients[i] = newTestClient(h, fmt.Sprintf("c%d", i), "room")
+		join(t, h, clients[i])
+	}
+	if got := peak(); got != 3 {
+		t.Errorf("peak = %d with 3 connected, want 3", got)
+	}
+
+	// The peak holds as people leave and isn't raised by rejoining up to it
+	h.unregisterClient(clients[0])
+	h.unregisterClient(clients[1])
+	join(t, h, newTestClient(h, "c3", "room"))
+	if got := peak(); got != 3 {
+		t.Errorf("peak = %d after leaving and rejoining, want 3", got)
+	}
+
+	// Flushing starts the next period from who is still here
+	h.FlushActivity()
+	if got := peak(); got != 2 {
+		t.Errorf("peak = %d after a flush with 2 connected, want 2", got)
+	}
+}
+
+func TestRoomActivityLastActive(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	joinEphemeral(t, h, "room", a)
+
+	lastActive := func() time.Time {
+		h.activityMu.Lock()
+		defer h.activityMu.Unlock()
+		return h.activityFor("room").lastActive
+	}
+	if !lastActive().IsZero() {
+		t.Error("joining counted as activity")
+	}
+
+	var previous time.Time
+	for i := range 3 {
+		time.Sleep(time.Millisecond)
+		h.HandleMessage(a, &ClientMessage{Type: "cursor_move", X: float64(i), Y: 1})
+		got := lastActive()
+		if !got.After(previous) {
+			t.Errorf("message %d: last active %v, want after %v", i, got, previous)
+		}
+		previous = got
+	}
+}
@@ -0,0 +1,26 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// broadcastChecksums sends every active room a state_checksum each
+// ChecksumInterval, so clients applying incremental updates can compare it
+// with their own copy and resync on a mismatch
+func (h *Hub) broadcastChecksums() {
+	ticker := time.NewTicker(h.ChecksumInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, roomID := range h.ActiveRoomIDs() {
+			sum, err := h.roomChecksum(context.Background(), roomID)
+			if err != nil {
+				log.Printf("Failed to compute checksum for room %s: %v", roomID, err)
+				continue
+			}
+			h.broadcastToRoom(roomID, &ServerMessage{Type: "state_checksum", Checksum: sum}, nil)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestEphemeralRoomChecksum(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	joinEphemeral(t, h, "room", a)
+	state := h.ephemeralRooms["room"].state
+
+	before, err := h.roomChecksum(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := liveContent(state).Checksum; before != want {
+		t.Errorf("roomChecksum = %s, room_state checksum %s", before, want)
+	}
+
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_add", Stroke: &models.Stroke{
+		Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}},
+	}})
+	created := receiveType(t, a, "stroke_created")
+	added, _ := h.roomChecksum(context.Background(), "room")
+	if added == before {
+		t.Error("checksum unchanged by a new stroke")
+	}
+
+	// Soft-deleted strokes kept for undo don't count
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_delete", StrokeID: created.StrokeID})
+	if deleted, _ := h.roomChecksum(context.Background(), "room"); deleted != before {
+		t.Errorf("checksum after deleting the new stroke = %s, want %s again", deleted, before)
+	}
+}
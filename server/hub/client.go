@@ -1,36 +1,128 @@
 package hub
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
+	"github.com/dre4success/bethel/server/models"
 	"github.com/gorilla/websocket"
 )
 
 const (
 	// Time allowed to write a message to the peer
 	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period (must be less than pongWait)
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer
-	maxMessageSize = 512 * 1024 // 512KB
 )
 
 // Client represents a single WebSocket connection
 type Client struct {
 	ID     string
 	RoomID string
+	Tenant string
 	Color  string
 	Name   string
 	Hub    *Hub
 	Conn   *websocket.Conn
 	Send   chan []byte
+
+	// Authenticated user behind the connection ("" for anonymous clients)
+	UserID string
+
+	// Correlation ID of the upgrade request, included in this connection's logs
+	RequestID string
+
+	// Viewers receive everything but may not change the room
+	ReadOnly bool
+
+	// The room's content lives only in memory (see ephemeral.go)
+	Ephemeral bool
+
+	// Connected with the room's owner token (?ownerToken=), or created the
+	// room; only owners may rename or clear the room and lock elements
+	// (see ownerMessageTypes)
+	Owner bool
+
+	// Element kinds the client wants to receive ("strokes", "text", "shapes",
+	// "images", "cursors"); nil means everything
+	Include map[string]bool
+
+	// Send room_state and room_delta gzipped in binary frames (?compress=gzip)
+	Gzip bool
+
+	// Message encoding, CodecJSON or CodecMsgPack (?codec=)
+	Codec string
+
+	// Message protocol version negotiated through Sec-WebSocket-Protocol
+	ProtocolVersion int
+
+	// Simplify the client's strokes before storing them (?simplify=)
+	Simplify bool
+
+	// Last sync time the client reconnected with (?since=); when set the
+	// initial sync is a room_delta instead of the full room_state
+	Since *time.Time
+
+	// The room was created for this connection (?create=true); its
+	// room_state is marked isNew
+	CreatedRoom bool
+
+	// Number behind an assigned "Guest N" name (0 if the client named itself)
+	guestNumber int
+
+	// When the client joined its room
+	joinedAt time.Time
+
+	// In-progress strokes by pointer ID, so multitouch strokes stay
+	// independent (touched from ReadPump only)
+	openStrokes map[int]*openStroke
+
+	// Per-participant undo/redo history (touched from ReadPump only)
+	undoStack []operation
+	redoStack []operation
+
+	// Coalesces outgoing cursor_move broadcasts
+	cursor cursorThrottle
+
+	// Idle/away status
+	activity idleTracker
+
+	// Text blocks the client is editing, for typing indicators
+	editing textEditing
+
+	// Consecutive messages dropped on a full Send buffer, and whether the
+	// client is being disconnected for it
+	sendDrops atomic.Int32
+	evicting  atomic.Bool
+
+	// Inbound message rate limiting (touched from ReadPump only)
+	limiter *tokenBucket
+	dropped int
+
+	// Cancelled when the client leaves, aborting its in-flight queries
+	ctx     context.Context
+	cancel  context.CancelFunc
+	ctxOnce sync.Once
+
+	// Message awaiting an ack or nack (see ack.go)
+	ack atomic.Pointer[pendingAck]
+
+	// Rooms followed besides RoomID (see subscribe.go); guarded by the
+	// hub's RoomsMu
+	subscriptions map[string]bool
+
+	// Server-assigned IDs of the client's strokes, by the client's own IDs
+	strokeAliases strokeAliases
+}
+
+// openStroke is a client's most recent stroke on one pointer
+type openStroke struct {
+	stroke *models.Stroke
+	at     time.Time
 }
 
 // Participant represents client info for broadcast
@@ -38,6 +130,102 @@ type Participant struct {
 	ID    string `json:"id"`
 	Color string `json:"color"`
 	Name  string `json:"name,omitempty"`
+
+	// Authenticated user ID; absent for anonymous participants
+	UserID string `json:"userId,omitempty"`
+
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// No messages from the participant for the hub's IdleTimeout
+	Idle bool `json:"idle,omitempty"`
+}
+
+// Element kinds clients can filter on
+const (
+	KindStrokes = "strokes"
+	KindText    = "text"
+	KindShapes  = "shapes"
+	KindImages  = "images"
+	KindCursors = "cursors"
+)
+
+// ParseInclude parses a comma-separated list of element kinds, as passed in
+// the include query parameter. An empty list means all kinds.
+func ParseInclude(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+
+	include := make(map[string]bool)
+	for _, kind := range strings.Split(list, ",") {
+		include[strings.TrimSpace(kind)] = true
+	}
+	return include
+}
+
+// MaxNameLength is the longest display name kept, in characters
+const MaxNameLength = 40
+
+// SanitizeName cleans a client-supplied display name: control characters
+// are dropped, whitespace is collapsed and the result is capped at
+// MaxNameLength characters. An empty result means no name was given.
+func SanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+
+	if runes := []rune(name); len(runes) > MaxNameLength {
+		name = strings.TrimSpace(string(runes[:MaxNameLength]))
+	}
+	return name
+}
+
+// Wants reports whether the client should receive content of the given kind
+func (c *Client) Wants(kind string) bool {
+	return c.Include == nil || kind == "" || c.Include[kind]
+}
+
+// Context returns the client's context, cancelled once it leaves its room
+func (c *Client) Context() context.Context {
+	c.ctxOnce.Do(func() {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	})
+	return c.ctx
+}
+
+// cancelContext aborts whatever the client still has in flight
+func (c *Client) cancelContext() {
+	c.Context()
+	c.cancel()
+}
+
+// author is the identity content is attributed to: the authenticated user
+// when there is one, otherwise the connection
+func (c *Client) author() string {
+	if c.UserID != "" {
+		return c.UserID
+	}
+	return c.ID
+}
+
+// filterRoomState leaves out content the client asked not to receive
+func (c *Client) filterRoomState(roomState *models.RoomState) {
+	if !c.Wants(KindStrokes) {
+		roomState.Strokes = []models.Stroke{}
+	}
+	if !c.Wants(KindText) {
+		roomState.TextBlocks = []models.TextBlock{}
+	}
+	if !c.Wants(KindShapes) {
+		roomState.Shapes = []models.Shape{}
+	}
+	if !c.Wants(KindImages) {
+		roomState.Images = []models.Image{}
+	}
 }
 
 // ToParticipant converts client to participant info
@@ -46,6 +234,11 @@ func (c *Client) ToParticipant() Participant {
 		ID:    c.ID,
 		Color: c.Color,
 		Name:  c.Name,
+
+		UserID: c.UserID,
+
+		ReadOnly: c.ReadOnly,
+		Idle:     c.activity.idle.Load(),
 	}
 }
 
@@ -56,39 +249,58 @@ func (c *Client) ReadPump() {
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetReadLimit(c.Hub.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(c.Hub.PongTimeout))
 	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.Conn.SetReadDeadline(time.Now().Add(c.Hub.PongTimeout))
 		return nil
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		frameType, message, err := c.Conn.ReadMessage()
+
+		// Turned away by the hub (room full or too many rooms open); the
+		// connection is closed once the error has been written
+		if c.Context().Err() != nil {
+			break
+		}
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error (Client %s): %v", c.ID, err)
+				log.Printf("[%s] WebSocket error (Client %s): %v", c.RequestID, c.ID, err)
 			} else {
-                // Log normal closures too for debugging
-                log.Printf("WebSocket closed (Client %s): %v", c.ID, err)
-            }
+				// Log normal closures too for debugging
+				log.Printf("[%s] WebSocket closed (Client %s): %v", c.RequestID, c.ID, err)
+			}
 			break
 		}
 
+		// Drop messages over the rate limit; sustained floods disconnect
+		if drop, disconnect := c.throttle(); disconnect {
+			log.Printf("Client %s exceeded the message rate limit, disconnecting", c.ID)
+			break
+		} else if drop {
+			continue
+		}
+
 		// Parse and handle the message
 		var msg ClientMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("Failed to parse message: %v", err)
+		if err := c.decodeClientMessage(frameType == websocket.BinaryMessage, message, &msg); err != nil {
+			log.Printf("[%s] Failed to parse message: %v", c.RequestID, err)
 			continue
 		}
 
+		// Cursor moves are too frequent to log individually
+		if msg.Type != "cursor_move" {
+			log.Printf("[%s] Client %s sent %s", c.RequestID, c.ID, msg.Type)
+		}
+
 		c.Hub.HandleMessage(c, &msg)
 	}
 }
 
 // WritePump pumps messages from the hub to the WebSocket connection
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.Hub.PingInterval)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
@@ -104,7 +316,20 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
+			// Gzipped snapshots and MessagePack go out as binary frames
+			frameType := websocket.TextMessage
+			gzipped := bytes.HasPrefix(message, gzipMagic)
+			if gzipped || c.Codec == CodecMsgPack {
+				frameType = websocket.BinaryMessage
+			}
+
+			// Compressing small (or already compressed) messages costs
+			// more CPU than it saves
+			if c.Hub.Compression {
+				c.Conn.EnableWriteCompression(!gzipped && len(message) >= c.Hub.CompressionThreshold)
+			}
+
+			w, err := c.Conn.NextWriter(frameType)
 			if err != nil {
 				return
 			}
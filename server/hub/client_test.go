@@ -0,0 +1,282 @@
+package hub
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingConn counts the bytes read off the wire
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// compressedPair connects a client with permessage-deflate negotiated and
+// returns the server's end, the client's end and a count of the bytes the
+// client has received
+func compressedPair(tb testing.TB) (*websocket.Conn, *websocket.Conn, *atomic.Int64) {
+	tb.Helper()
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			tb.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	tb.Cleanup(server.Close)
+
+	read := new(atomic.Int64)
+	dialer := websocket.Dialer{
+		EnableCompression: true,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			return countingConn{Conn: conn, read: read}, err
+		},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return <-accepted, conn, read
+}
+
+// startWritePump runs WritePump for a client writing to conn
+func startWritePump(h *Hub, conn *websocket.Conn) *Client {
+	client := &Client{Hub: h, Conn: conn, Send: make(chan []byte, 256)}
+	go client.WritePump()
+	return client
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	h := NewHub(nil)
+	h.Compression = true
+	h.CompressionThreshold = 1024
+
+	server, conn, read := compressedPair(t)
+	client := startWritePump(h, server)
+	defer close(client.Send)
+
+	// Both messages compress well; only the large one is worth it
+	for _, size := range []int{512, 4096} {
+		before := read.Load()
+		client.Send <- []byte(`"` + strings.Repeat("a", size) + `"`)
+		if _, _, err := conn.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		wire := read.Load() - before
+		if compressed := wire < int64(size); compressed != (size >= h.CompressionThreshold) {
+			t.Errorf("%d byte message took %d bytes on the wire", size, wire)
+		}
+	}
+}
+
+// BenchmarkCursorWrites sends cursor_move messages, which are far below the
+// default threshold, with and without compressing them
+func BenchmarkCursorWrites(b *testing.B) {
+	cursor, err := json.Marshal(&ServerMessage{
+		Type: "cursor_move", ParticipantID: "3f1c2a7e", ParticipantName: "Guest 1", X: 412.5, Y: 187.25, Color: "#e6194b",
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, threshold := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("threshold=%d", threshold), func(b *testing.B) {
+			h := NewHub(nil)
+			h.Compression = true
+			h.CompressionThreshold = threshold
+			server, conn, read := compressedPair(b)
+			client := startWritePump(h, server)
+			defer close(client.Send)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < b.N; i++ {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := read.Load()
+			for i := 0; i < b.N; i++ {
+				client.Send <- cursor
+			}
+			<-done
+			b.StopTimer()
+			b.ReportMetric(float64(read.Load()-start)/float64(b.N), "wire-B/op")
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Ada", "Ada"},
+		{"  Ada \t Lovelace \n", "Ada Lovelace"},
+		{"Ada\x00\x1bLovelace", "Ada Lovelace"},
+		{"\n\t ", ""},
+		{strings.Repeat("é", MaxNameLength+5), strings.Repeat("é", MaxNameLength)},
+		{strings.Repeat("a", MaxNameLength-1) + " b", strings.Repeat("a", MaxNameLength-1)},
+	}
+	for _, tt := range tests {
+		if got := SanitizeName(tt.name); got != tt.want {
+			t.Errorf("SanitizeName(%.20q) = %.20q, want %.20q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	h := NewHub(nil)
+	h.MaxMessageSize = 1024
+	server, conn, _ := compressedPair(t)
+	client := &Client{ID: "big", Hub: h, Conn: server, Send: make(chan []byte, 1)}
+	go client.ReadPump()
+
+	// Random padding, so permessage-deflate can't squeeze it under the limit
+	padding := make([]byte, 4096)
+	rand.Read(padding)
+	huge := fmt.Sprintf(`{"type":"cursor_move","padding":"%x"}`, padding)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(huge)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-h.Unregister:
+		if got != client {
+			t.Error("a different client was unregistered")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("oversized message did not disconnect the client")
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("client saw %v, want close 1009", err)
+	}
+}
+
+// pumpClient runs both pumps for a client on the server end of conn
+func pumpClient(h *Hub, conn *websocket.Conn) *Client {
+	client := &Client{ID: "pumped", Hub: h, Conn: conn, Send: make(chan []byte, 1)}
+	go client.WritePump()
+	go client.ReadPump()
+	return client
+}
+
+func TestUnansweredPingsDisconnect(t *testing.T) {
+	h := NewHub(nil)
+	h.PingInterval = 20 * time.Millisecond
+	h.PongTimeout = 100 * time.Millisecond
+	server, _, _ := compressedPair(t)
+
+	// The peer never reads, so it never answers the pings
+	start := time.Now()
+	client := pumpClient(h, server)
+
+	select {
+	case got := <-h.Unregister:
+		if got != client {
+			t.Error("a different client was unregistered")
+		}
+		if waited := time.Since(start); waited < h.PongTimeout {
+			t.Errorf("disconnected after %v, before the pong timeout", waited)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("silent peer was never disconnected")
+	}
+}
+
+func TestAnsweredPingsKeepConnection(t *testing.T) {
+	h := NewHub(nil)
+	h.PingInterval = 20 * time.Millisecond
+	h.PongTimeout = 100 * time.Millisecond
+	server, conn, _ := compressedPair(t)
+
+	// Reading lets the peer's default ping handler answer
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	pumpClient(h, server)
+
+	select {
+	case <-h.Unregister:
+		t.Fatal("responsive peer was disconnected")
+	case <-time.After(5 * h.PongTimeout):
+	}
+}
+
+func TestMessagesLoggedWithRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	h := NewHub(nil)
+	server, conn, _ := compressedPair(t)
+	client := &Client{ID: "c1", RequestID: "trace-1234", Hub: h, Conn: server, Send: make(chan []byte, 1)}
+	go client.ReadPump()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resync"}`)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	<-h.Unregister
+
+	if !strings.Contains(logs.String(), "[trace-1234] Client c1 sent resync") {
+		t.Errorf("message not logged under the connection's request ID: %s", logs.String())
+	}
+}
+
+func TestCloseRoom(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	go h.Run()
+
+	server, conn, _ := compressedPair(t)
+	client := &Client{ID: "c1", RoomID: "room", Hub: h, Conn: server, Send: make(chan []byte, 64)}
+	join(t, h, client)
+	bystander := newTestClient(h, "other", "elsewhere")
+	join(t, h, bystander)
+
+	if n := h.CloseRoom("room", "Room deleted"); n != 1 {
+		t.Errorf("closed %d clients, want 1", n)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) || !strings.Contains(err.Error(), "Room deleted") {
+		t.Errorf("peer saw %v, want close 1001 with the reason", err)
+	}
+	for len(h.GetRoomParticipants("room")) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if len(h.GetRoomParticipants("elsewhere")) != 1 {
+		t.Error("client in another room was closed")
+	}
+}
@@ -0,0 +1,106 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Wire encodings a client can pick with ?codec=. JSON goes in text frames;
+// MessagePack is more compact for point-heavy stroke traffic and goes in
+// binary frames. Both carry the same fields under the same names.
+const (
+	CodecJSON    = "json"
+	CodecMsgPack = "msgpack"
+)
+
+// ParseCodec validates a ?codec= value; empty means CodecJSON
+func ParseCodec(codec string) (string, error) {
+	switch codec {
+	case "", CodecJSON:
+		return CodecJSON, nil
+	case CodecMsgPack:
+		return CodecMsgPack, nil
+	}
+	return "", fmt.Errorf("unknown codec %q, expected %s or %s", codec, CodecJSON, CodecMsgPack)
+}
+
+// encodedMessage is a server message marshalled to JSON, converted to
+// MessagePack the first time a client wants it, so a broadcast is encoded
+// at most once per codec
+type encodedMessage struct {
+	json    []byte
+	msgpack []byte
+}
+
+// newEncodedMessage marshals msg for sending to one or more clients
+func newEncodedMessage(msg *ServerMessage) (*encodedMessage, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &encodedMessage{json: data}, nil
+}
+
+// forClient returns the message in the client's codec
+func (m *encodedMessage) forClient(client *Client) ([]byte, error) {
+	if client.Codec != CodecMsgPack {
+		return m.json, nil
+	}
+	if m.msgpack == nil {
+		packed, err := jsonToMsgPack(m.json)
+		if err != nil {
+			return nil, err
+		}
+		m.msgpack = packed
+	}
+	return m.msgpack, nil
+}
+
+// marshal encodes a server message in the client's codec
+func (c *Client) marshal(msg *ServerMessage) ([]byte, error) {
+	m, err := newEncodedMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return m.forClient(c)
+}
+
+// decodeClientMessage parses a client message. Binary frames from
+// MessagePack clients are MessagePack; everything else is JSON.
+func (c *Client) decodeClientMessage(binary bool, data []byte, msg *ClientMessage) error {
+	if binary && c.Codec == CodecMsgPack {
+		var err error
+		if data, err = msgPackToJSON(data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, msg)
+}
+
+// jsonToMsgPack re-encodes a JSON document as MessagePack, keeping whole
+// numbers as integers
+func jsonToMsgPack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return msgp.AppendIntf(nil, v)
+}
+
+// msgPackToJSON re-encodes a MessagePack document as JSON
+func msgPackToJSON(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	rest, err := msgp.UnmarshalAsJSON(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after MessagePack message", len(rest))
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/websocket"
+)
+
+func TestParseCodec(t *testing.T) {
+	for in, want := range map[string]string{"": CodecJSON, "json": CodecJSON, "msgpack": CodecMsgPack} {
+		if got, err := ParseCodec(in); err != nil || got != want {
+			t.Errorf("ParseCodec(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCodec("protobuf"); err == nil {
+		t.Error("ParseCodec accepted an unknown codec")
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	h := NewHub(nil)
+	jsonClient := newTestClient(h, "j", "room")
+	packClient := newTestClient(h, "p", "room")
+	packClient.Codec = CodecMsgPack
+
+	stroke := &models.Stroke{ID: "s1", Color: "#ff0000", Tool: "pen", Points: []models.Point{
+		{X: 1, Y: 2, Pressure: 0.5}, {X: 3.25, Y: -4, Pressure: 1},
+	}}
+	out := &ServerMessage{Type: "stroke_add", Stroke: stroke, ParticipantID: "j", Version: 3}
+
+	// Server messages decode to the same struct from either codec
+	decodeServer := func(client *Client) ServerMessage {
+		data, err := client.marshal(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.Codec == CodecMsgPack {
+			if data, err = msgPackToJSON(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var msg ServerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	fromJSON, fromPack := decodeServer(jsonClient), decodeServer(packClient)
+	if !reflect.DeepEqual(fromJSON, fromPack) {
+		t.Errorf("server message differs by codec:\njson    %+v\nmsgpack %+v", fromJSON, fromPack)
+	}
+	if !reflect.DeepEqual(fromPack.Stroke, stroke) {
+		t.Errorf("msgpack stroke = %+v, want %+v", fromPack.Stroke, stroke)
+	}
+
+	// And so do client messages
+	version := 2
+	in := &ClientMessage{Type: "stroke_update", StrokeID: "s1", Points: stroke.Points, Version: &version}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := jsonToMsgPack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) >= len(data) {
+		t.Errorf("msgpack is %d bytes, not smaller than JSON's %d", len(packed), len(data))
+	}
+	var viaJSON, viaPack ClientMessage
+	if err := jsonClient.decodeClientMessage(false, data, &viaJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := packClient.decodeClientMessage(true, packed, &viaPack); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(viaJSON, viaPack) || !reflect.DeepEqual(&viaPack, in) {
+		t.Errorf("client message differs by codec:\njson    %+v\nmsgpack %+v", viaJSON, viaPack)
+	}
+
+	// Text frames from a msgpack client are still JSON
+	var text ClientMessage
+	if err := packClient.decodeClientMessage(false, data, &text); err != nil || text.Type != "stroke_update" {
+		t.Errorf("JSON text frame from a msgpack client: %+v, %v", text, err)
+	}
+	if err := packClient.decodeClientMessage(true, append(packed, 0xc0), &text); err == nil {
+		t.Error("trailing bytes after a MessagePack message were accepted")
+	}
+}
+
+func TestMsgPackSentAsBinary(t *testing.T) {
+	h := NewHub(nil)
+	server, conn, _ := compressedPair(t)
+	client := &Client{Hub: h, Conn: server, Send: make(chan []byte, 256), Codec: CodecMsgPack}
+	go client.WritePump()
+	defer close(client.Send)
+
+	h.sendToClient(client, &ServerMessage{Type: "error", Error: "nope"})
+
+	frameType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frameType != websocket.BinaryMessage {
+		t.Errorf("msgpack message arrived as frame type %d, want binary", frameType)
+	}
+	decoded, err := msgPackToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg ServerMessage
+	if err := json.Unmarshal(decoded, &msg); err != nil || msg.Type != "error" || msg.Error != "nope" {
+		t.Errorf("decoded %+v (%v), want the error message", msg, err)
+	}
+}
@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// stalledPool returns a pool whose server accepts connections and never
+// answers, so every query blocks until its context ends
+func stalledPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var held []net.Conn
+		defer func() {
+			for _, conn := range held {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			held = append(held, conn)
+		}
+	}()
+
+	pool, err := pgxpool.New(context.Background(), "postgres://bethel:bethel@"+ln.Addr().String()+"/bethel?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestLeavingCancelsQueries(t *testing.T) {
+	h := NewHub(stalledPool(t))
+	client := newTestClient(h, "c1", "room")
+	join(t, h, client)
+	drain(client)
+
+	done := make(chan struct{})
+	go func() {
+		h.HandleMessage(client, &ClientMessage{Type: "stroke_delete", StrokeID: "s1"})
+		close(done)
+	}()
+
+	// The query is stuck until the client's context is cancelled
+	select {
+	case <-done:
+		t.Fatal("message handled against a database that never answers")
+	case <-time.After(100 * time.Millisecond):
+	}
+	client.cancelContext()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling the client's context did not abort its query")
+	}
+}
+
+func TestUnregisterCancelsContext(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	client := newTestClient(h, "c1", "room")
+	join(t, h, client)
+	ctx := client.Context()
+
+	h.unregisterClient(client)
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("context still live after the client left")
+	}
+
+	// Nothing more is queued for it
+	if h.trySend(client, []byte(`{"type":"ack"}`)) {
+		t.Error("message queued for a client that left")
+	}
+}
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// cursorThrottle coalesces a client's cursor moves so at most one is
+// broadcast per CursorInterval; the latest position always goes out
+type cursorThrottle struct {
+	mu       sync.Mutex
+	lastSent time.Time
+	pending  *ServerMessage
+	timer    *time.Timer
+}
+
+func (h *Hub) handleCursorMove(client *Client, msg *ClientMessage) {
+	// Broadcast cursor position to other clients (no persistence needed)
+	out := &ServerMessage{
+		Type:            "cursor_move",
+		X:               msg.X,
+		Y:               msg.Y,
+		Color:           client.Color,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}
+
+	if h.CursorInterval <= 0 {
+		h.broadcastToRoom(client.RoomID, out, client)
+		return
+	}
+
+	t := &client.cursor
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = out
+	if t.timer != nil {
+		// A trailing broadcast is already scheduled and will pick this up
+		return
+	}
+
+	wait := h.CursorInterval - time.Since(t.lastSent)
+	if wait <= 0 {
+		h.flushCursorLocked(client)
+		return
+	}
+	t.timer = time.AfterFunc(wait, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.timer = nil
+		h.flushCursorLocked(client)
+	})
+}
+
+// flushCursorLocked broadcasts the pending cursor position; the caller
+// holds client.cursor.mu
+func (h *Hub) flushCursorLocked(client *Client) {
+	t := &client.cursor
+	if t.pending == nil {
+		return
+	}
+	h.broadcastToRoom(client.RoomID, t.pending, client)
+	t.pending = nil
+	t.lastSent = time.Now()
+}
+
+// stopCursor drops any scheduled cursor broadcast so a departed client's
+// cursor doesn't reappear after participant_leave
+func (c *Client) stopCursor() {
+	c.cursor.mu.Lock()
+	defer c.cursor.mu.Unlock()
+	if c.cursor.timer != nil {
+		c.cursor.timer.Stop()
+		c.cursor.timer = nil
+	}
+	c.cursor.pending = nil
+}
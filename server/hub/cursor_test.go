@@ -0,0 +1,56 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorMoveCoalesced(t *testing.T) {
+	h := NewHub(nil)
+	h.CursorInterval = 100 * time.Millisecond
+	a := newTestClient(h, "a", "room")
+	a.Name = "Ada"
+	b := newTestClient(h, "b", "room")
+	join(t, h, a)
+	join(t, h, b)
+	drain(b)
+
+	for i := 1; i <= 10; i++ {
+		h.HandleMessage(a, &ClientMessage{Type: "cursor_move", X: float64(i), Y: float64(i)})
+	}
+
+	// The first move goes out at once and the rest collapse into one
+	// trailing broadcast of the latest position
+	first := receiveType(t, b, "cursor_move")
+	if first.X != 1 || first.ParticipantName != "Ada" || first.ParticipantID != "a" {
+		t.Errorf("first cursor_move %+v, want Ada's first position", first)
+	}
+	start := time.Now()
+	last := receiveType(t, b, "cursor_move")
+	if last.X != 10 || last.ParticipantName != "Ada" {
+		t.Errorf("trailing cursor_move %+v, want Ada's latest position", last)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("trailing broadcast after %v, want it held to the interval", waited)
+	}
+	expectNothing(t, b)
+}
+
+func TestCursorMoveUnthrottled(t *testing.T) {
+	h := NewHub(nil)
+	h.CursorInterval = 0
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	join(t, h, a)
+	join(t, h, b)
+	drain(b)
+
+	for i := 1; i <= 3; i++ {
+		h.HandleMessage(a, &ClientMessage{Type: "cursor_move", X: float64(i)})
+	}
+	for i := 1; i <= 3; i++ {
+		if msg := receiveType(t, b, "cursor_move"); msg.X != float64(i) {
+			t.Errorf("cursor_move %d at x=%v", i, msg.X)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// pendingPoints holds the latest unwritten points for a stroke
+type pendingPoints struct {
+	roomID string
+	points []models.Point
+	timer  *time.Timer
+}
+
+// queueStrokePoints coalesces point updates so each stroke is written at most
+// once per StrokeFlushInterval. final forces an immediate write (pen up).
+// The lock state is checked when the first update of a window arrives, so
+// the sender hears about it, and again by the write itself.
+func (h *Hub) queueStrokePoints(ctx context.Context, roomID, strokeID string, points []models.Point, final bool) error {
+	if h.StrokeFlushInterval <= 0 || final || h.isEphemeral(roomID) {
+		h.cancelPendingPoints(strokeID)
+		return h.updateStrokePoints(ctx, roomID, strokeID, points)
+	}
+
+	if h.replacePendingPoints(strokeID, points) {
+		return nil
+	}
+
+	locked, err := models.IsStrokeLocked(ctx, h.DB, roomID, strokeID)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return models.ErrLocked
+	}
+
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	if p, ok := h.pendingPoints[strokeID]; ok {
+		p.points = points
+		return nil
+	}
+	h.pendingPoints[strokeID] = &pendingPoints{
+		roomID: roomID,
+		points: points,
+		timer: time.AfterFunc(h.StrokeFlushInterval, func() {
+			h.flushStrokePoints(strokeID)
+		}),
+	}
+	return nil
+}
+
+// replacePendingPoints swaps in newer points if a write is already queued
+func (h *Hub) replacePendingPoints(strokeID string, points []models.Point) bool {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	p, ok := h.pendingPoints[strokeID]
+	if ok {
+		p.points = points
+	}
+	return ok
+}
+
+// cancelPendingPoints drops a queued write that is about to be superseded
+func (h *Hub) cancelPendingPoints(strokeID string) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	if p, ok := h.pendingPoints[strokeID]; ok {
+		p.timer.Stop()
+		delete(h.pendingPoints, strokeID)
+	}
+}
+
+// flushStrokePoints writes the queued points for a stroke. A stroke locked
+// since the points were queued keeps its locked points: the write only
+// touches unlocked strokes.
+func (h *Hub) flushStrokePoints(strokeID string) {
+	h.pendingMu.Lock()
+	p, ok := h.pendingPoints[strokeID]
+	delete(h.pendingPoints, strokeID)
+	h.pendingMu.Unlock()
+
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	err := models.UpdateStrokePoints(ctx, h.DB, p.roomID, strokeID, p.points)
+	if errors.Is(err, models.ErrLocked) {
+		log.Printf("Dropped queued points for stroke %s: locked", strokeID)
+		return
+	}
+	if err == nil {
+		err = models.UpdateRoomTimestamp(ctx, h.DB, p.roomID)
+	}
+	if err != nil {
+		log.Printf("Failed to flush stroke %s: %v", strokeID, err)
+	}
+}
+
+// flushRoomStrokes writes the room's queued point updates immediately
+func (h *Hub) flushRoomStrokes(roomID string) {
+	h.pendingMu.Lock()
+	var ids []string
+	for id, p := range h.pendingPoints {
+		if p.roomID == roomID {
+			p.timer.Stop()
+			ids = append(ids, id)
+		}
+	}
+	h.pendingMu.Unlock()
+
+	for _, id := range ids {
+		h.flushStrokePoints(id)
+	}
+}
+
+// FlushPendingStrokes writes every queued point update immediately
+func (h *Hub) FlushPendingStrokes() {
+	h.pendingMu.Lock()
+	ids := make([]string, 0, len(h.pendingPoints))
+	for id, p := range h.pendingPoints {
+		p.timer.Stop()
+		ids = append(ids, id)
+	}
+	h.pendingMu.Unlock()
+
+	for _, id := range ids {
+		h.flushStrokePoints(id)
+	}
+}
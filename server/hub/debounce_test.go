@@ -0,0 +1,185 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// countStrokeWrites installs a trigger counting updates to the strokes
+// table and returns a function reading the count
+func countStrokeWrites(t *testing.T, pool *pgxpool.Pool) func() int {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE stroke_writes (n INTEGER NOT NULL);
+		INSERT INTO stroke_writes VALUES (0);
+		CREATE FUNCTION count_stroke_write() RETURNS trigger AS $$
+		BEGIN
+			UPDATE stroke_writes SET n = n + 1;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER count_stroke_writes AFTER UPDATE ON strokes
+			FOR EACH ROW EXECUTE FUNCTION count_stroke_write();`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func() int {
+		var n int
+		if err := pool.QueryRow(ctx, `SELECT n FROM stroke_writes`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+}
+
+// newTestStroke creates a room holding a single one-point stroke
+func newTestStroke(t *testing.T, pool *pgxpool.Pool) *models.Stroke {
+	t.Helper()
+	ctx := context.Background()
+
+	room, err := models.CreateRoom(ctx, pool, "", "Strokes", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stroke := &models.Stroke{RoomID: room.ID, Points: []models.Point{{X: 0, Y: 0, Pressure: 0.5}}, Color: "#000000", Tool: "pen"}
+	if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+		t.Fatal(err)
+	}
+	return stroke
+}
+
+func TestQueueStrokePointsBatchesWrites(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	writes := countStrokeWrites(t, pool)
+	stroke := newTestStroke(t, pool)
+
+	h := NewHub(pool)
+	h.StrokeFlushInterval = time.Hour
+
+	points := stroke.Points
+	for i := 1; i <= 100; i++ {
+		points = append(points, models.Point{X: float64(i), Y: float64(i), Pressure: 0.5})
+		if err := h.queueStrokePoints(ctx, stroke.RoomID, stroke.ID, points, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := writes(); n != 0 {
+		t.Errorf("%d writes before the flush, want 0", n)
+	}
+
+	h.FlushPendingStrokes()
+	if n := writes(); n != 1 {
+		t.Errorf("100 updates took %d writes, want 1", n)
+	}
+
+	got, err := models.GetStroke(ctx, pool, stroke.RoomID, stroke.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Points) != len(points) {
+		t.Errorf("stored %d points, want %d", len(got.Points), len(points))
+	}
+}
+
+func TestQueueStrokePointsFinalWritesImmediately(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	writes := countStrokeWrites(t, pool)
+	stroke := newTestStroke(t, pool)
+
+	h := NewHub(pool)
+	h.StrokeFlushInterval = time.Hour
+
+	points := append(stroke.Points, models.Point{X: 1, Y: 1, Pressure: 0.5})
+	if err := h.queueStrokePoints(ctx, stroke.RoomID, stroke.ID, points, false); err != nil {
+		t.Fatal(err)
+	}
+	points = append(points, models.Point{X: 2, Y: 2, Pressure: 0.5})
+	if err := h.queueStrokePoints(ctx, stroke.RoomID, stroke.ID, points, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pen up replaces the queued write rather than adding to it
+	h.FlushPendingStrokes()
+	if n := writes(); n != 1 {
+		t.Errorf("got %d writes, want 1", n)
+	}
+}
+
+func TestFlushStrokePointsSkipsLockedStroke(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	stroke := newTestStroke(t, pool)
+
+	h := NewHub(pool)
+	h.StrokeFlushInterval = time.Hour
+
+	points := append(stroke.Points, models.Point{X: 1, Y: 1, Pressure: 0.5})
+	if err := h.queueStrokePoints(ctx, stroke.RoomID, stroke.ID, points, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetStrokeLocked(ctx, pool, stroke.RoomID, stroke.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	room, err := models.GetRoom(ctx, pool, "", stroke.RoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.FlushPendingStrokes()
+
+	got, err := models.GetStroke(ctx, pool, stroke.RoomID, stroke.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Points) != len(stroke.Points) {
+		t.Errorf("locked stroke has %d points, want %d", len(got.Points), len(stroke.Points))
+	}
+
+	// A dropped write leaves the room untouched
+	after, err := models.GetRoom(ctx, pool, "", stroke.RoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.UpdatedAt.Equal(room.UpdatedAt) {
+		t.Error("room timestamp bumped by a dropped write")
+	}
+}
+
+func TestFlushStrokePointsBumpsRoomTimestamp(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	stroke := newTestStroke(t, pool)
+
+	before, err := models.GetRoom(ctx, pool, "", stroke.RoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHub(pool)
+	h.StrokeFlushInterval = time.Hour
+
+	points := append(stroke.Points, models.Point{X: 1, Y: 1, Pressure: 0.5})
+	if err := h.queueStrokePoints(ctx, stroke.RoomID, stroke.ID, points, false); err != nil {
+		t.Fatal(err)
+	}
+	h.FlushPendingStrokes()
+
+	after, err := models.GetRoom(ctx, pool, "", stroke.RoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.UpdatedAt.After(before.UpdatedAt) {
+		t.Errorf("room updatedAt %v not bumped past %v", after.UpdatedAt, before.UpdatedAt)
+	}
+}
@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// recentStroke is a stroke_add the hub handled within StrokeDedupeWindow
+type recentStroke struct {
+	serverID    string
+	fingerprint uint64
+	at          time.Time
+}
+
+// strokeFingerprint hashes what a stroke_add draws, so a retried message
+// can be told apart from a different stroke reusing a client ID
+func strokeFingerprint(stroke *models.Stroke) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(stroke.Color))
+	hash.Write([]byte{0})
+	hash.Write([]byte(stroke.Tool))
+	var buf [8]byte
+	for _, p := range stroke.Points {
+		for _, v := range [...]float64{p.X, p.Y, p.Pressure} {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+			hash.Write(buf[:])
+		}
+	}
+	return hash.Sum64()
+}
+
+// recentStrokeKey scopes a client stroke ID to its room
+func recentStrokeKey(roomID, clientStrokeID string) string {
+	return roomID + "\x00" + clientStrokeID
+}
+
+// duplicateStroke returns the server ID of an identical stroke_add with the
+// same client stroke ID handled in the room within StrokeDedupeWindow
+func (h *Hub) duplicateStroke(roomID, clientStrokeID string, fingerprint uint64) (string, bool) {
+	if h.StrokeDedupeWindow <= 0 || clientStrokeID == "" {
+		return "", false
+	}
+
+	h.recentMu.Lock()
+	defer h.recentMu.Unlock()
+
+	recent, ok := h.recentStrokes[recentStrokeKey(roomID, clientStrokeID)]
+	if !ok || recent.fingerprint != fingerprint || time.Since(recent.at) > h.StrokeDedupeWindow {
+		return "", false
+	}
+	return recent.serverID, true
+}
+
+// rememberStroke records a stored stroke_add for duplicateStroke, dropping
+// entries that have outlived the window
+func (h *Hub) rememberStroke(roomID, clientStrokeID, serverID string, fingerprint uint64) {
+	if h.StrokeDedupeWindow <= 0 || clientStrokeID == "" {
+		return
+	}
+
+	h.recentMu.Lock()
+	defer h.recentMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.recentPruned) > h.StrokeDedupeWindow {
+		for key, recent := range h.recentStrokes {
+			if now.Sub(recent.at) > h.StrokeDedupeWindow {
+				delete(h.recentStrokes, key)
+			}
+		}
+		h.recentPruned = now
+	}
+	h.recentStrokes[recentStrokeKey(roomID, clientStrokeID)] = recentStroke{
+		serverID:    serverID,
+		fingerprint: fingerprint,
+		at:          now,
+	}
+}
@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestDuplicateStrokeAdd(t *testing.T) {
+	h := NewHub(nil)
+	h.StrokeDedupeWindow = 100 * time.Millisecond
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	add := func(x float64) string {
+		t.Helper()
+		h.HandleMessage(a, &ClientMessage{Type: "stroke_add", Stroke: &models.Stroke{
+			ID: "p1", Color: "#000000", Tool: "pen", Points: []models.Point{{X: x, Y: 1}},
+		}})
+		return receiveType(t, a, "stroke_created").StrokeID
+	}
+	stored := func() int {
+		return len(liveContent(h.ephemeralRooms["room"].state).Strokes)
+	}
+
+	// A retry is stored and broadcast once, and acknowledged with the same ID
+	first := add(1)
+	receiveType(t, b, "stroke_add")
+	if retry := add(1); retry != first {
+		t.Errorf("retry created %q, want the original %q", retry, first)
+	}
+	expectNothing(t, b)
+	if n := stored(); n != 2 {
+		t.Errorf("%d strokes after a retry, want s1 and one copy", n)
+	}
+
+	// The same client ID drawing something else is a new stroke
+	if other := add(2); other == first {
+		t.Error("different stroke reusing the client ID was treated as a retry")
+	}
+	receiveType(t, b, "stroke_add")
+
+	// So is a repeat once the window has passed
+	time.Sleep(2 * h.StrokeDedupeWindow)
+	if late := add(1); late == first {
+		t.Error("repeat after the dedupe window was treated as a retry")
+	}
+	receiveType(t, b, "stroke_add")
+	if n := stored(); n != 4 {
+		t.Errorf("%d strokes, want 4", n)
+	}
+}
+
+func TestDuplicateStrokeAddPerRoom(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	joinEphemeral(t, h, "room", a)
+	c := newTestClient(h, "c", "other")
+	joinEphemeral(t, h, "other", c)
+
+	// The same client stroke ID in another room is unrelated
+	stroke := func() *models.Stroke {
+		return &models.Stroke{ID: "p1", Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}}}
+	}
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_add", Stroke: stroke()})
+	h.HandleMessage(c, &ClientMessage{Type: "stroke_add", Stroke: stroke()})
+	if ids := strokeIDs(liveContent(h.ephemeralRooms["other"].state).Strokes); len(ids) != 2 {
+		t.Errorf("strokes in the other room = %v, want s1 and the new one", ids)
+	}
+}
@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// textEditing tracks which text blocks a client has said it is editing,
+// each with a timer that ends the editing state if no stop arrives
+type textEditing struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// handleTextEditing relays text_editing_start and text_editing_stop to the
+// room. Nothing is persisted; a start that isn't followed by another start
+// or a stop within TextEditingTimeout is stopped on the client's behalf.
+func (h *Hub) handleTextEditing(client *Client, msg *ClientMessage) {
+	if msg.TextBlockID == "" {
+		return
+	}
+	id := msg.TextBlockID
+
+	t := &client.editing
+	t.mu.Lock()
+	if timer, ok := t.timers[id]; ok {
+		timer.Stop()
+		delete(t.timers, id)
+	}
+	if msg.Type == "text_editing_start" && h.TextEditingTimeout > 0 {
+		if t.timers == nil {
+			t.timers = make(map[string]*time.Timer)
+		}
+		var timer *time.Timer
+		timer = time.AfterFunc(h.TextEditingTimeout, func() {
+			t.mu.Lock()
+			expired := t.timers[id] == timer
+			if expired {
+				delete(t.timers, id)
+			}
+			t.mu.Unlock()
+
+			if expired {
+				h.broadcastToRoom(client.RoomID, editingMessage(client, "text_editing_stop", id), client)
+			}
+		})
+		t.timers[id] = timer
+	}
+	t.mu.Unlock()
+
+	h.broadcastToRoom(client.RoomID, editingMessage(client, msg.Type, id), client)
+}
+
+// stopEditingUnsafe ends every editing state the client holds, announcing each
+// stop; the caller holds RoomsMu
+func (h *Hub) stopEditingUnsafe(client *Client) {
+	t := &client.editing
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.timers))
+	for id, timer := range t.timers {
+		timer.Stop()
+		ids = append(ids, id)
+	}
+	t.timers = nil
+	t.mu.Unlock()
+
+	for _, id := range ids {
+		h.broadcastToRoomUnsafe(client.RoomID, editingMessage(client, "text_editing_stop", id), client)
+	}
+}
+
+// editingMessage builds a text_editing_start or text_editing_stop event
+func editingMessage(client *Client, msgType, textBlockID string) *ServerMessage {
+	return &ServerMessage{
+		Type:            msgType,
+		TextBlockID:     textBlockID,
+		Color:           client.Color,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}
+}
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTextEditingStartStop(t *testing.T) {
+	h := NewHub(nil)
+	h.TextEditingTimeout = 200 * time.Millisecond
+	a := newTestClient(h, "a", "room")
+	a.Color = "#FF3B30"
+	a.Name = "Ada"
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	h.HandleMessage(a, &ClientMessage{Type: "text_editing_start", TextBlockID: "t1"})
+	start := receiveType(t, b, "text_editing_start")
+	if start.TextBlockID != "t1" || start.ParticipantID != "a" || start.ParticipantName != "Ada" || start.Color != "#FF3B30" {
+		t.Errorf("text_editing_start %+v, want t1 by Ada in her color", start)
+	}
+	expectNothing(t, a)
+
+	// An explicit stop is relayed and cancels the expiry
+	h.HandleMessage(a, &ClientMessage{Type: "text_editing_stop", TextBlockID: "t1"})
+	if stop := receiveType(t, b, "text_editing_stop"); stop.TextBlockID != "t1" || stop.ParticipantID != "a" {
+		t.Errorf("text_editing_stop %+v, want t1 by a", stop)
+	}
+	time.Sleep(2 * h.TextEditingTimeout)
+	expectNothing(t, b)
+
+	// Nothing is stored
+	if blocks := h.ephemeralRooms["room"].state.TextBlocks; len(blocks) != 0 {
+		t.Errorf("editing indicators stored %d text blocks", len(blocks))
+	}
+}
+
+func TestTextEditingExpires(t *testing.T) {
+	h := NewHub(nil)
+	h.TextEditingTimeout = 50 * time.Millisecond
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	h.HandleMessage(a, &ClientMessage{Type: "text_editing_start", TextBlockID: "t1"})
+	receiveType(t, b, "text_editing_start")
+
+	// Another start before the timeout extends it
+	time.Sleep(30 * time.Millisecond)
+	h.HandleMessage(a, &ClientMessage{Type: "text_editing_start", TextBlockID: "t1"})
+	receiveType(t, b, "text_editing_start")
+	renewed := time.Now()
+
+	stop := receiveType(t, b, "text_editing_stop")
+	if stop.TextBlockID != "t1" || stop.ParticipantID != "a" {
+		t.Errorf("text_editing_stop %+v, want t1 by a", stop)
+	}
+	if waited := time.Since(renewed); waited < 40*time.Millisecond {
+		t.Errorf("expired %v after the renewed start, before the timeout", waited)
+	}
+	expectNothing(t, b)
+}
+
+func TestTextEditingStoppedOnLeave(t *testing.T) {
+	// Leaving records the session, which needs a pool to fail against
+	h := NewHub(unreachablePool(t))
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	h.HandleMessage(a, &ClientMessage{Type: "text_editing_start", TextBlockID: "t1"})
+	receiveType(t, b, "text_editing_start")
+
+	h.unregisterClient(a)
+	if stop := receiveType(t, b, "text_editing_stop"); stop.TextBlockID != "t1" || stop.ParticipantID != "a" {
+		t.Errorf("text_editing_stop %+v, want t1 by a", stop)
+	}
+}
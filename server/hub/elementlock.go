@@ -0,0 +1,162 @@
+package hub
+
+import "fmt"
+
+// Element types that can be held with lock/unlock
+const (
+	ElementStroke = "stroke"
+	ElementText   = "text"
+)
+
+// elementKey identifies an element that can be held
+type elementKey struct {
+	kind string // ElementStroke or ElementText
+	id   string
+}
+
+// handleLock gives the client exclusive editing rights over an element
+// until it unlocks it or disconnects. Unlike lock_element nothing is
+// persisted and the holder itself may keep editing.
+func (h *Hub) handleLock(client *Client, msg *ClientMessage) {
+	if msg.ElementID == "" || (msg.ElementType != ElementStroke && msg.ElementType != ElementText) {
+		return
+	}
+	key := elementKey{kind: msg.ElementType, id: msg.ElementID}
+
+	h.locksMu.Lock()
+	holder := h.elementLocks[client.RoomID][key]
+	if holder == nil {
+		if h.elementLocks[client.RoomID] == nil {
+			h.elementLocks[client.RoomID] = make(map[elementKey]*Client)
+		}
+		h.elementLocks[client.RoomID][key] = client
+	}
+	h.locksMu.Unlock()
+
+	if holder == client {
+		return
+	}
+	if holder != nil {
+		h.sendError(client, fmt.Sprintf("Element is locked by %s", holder.Name))
+		return
+	}
+
+	h.broadcastToRoom(client.RoomID, lockMessage(client, "lock", key), client)
+}
+
+// handleUnlock releases an element the client holds
+func (h *Hub) handleUnlock(client *Client, msg *ClientMessage) {
+	key := elementKey{kind: msg.ElementType, id: msg.ElementID}
+
+	h.locksMu.Lock()
+	released := h.elementLocks[client.RoomID][key] == client
+	if released {
+		h.deleteLockLocked(client.RoomID, key)
+	}
+	h.locksMu.Unlock()
+
+	if released {
+		h.broadcastToRoom(client.RoomID, lockMessage(client, "unlock", key), client)
+	}
+}
+
+// releaseLocksUnsafe frees every element the client holds, announcing each
+// unlock; the caller holds RoomsMu
+func (h *Hub) releaseLocksUnsafe(client *Client) {
+	var released []elementKey
+	h.locksMu.Lock()
+	for key, holder := range h.elementLocks[client.RoomID] {
+		if holder == client {
+			released = append(released, key)
+			h.deleteLockLocked(client.RoomID, key)
+		}
+	}
+	h.locksMu.Unlock()
+
+	for _, key := range released {
+		h.broadcastToRoomUnsafe(client.RoomID, lockMessage(client, "unlock", key), client)
+	}
+}
+
+// deleteLockLocked removes a held element, dropping the room's entry once
+// it holds none; the caller holds locksMu
+func (h *Hub) deleteLockLocked(roomID string, key elementKey) {
+	delete(h.elementLocks[roomID], key)
+	if len(h.elementLocks[roomID]) == 0 {
+		delete(h.elementLocks, roomID)
+	}
+}
+
+// heldByOther reports whether someone other than client holds the element.
+// HTTP callers pass a nil client, so any holder counts.
+func (h *Hub) heldByOther(roomID string, client *Client, kind, id string) bool {
+	h.locksMu.Lock()
+	defer h.locksMu.Unlock()
+
+	holder := h.elementLocks[roomID][elementKey{kind: kind, id: id}]
+	return holder != nil && holder != client
+}
+
+// roomHeldByOther reports whether someone other than client (nil for HTTP
+// callers) holds any element in the room
+func (h *Hub) roomHeldByOther(roomID string, client *Client) bool {
+	h.locksMu.Lock()
+	defer h.locksMu.Unlock()
+
+	for _, holder := range h.elementLocks[roomID] {
+		if holder != client {
+			return true
+		}
+	}
+	return false
+}
+
+// lockTargets lists the elements a client message would modify
+func lockTargets(msg *ClientMessage) []elementKey {
+	switch msg.Type {
+	case "stroke_update", "stroke_delete", "undo_delete":
+		return []elementKey{{kind: ElementStroke, id: msg.StrokeID}}
+	case "stroke_reorder":
+		keys := make([]elementKey, len(msg.StrokeIDs))
+		for i, id := range msg.StrokeIDs {
+			keys[i] = elementKey{kind: ElementStroke, id: id}
+		}
+		return keys
+	case "text_update", "text_diff", "text_delete":
+		return []elementKey{{kind: ElementText, id: msg.TextBlockID}}
+	case "lock_element":
+		if msg.StrokeID != "" {
+			return []elementKey{{kind: ElementStroke, id: msg.StrokeID}}
+		}
+		return []elementKey{{kind: ElementText, id: msg.TextBlockID}}
+	}
+	return nil
+}
+
+// blockedByLock reports whether the message touches an element another
+// participant holds, telling the client if so
+func (h *Hub) blockedByLock(client *Client, msg *ClientMessage) bool {
+	for _, key := range lockTargets(msg) {
+		if key.id != "" && h.heldByOther(client.RoomID, client, key.kind, key.id) {
+			h.sendError(client, errHeldByOther)
+			return true
+		}
+	}
+	return false
+}
+
+// errHeldByOther is the error sent for changes to an element another
+// participant holds
+const errHeldByOther = "Element is locked by another participant"
+
+// lockMessage builds a lock or unlock event
+func lockMessage(client *Client, msgType string, key elementKey) *ServerMessage {
+	return &ServerMessage{
+		Type:            msgType,
+		ElementID:       key.id,
+		ElementType:     key.kind,
+		Color:           client.Color,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}
+}
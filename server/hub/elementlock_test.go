@@ -0,0 +1,112 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// holdStroke has client lock stroke id and drains the announcement
+func holdStroke(t *testing.T, h *Hub, client *Client, id string, others ...*Client) {
+	t.Helper()
+	h.HandleMessage(client, &ClientMessage{Type: "lock", ElementID: id, ElementType: ElementStroke})
+	for _, c := range others {
+		receiveType(t, c, "lock")
+	}
+}
+
+func expectError(t *testing.T, client *Client, want string) {
+	t.Helper()
+	if msg := receiveType(t, client, "error"); msg.Error != want {
+		t.Errorf("got error %q, want %q", msg.Error, want)
+	}
+}
+
+func TestHeldStrokeBlocksSecondClient(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+	holdStroke(t, h, b, "s1", a)
+
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_delete", StrokeID: "s1"})
+	expectError(t, a, errHeldByOther)
+
+	if err := h.DeleteStroke(context.Background(), "room", "s1"); !errors.Is(err, models.ErrLocked) {
+		t.Errorf("HTTP delete of a held stroke: got %v, want ErrLocked", err)
+	}
+
+	if ids := strokeIDs(liveContent(h.ephemeralRooms["room"].state).Strokes); len(ids) != 1 || ids[0] != "s1" {
+		t.Errorf("strokes = %v, want the held stroke kept", ids)
+	}
+	expectNothing(t, b)
+}
+
+func TestHeldStrokeBlocksUndo(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_add", Stroke: &models.Stroke{
+		ID: "local", Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}},
+	}})
+	id := receiveType(t, a, "stroke_created").StrokeID
+	receiveType(t, b, "stroke_add")
+	holdStroke(t, h, b, id, a)
+
+	h.HandleMessage(a, &ClientMessage{Type: "undo"})
+	expectError(t, a, errHeldByOther)
+
+	if ids := strokeIDs(liveContent(h.ephemeralRooms["room"].state).Strokes); len(ids) != 2 {
+		t.Errorf("strokes = %v, want undo of a held stroke refused", ids)
+	}
+	expectNothing(t, b)
+}
+
+func TestHeldStrokeBlocksPointerUpdate(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_add", PointerID: 1, Stroke: &models.Stroke{
+		Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}},
+	}})
+	id := receiveType(t, a, "stroke_created").StrokeID
+	receiveType(t, b, "stroke_add")
+	holdStroke(t, h, b, id, a)
+
+	// No strokeId: the update goes to the stroke open on pointer 1
+	h.HandleMessage(a, &ClientMessage{Type: "stroke_update", PointerID: 1, Final: true,
+		Points: []models.Point{{X: 2, Y: 2}}})
+	expectError(t, a, errHeldByOther)
+	expectNothing(t, b)
+}
+
+func TestHeldElementsBlockClear(t *testing.T) {
+	h := NewHub(nil)
+	owner := newTestClient(h, "owner", "room")
+	owner.Owner = true
+	guest := newTestClient(h, "guest", "room")
+	joinEphemeral(t, h, "room", owner, guest)
+	holdStroke(t, h, guest, "s1", owner)
+
+	h.HandleMessage(owner, &ClientMessage{Type: "clear_all"})
+	receiveType(t, owner, "error")
+
+	if err := h.ClearRoom(context.Background(), "room"); !errors.Is(err, models.ErrLocked) {
+		t.Errorf("HTTP clear with a held element: got %v, want ErrLocked", err)
+	}
+	if n := len(h.ephemeralRooms["room"].state.Strokes); n != 1 {
+		t.Errorf("clear with a held element left %d strokes, want 1", n)
+	}
+	expectNothing(t, guest)
+
+	// The holder's own elements don't stop it
+	guest.Owner = true
+	h.HandleMessage(guest, &ClientMessage{Type: "clear_all"})
+	receiveType(t, owner, "clear_all")
+}
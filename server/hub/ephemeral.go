@@ -0,0 +1,731 @@
+package hub
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Content operations below write to the in-memory state for ephemeral rooms
+// and fall through to the database for persisted rooms. Writes also bump the
+// room's updatedAt (in memory or in the database) so conditional clears can
+// detect newer content.
+
+// ephemeralRoom holds an ephemeral room's content. Which rooms are
+// ephemeral is guarded by RoomsMu; each room's content by its own mu, so
+// writes to one room don't hold up every other room.
+type ephemeralRoom struct {
+	mu    sync.Mutex
+	state *models.RoomState
+}
+
+// withEphemeral runs fn against the room's in-memory state if the room is
+// ephemeral. It reports whether fn ran. RoomsMu is only read-locked, which
+// keeps the room from being dropped while fn runs; fn must not take it.
+func (h *Hub) withEphemeral(roomID string, fn func(state *models.RoomState) error) (bool, error) {
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	room, ok := h.ephemeralRooms[roomID]
+	if !ok {
+		return false, nil
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return true, fn(room.state)
+}
+
+// changeEphemeral is withEphemeral for writes: a successful fn moves the
+// room's in-memory updatedAt forward, which conditional clears compare
+// against like the database's rooms.updated_at
+func (h *Hub) changeEphemeral(roomID string, fn func(state *models.RoomState) error) (bool, error) {
+	return h.withEphemeral(roomID, func(state *models.RoomState) error {
+		if err := fn(state); err != nil {
+			return err
+		}
+		state.Room.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// isEphemeral reports whether the room's content is held in memory
+func (h *Hub) isEphemeral(roomID string) bool {
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	_, ok := h.ephemeralRooms[roomID]
+	return ok
+}
+
+// newEphemeralRoom returns the empty content an ephemeral room starts
+// with when its first client joins
+func newEphemeralRoom() *ephemeralRoom {
+	return &ephemeralRoom{state: &models.RoomState{
+		Strokes:    []models.Stroke{},
+		TextBlocks: []models.TextBlock{},
+		Shapes:     []models.Shape{},
+		Images:     []models.Image{},
+	}}
+}
+
+// loadEphemeralState returns a snapshot of an ephemeral room's in-memory
+// content, with the room metadata from loaded. Rooms nobody is connected
+// to hold nothing in memory, so loaded is returned as is.
+func (h *Hub) loadEphemeralState(loaded *models.RoomState) *models.RoomState {
+	var snapshot *models.RoomState
+	h.withEphemeral(loaded.Room.ID, func(state *models.RoomState) error {
+		// Content changes only move the in-memory updatedAt
+		updatedAt := state.Room.UpdatedAt
+		state.Room = loaded.Room
+		if updatedAt.After(state.Room.UpdatedAt) {
+			state.Room.UpdatedAt = updatedAt
+		}
+		snapshot = liveContent(state)
+		return nil
+	})
+	if snapshot == nil {
+		return loaded
+	}
+	return snapshot
+}
+
+// ephemeralSnapshot returns a snapshot of an ephemeral room's in-memory
+// content and the metadata it was last loaded with, if the room is
+// ephemeral
+func (h *Hub) ephemeralSnapshot(roomID string) (*models.RoomState, bool) {
+	var snapshot *models.RoomState
+	handled, _ := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		snapshot = liveContent(state)
+		return nil
+	})
+	return snapshot, handled
+}
+
+// liveContent copies an ephemeral room's state for sending. Soft-deleted
+// strokes stay in memory for undo but are left out.
+func liveContent(state *models.RoomState) *models.RoomState {
+	strokes := []models.Stroke{}
+	for _, stroke := range state.Strokes {
+		if stroke.DeletedAt == nil {
+			strokes = append(strokes, stroke)
+		}
+	}
+
+	snapshot := &models.RoomState{
+		Room:       state.Room,
+		Strokes:    strokes,
+		TextBlocks: append([]models.TextBlock{}, state.TextBlocks...),
+		Shapes:     append([]models.Shape{}, state.Shapes...),
+		Images:     append([]models.Image{}, state.Images...),
+	}
+	snapshot.Checksum = snapshot.ComputeChecksum()
+	return snapshot
+}
+
+// RoomState returns a room's content for an HTTP caller, read from memory
+// for ephemeral rooms
+func (h *Hub) RoomState(ctx context.Context, tenant, roomID string) (*models.RoomState, error) {
+	h.flushRoomStrokes(roomID)
+	state, err := models.GetRoomState(ctx, h.DB, tenant, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return h.loadEphemeralState(state), nil
+}
+
+// RoomStrokes returns a room's live strokes for an HTTP caller, read from
+// memory for ephemeral rooms. A non-nil since limits them to strokes
+// created after it.
+func (h *Hub) RoomStrokes(ctx context.Context, roomID string, since *time.Time) ([]models.Stroke, error) {
+	var strokes []models.Stroke
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		strokes = []models.Stroke{}
+		for _, stroke := range state.Strokes {
+			if stroke.DeletedAt == nil && (since == nil || stroke.CreatedAt.After(*since)) {
+				strokes = append(strokes, stroke)
+			}
+		}
+		return nil
+	})
+	if handled {
+		return strokes, err
+	}
+
+	h.flushRoomStrokes(roomID)
+	if since != nil {
+		return models.GetStrokesCreatedSince(ctx, h.DB, roomID, *since)
+	}
+	return models.GetStrokesByRoom(ctx, h.DB, roomID)
+}
+
+// RoomSummary returns a room's metadata and content counts for an HTTP
+// caller, counting from memory for ephemeral rooms
+func (h *Hub) RoomSummary(ctx context.Context, tenant, roomID string) (*models.RoomSummary, error) {
+	summary, err := models.GetRoomSummary(ctx, h.DB, tenant, roomID)
+	if err != nil {
+		return nil, err
+	}
+	h.withEphemeral(roomID, func(state *models.RoomState) error {
+		summary.StrokeCount = 0
+		for _, stroke := range state.Strokes {
+			if stroke.DeletedAt == nil {
+				summary.StrokeCount++
+			}
+		}
+		summary.TextBlockCount = len(state.TextBlocks)
+		if state.Room.UpdatedAt.After(summary.UpdatedAt) {
+			summary.UpdatedAt = state.Room.UpdatedAt
+		}
+		return nil
+	})
+	return summary, nil
+}
+
+// roomChecksum returns the checksum of a room's current content
+func (h *Hub) roomChecksum(ctx context.Context, roomID string) (string, error) {
+	var sum string
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		live := models.RoomState{TextBlocks: state.TextBlocks, Shapes: state.Shapes, Images: state.Images}
+		for _, stroke := range state.Strokes {
+			if stroke.DeletedAt == nil {
+				live.Strokes = append(live.Strokes, stroke)
+			}
+		}
+		sum = live.ComputeChecksum()
+		return nil
+	})
+	if handled {
+		return sum, err
+	}
+	return models.GetRoomChecksum(ctx, h.DB, roomID)
+}
+
+func (h *Hub) createStroke(ctx context.Context, stroke *models.Stroke) error {
+	handled, err := h.changeEphemeral(stroke.RoomID, func(state *models.RoomState) error {
+		stroke.CreatedAt = time.Now()
+		stroke.UpdatedAt = stroke.CreatedAt
+		state.Strokes = append(state.Strokes, *stroke)
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.CreateStroke(ctx, h.DB, stroke); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, stroke.RoomID)
+}
+
+// createStrokes stores a batch of strokes, all or nothing
+func (h *Hub) createStrokes(ctx context.Context, roomID string, strokes []*models.Stroke) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		now := time.Now()
+		for i, stroke := range strokes {
+			stroke.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+			stroke.UpdatedAt = now
+			state.Strokes = append(state.Strokes, *stroke)
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.CreateStrokesBatch(ctx, h.DB, strokes); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) updateStrokePoints(ctx context.Context, roomID, strokeID string, points []models.Point) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Strokes {
+			if state.Strokes[i].ID == strokeID {
+				if state.Strokes[i].Locked {
+					return models.ErrLocked
+				}
+				state.Strokes[i].Points = points
+				state.Strokes[i].UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.UpdateStrokePoints(ctx, h.DB, roomID, strokeID, points); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) deleteStroke(ctx context.Context, roomID, strokeID string) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Strokes {
+			if state.Strokes[i].ID == strokeID && state.Strokes[i].DeletedAt == nil {
+				if state.Strokes[i].Locked {
+					return models.ErrLocked
+				}
+				now := time.Now()
+				state.Strokes[i].DeletedAt = &now
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.DeleteStroke(ctx, h.DB, roomID, strokeID); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) restoreStroke(ctx context.Context, roomID, strokeID string) (*models.Stroke, error) {
+	var restored *models.Stroke
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Strokes {
+			if state.Strokes[i].ID == strokeID && state.Strokes[i].DeletedAt != nil {
+				state.Strokes[i].DeletedAt = nil
+				state.Strokes[i].UpdatedAt = time.Now()
+				stroke := state.Strokes[i]
+				restored = &stroke
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	if handled {
+		return restored, err
+	}
+	stroke, err := models.RestoreStroke(ctx, h.DB, roomID, strokeID)
+	if err != nil {
+		return nil, err
+	}
+	return stroke, models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) reorderStrokes(ctx context.Context, roomID string, strokeIDs []string) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		// Slice positions stand in for seq: the strokes swap into the slots
+		// they already occupy, in the requested order
+		index := make(map[string]int, len(strokeIDs))
+		for i, id := range strokeIDs {
+			index[id] = i
+		}
+		var slots []int
+		for i, stroke := range state.Strokes {
+			if _, ok := index[stroke.ID]; ok && stroke.DeletedAt == nil {
+				if stroke.Locked {
+					return models.ErrLocked
+				}
+				slots = append(slots, i)
+			}
+		}
+		if len(slots) != len(strokeIDs) {
+			return pgx.ErrNoRows
+		}
+
+		reordered := make([]models.Stroke, len(slots))
+		for _, slot := range slots {
+			reordered[index[state.Strokes[slot].ID]] = state.Strokes[slot]
+		}
+		now := time.Now()
+		for i, slot := range slots {
+			state.Strokes[slot] = reordered[i]
+			state.Strokes[slot].UpdatedAt = now
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.ReorderStrokes(ctx, h.DB, roomID, strokeIDs); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) setStrokeLocked(ctx context.Context, roomID, strokeID string, locked bool) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Strokes {
+			if state.Strokes[i].ID == strokeID {
+				state.Strokes[i].Locked = locked
+				state.Strokes[i].UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	return models.SetStrokeLocked(ctx, h.DB, roomID, strokeID, locked)
+}
+
+// getStroke returns a live stroke, or pgx.ErrNoRows if the room has none
+// with that ID
+func (h *Hub) getStroke(ctx context.Context, roomID, strokeID string) (*models.Stroke, error) {
+	var found *models.Stroke
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Strokes {
+			if state.Strokes[i].ID == strokeID && state.Strokes[i].DeletedAt == nil {
+				stroke := state.Strokes[i]
+				found = &stroke
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	if handled {
+		return found, err
+	}
+	return models.GetStroke(ctx, h.DB, roomID, strokeID)
+}
+
+// getStrokes returns the room's live strokes, bottom to top
+func (h *Hub) getStrokes(ctx context.Context, roomID string) ([]models.Stroke, error) {
+	var strokes []models.Stroke
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		for _, stroke := range state.Strokes {
+			if stroke.DeletedAt == nil {
+				strokes = append(strokes, stroke)
+			}
+		}
+		return nil
+	})
+	if handled {
+		return strokes, err
+	}
+	// Queued point writes would otherwise be missing from what's read back
+	h.FlushPendingStrokes()
+	return models.GetStrokesByRoom(ctx, h.DB, roomID)
+}
+
+// getStrokesInRegion returns the room's live strokes whose bounds overlap
+// the region
+func (h *Hub) getStrokesInRegion(ctx context.Context, roomID string, r models.Region) ([]models.Stroke, error) {
+	var strokes []models.Stroke
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		for _, stroke := range state.Strokes {
+			if b, ok := models.StrokeBounds(stroke.Points); ok && stroke.DeletedAt == nil && b.Intersects(r) {
+				strokes = append(strokes, stroke)
+			}
+		}
+		return nil
+	})
+	if handled {
+		return strokes, err
+	}
+	h.FlushPendingStrokes()
+	return models.GetStrokesInRegion(ctx, h.DB, roomID, r)
+}
+
+func (h *Hub) createTextBlock(ctx context.Context, tb *models.TextBlock) error {
+	handled, err := h.changeEphemeral(tb.RoomID, func(state *models.RoomState) error {
+		tb.CreatedAt = time.Now()
+		tb.UpdatedAt = tb.CreatedAt
+		tb.Version = 1
+		state.TextBlocks = append(state.TextBlocks, *tb)
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.CreateTextBlock(ctx, h.DB, tb); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, tb.RoomID)
+}
+
+func (h *Hub) updateTextBlock(ctx context.Context, roomID, id string, updates *models.TextBlockUpdate, editorID string, expectedVersion *int) (int, error) {
+	var version int
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.TextBlocks {
+			if state.TextBlocks[i].ID == id {
+				if state.TextBlocks[i].Locked {
+					return models.ErrLocked
+				}
+				if expectedVersion != nil && state.TextBlocks[i].Version != *expectedVersion {
+					return models.ErrStaleVersion
+				}
+				updates.Apply(&state.TextBlocks[i])
+				state.TextBlocks[i].UpdatedAt = time.Now()
+				state.TextBlocks[i].UpdatedBy = editorID
+				state.TextBlocks[i].Version++
+				version = state.TextBlocks[i].Version
+			}
+		}
+		return nil
+	})
+	if handled {
+		return version, err
+	}
+	version, err = models.UpdateTextBlock(ctx, h.DB, roomID, id, updates, editorID, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+	return version, models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) getTextBlock(ctx context.Context, roomID, id string) (*models.TextBlock, error) {
+	var found *models.TextBlock
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.TextBlocks {
+			if state.TextBlocks[i].ID == id {
+				tb := state.TextBlocks[i]
+				found = &tb
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	if handled {
+		return found, err
+	}
+	return models.GetTextBlock(ctx, h.DB, roomID, id)
+}
+
+func (h *Hub) applyTextDiff(ctx context.Context, roomID, id string, diff *models.TextDiff, editorID string) (int, error) {
+	var version int
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.TextBlocks {
+			if state.TextBlocks[i].ID == id {
+				if state.TextBlocks[i].Locked {
+					return models.ErrLocked
+				}
+				content, err := diff.Apply(state.TextBlocks[i].Content)
+				if err != nil {
+					return err
+				}
+				state.TextBlocks[i].Content = content
+				state.TextBlocks[i].UpdatedAt = time.Now()
+				state.TextBlocks[i].UpdatedBy = editorID
+				state.TextBlocks[i].Version++
+				version = state.TextBlocks[i].Version
+			}
+		}
+		return nil
+	})
+	if handled {
+		return version, err
+	}
+	version, err = models.ApplyTextDiff(ctx, h.DB, roomID, id, diff, editorID)
+	if err != nil {
+		return 0, err
+	}
+	return version, models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) deleteTextBlock(ctx context.Context, roomID, id string) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.TextBlocks {
+			if state.TextBlocks[i].ID == id {
+				if state.TextBlocks[i].Locked {
+					return models.ErrLocked
+				}
+				state.TextBlocks = append(state.TextBlocks[:i], state.TextBlocks[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.DeleteTextBlock(ctx, h.DB, roomID, id); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) setTextBlockLocked(ctx context.Context, roomID, id string, locked bool) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.TextBlocks {
+			if state.TextBlocks[i].ID == id {
+				state.TextBlocks[i].Locked = locked
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	return models.SetTextBlockLocked(ctx, h.DB, roomID, id, locked)
+}
+
+func (h *Hub) createShape(ctx context.Context, shape *models.Shape) error {
+	handled, err := h.changeEphemeral(shape.RoomID, func(state *models.RoomState) error {
+		shape.CreatedAt = time.Now()
+		shape.UpdatedAt = shape.CreatedAt
+		state.Shapes = append(state.Shapes, *shape)
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.CreateShape(ctx, h.DB, shape); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, shape.RoomID)
+}
+
+func (h *Hub) updateShape(ctx context.Context, roomID, id string, updates *models.ShapeUpdate) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Shapes {
+			if state.Shapes[i].ID == id {
+				updates.Apply(&state.Shapes[i])
+				state.Shapes[i].UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.UpdateShape(ctx, h.DB, roomID, id, updates); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) getShape(ctx context.Context, roomID, id string) (*models.Shape, error) {
+	var found *models.Shape
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Shapes {
+			if state.Shapes[i].ID == id {
+				shape := state.Shapes[i]
+				found = &shape
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	if handled {
+		return found, err
+	}
+	return models.GetShape(ctx, h.DB, roomID, id)
+}
+
+func (h *Hub) deleteShape(ctx context.Context, roomID, id string) error {
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Shapes {
+			if state.Shapes[i].ID == id {
+				state.Shapes = append(state.Shapes[:i], state.Shapes[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.DeleteShape(ctx, h.DB, roomID, id); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) createImage(ctx context.Context, img *models.Image) error {
+	handled, err := h.changeEphemeral(img.RoomID, func(state *models.RoomState) error {
+		img.CreatedAt = time.Now()
+		state.Images = append(state.Images, *img)
+		return nil
+	})
+	if handled {
+		return err
+	}
+	if err := models.CreateImage(ctx, h.DB, img); err != nil {
+		return err
+	}
+	return models.UpdateRoomTimestamp(ctx, h.DB, img.RoomID)
+}
+
+func (h *Hub) getImage(ctx context.Context, roomID, id string) (*models.Image, error) {
+	var found *models.Image
+	handled, err := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Images {
+			if state.Images[i].ID == id {
+				img := state.Images[i]
+				found = &img
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	if handled {
+		return found, err
+	}
+	return models.GetImage(ctx, h.DB, roomID, id)
+}
+
+// deleteImage removes the image and returns it, so its file can be deleted
+func (h *Hub) deleteImage(ctx context.Context, roomID, id string) (*models.Image, error) {
+	var removed *models.Image
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		for i := range state.Images {
+			if state.Images[i].ID == id {
+				img := state.Images[i]
+				removed = &img
+				state.Images = append(state.Images[:i], state.Images[i+1:]...)
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	if handled {
+		return removed, err
+	}
+
+	img, err := models.GetImage(ctx, h.DB, roomID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.DeleteImage(ctx, h.DB, roomID, id); err != nil {
+		return nil, err
+	}
+	return img, models.UpdateRoomTimestamp(ctx, h.DB, roomID)
+}
+
+func (h *Hub) clearRoom(ctx context.Context, roomID string, expectedUpdatedAt *time.Time) error {
+	// Queued point writes go first, so the snapshot has the latest points
+	// and no write lands on a stroke after the clear removed it
+	h.flushRoomStrokes(roomID)
+	snapshot := h.snapshotForUndo(ctx, roomID)
+	var keys []string
+	handled, err := h.changeEphemeral(roomID, func(state *models.RoomState) error {
+		if expectedUpdatedAt != nil && state.Room.UpdatedAt.After(*expectedUpdatedAt) {
+			return models.ErrConflict
+		}
+		for _, img := range state.Images {
+			if img.Key != "" {
+				keys = append(keys, img.Key)
+			}
+		}
+		state.Strokes = []models.Stroke{}
+		state.TextBlocks = []models.TextBlock{}
+		state.Shapes = []models.Shape{}
+		state.Images = []models.Image{}
+		return nil
+	})
+	if !handled {
+		keys, err = models.ClearRoom(ctx, h.DB, roomID, expectedUpdatedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Files the snapshot refers to stay until its undo window closes
+	if snapshot != nil {
+		held := make(map[string]bool)
+		for _, key := range snapshot.uploadKeys() {
+			held[key] = true
+		}
+		keys = slices.DeleteFunc(keys, func(key string) bool { return held[key] })
+	}
+	h.keepSnapshot(roomID, snapshot)
+	h.DeleteUploads(keys)
+	return nil
+}
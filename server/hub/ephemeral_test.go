@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestEphemeralRoomsLockIndependently(t *testing.T) {
+	h := NewHub(nil)
+	joinEphemeral(t, h, "a", newTestClient(h, "c1", "a"))
+	joinEphemeral(t, h, "b", newTestClient(h, "c2", "b"))
+
+	// Hold room a's content while writing to room b
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go h.withEphemeral("a", func(state *models.RoomState) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+	defer close(release)
+
+	done := make(chan error)
+	go func() {
+		done <- h.createStroke(context.Background(), &models.Stroke{ID: "s2", RoomID: "b"})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write to room b waited on room a")
+	}
+}
+
+func TestRoomStrokesEphemeral(t *testing.T) {
+	h := NewHub(nil)
+	joinEphemeral(t, h, "room", newTestClient(h, "c1", "room"))
+
+	ctx := context.Background()
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	if err := h.createStroke(ctx, &models.Stroke{ID: "s2", RoomID: "room"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.createStroke(ctx, &models.Stroke{ID: "s3", RoomID: "room"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.deleteStroke(ctx, "room", "s3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Served from memory without a database; deleted strokes are left out
+	strokes, err := h.RoomStrokes(ctx, "room", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strokes) != 2 || strokes[0].ID != "s1" || strokes[1].ID != "s2" {
+		t.Errorf("strokes = %v, want s1 and s2", strokeIDs(strokes))
+	}
+
+	strokes, err = h.RoomStrokes(ctx, "room", &before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strokes) != 1 || strokes[0].ID != "s2" {
+		t.Errorf("strokes since = %v, want s2", strokeIDs(strokes))
+	}
+}
+
+func strokeIDs(strokes []models.Stroke) []string {
+	ids := make([]string, len(strokes))
+	for i, stroke := range strokes {
+		ids[i] = stroke.ID
+	}
+	return ids
+}
@@ -0,0 +1,92 @@
+package hub
+
+import (
+	"context"
+	"log"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/google/uuid"
+)
+
+// handleEraseRegion erases the stroke geometry inside a rectangle. Strokes
+// wholly inside are deleted, strokes crossing it are cut back to the points
+// outside, with any extra pieces stored as new strokes. Locked strokes, and
+// ones another participant holds, are left alone. Everyone, the sender
+// included, gets the resulting stroke events since only the server knows
+// what was hit.
+func (h *Hub) handleEraseRegion(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.Region == nil {
+		return
+	}
+	if err := msg.Region.Validate(); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+
+	strokes, err := h.getStrokesInRegion(ctx, client.RoomID, *msg.Region)
+	if err != nil {
+		log.Printf("Failed to load strokes for erase: %v", err)
+		h.sendError(client, "Failed to erase")
+		return
+	}
+
+	for _, stroke := range strokes {
+		if stroke.Locked || h.heldByOther(client.RoomID, client, ElementStroke, stroke.ID) {
+			continue
+		}
+		pieces, erased := models.ErasePoints(stroke.Points, *msg.Region)
+		if !erased {
+			continue
+		}
+		h.cancelPendingPoints(stroke.ID)
+
+		if len(pieces) == 0 {
+			if err := h.deleteStroke(ctx, client.RoomID, stroke.ID); err != nil {
+				log.Printf("Failed to delete erased stroke %s: %v", stroke.ID, err)
+				continue
+			}
+			h.broadcastToRoom(client.RoomID, &ServerMessage{
+				Type:            "stroke_delete",
+				StrokeID:        stroke.ID,
+				ParticipantID:   client.ID,
+				ParticipantName: client.Name,
+			}, nil)
+			continue
+		}
+
+		// The first piece keeps the stroke's identity
+		if err := h.updateStrokePoints(ctx, client.RoomID, stroke.ID, pieces[0]); err != nil {
+			log.Printf("Failed to trim erased stroke %s: %v", stroke.ID, err)
+			continue
+		}
+		h.broadcastToRoom(client.RoomID, &ServerMessage{
+			Type:            "stroke_update",
+			StrokeID:        stroke.ID,
+			Points:          pieces[0],
+			ParticipantID:   client.ID,
+			ParticipantName: client.Name,
+		}, nil)
+
+		// The rest become new strokes, still credited to the original author
+		for _, points := range pieces[1:] {
+			piece := &models.Stroke{
+				ID:        uuid.New().String(),
+				RoomID:    client.RoomID,
+				Points:    points,
+				Color:     stroke.Color,
+				Tool:      stroke.Tool,
+				CreatedBy: stroke.CreatedBy,
+			}
+			if err := h.createStroke(ctx, piece); err != nil {
+				log.Printf("Failed to save split stroke: %v", err)
+				continue
+			}
+			h.broadcastToRoom(client.RoomID, &ServerMessage{
+				Type:            "stroke_add",
+				Stroke:          piece,
+				ParticipantID:   client.ID,
+				ParticipantName: client.Name,
+			}, nil)
+		}
+	}
+}
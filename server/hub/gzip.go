@@ -0,0 +1,34 @@
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+)
+
+// gzipMagic starts every gzip stream and never valid JSON text or a
+// MessagePack message, so WritePump and clients can tell gzipped snapshots apart
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// marshalSnapshot encodes a room_state or room_delta message. Clients that
+// connected with ?compress=gzip get it gzipped when it's at least
+// CompressionThreshold bytes, for proxies that strip permessage-deflate
+func (h *Hub) marshalSnapshot(client *Client, msg *ServerMessage) ([]byte, error) {
+	data, err := client.marshal(msg)
+	if err != nil || !client.Gzip || len(data) < h.CompressionThreshold {
+		return data, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[%s] Compressed %s for client %s: %d -> %d bytes (%.1f%%)",
+		client.RequestID, msg.Type, client.ID, len(data), buf.Len(), 100*float64(buf.Len())/float64(len(data)))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/gorilla/websocket"
+)
+
+// bigRoomState is a room_state message well over the compression threshold
+func bigRoomState() *ServerMessage {
+	state := &models.RoomState{Room: models.Room{ID: "room", Title: "Big"}}
+	for i := 0; i < 200; i++ {
+		state.Strokes = append(state.Strokes, models.Stroke{
+			ID: fmt.Sprintf("s%d", i), Color: "#000000", Tool: "pen",
+			Points: []models.Point{{X: float64(i), Y: 1, Pressure: 0.5}, {X: float64(i), Y: 2, Pressure: 0.5}},
+		})
+	}
+	return &ServerMessage{Type: "room_state", RoomState: state}
+}
+
+func TestMarshalSnapshotGzip(t *testing.T) {
+	h := NewHub(nil)
+	h.CompressionThreshold = 1024
+	client := &Client{ID: "c1", Hub: h, Gzip: true}
+	msg := bigRoomState()
+
+	plain, err := client.marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := h.marshalSnapshot(client, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		t.Fatal("large snapshot was not gzipped")
+	}
+	if len(data) >= len(plain) {
+		t.Errorf("gzipped to %d bytes from %d", len(data), len(plain))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unzipped, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unzipped, plain) {
+		t.Error("gzipped snapshot does not decompress to the original JSON")
+	}
+
+	// Small snapshots, and clients that didn't opt in, get plain JSON
+	small := &ServerMessage{Type: "room_state", RoomState: &models.RoomState{}}
+	if data, _ := h.marshalSnapshot(client, small); bytes.HasPrefix(data, gzipMagic) {
+		t.Error("small snapshot was gzipped")
+	}
+	client.Gzip = false
+	if data, _ := h.marshalSnapshot(client, msg); !bytes.Equal(data, plain) {
+		t.Error("snapshot gzipped for a client that didn't ask")
+	}
+}
+
+func TestGzippedSnapshotSentAsBinary(t *testing.T) {
+	h := NewHub(nil)
+	h.CompressionThreshold = 1024
+	server, conn, _ := compressedPair(t)
+	client := startWritePump(h, server)
+	client.Gzip = true
+
+	data, err := h.marshalSnapshot(client, bigRoomState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Send <- data
+	client.Send <- []byte(`{"type":"ack"}`)
+
+	if frameType, got, err := conn.ReadMessage(); err != nil || frameType != websocket.BinaryMessage || !bytes.Equal(got, data) {
+		t.Errorf("snapshot arrived as frame type %d (%v), want the gzip bytes in a binary frame", frameType, err)
+	}
+	if frameType, _, err := conn.ReadMessage(); err != nil || frameType != websocket.TextMessage {
+		t.Errorf("JSON message arrived as frame type %d (%v), want text", frameType, err)
+	}
+}
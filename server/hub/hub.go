@@ -2,12 +2,17 @@ package hub
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dre4success/bethel/server/metrics"
 	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -28,17 +33,179 @@ type Hub struct {
 	// Unregister requests from clients
 	Unregister chan *Client
 
-	// Participant colors (cycle through for new clients)
+	// In-memory content of active ephemeral rooms (the map is guarded by
+	// RoomsMu, each room's content by its own lock; see ephemeral.go)
+	ephemeralRooms map[string]*ephemeralRoom
+
+	// Participant colors; new clients get the first one not in use in their room
 	Colors []string
+
+	// Merge a client's new stroke into its previous one if it starts within
+	// this window of the last stroke activity (0 disables merging)
+	StrokeMergeWindow time.Duration
+
+	// Maximum gap between the previous stroke's end and the new stroke's start
+	// for a merge (0 means no distance limit)
+	StrokeMergeDistance float64
+
+	// Drop a stroke_add repeating the client stroke ID and content of one
+	// handled in the same room within this window, e.g. a network retry
+	// (0 disables deduplication)
+	StrokeDedupeWindow time.Duration
+
+	// Negotiate permessage-deflate with clients
+	Compression bool
+
+	// Messages smaller than this many bytes are sent uncompressed (also
+	// applies to gzipped snapshots)
+	CompressionThreshold int
+
+	// Connection I/O buffer sizes in bytes, and whether write buffers are
+	// pooled between writes instead of held by each connection
+	ReadBufferSize  int
+	WriteBufferSize int
+	WriteBufferPool bool
+
+	// Decimal places kept in coordinates on persistence and broadcast
+	// (negative keeps full precision)
+	CoordinatePrecision int
+
+	// Coalesce stroke point writes to at most one per stroke per interval
+	// (0 writes every update through)
+	StrokeFlushInterval time.Duration
+
+	// How often clients are pinged, and how long a client may go without
+	// answering before it is disconnected (PingInterval must be shorter)
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	// Largest WebSocket message accepted from a client, in bytes; larger
+	// messages close the connection
+	MaxMessageSize int64
+
+	// Most points a stroke may carry (0 means unlimited)
+	MaxStrokePoints int
+
+	// Simplify added strokes for clients that don't choose with ?simplify=,
+	// dropping points within SimplifyEpsilon canvas units of the line
+	// through their neighbours (0 epsilon disables simplification)
+	SimplifyStrokes bool
+	SimplifyEpsilon float64
+
+	// Outgoing messages buffered per client
+	SendBufferSize int
+
+	// Disconnect a client once this many messages in a row were dropped
+	// because its send buffer was full (0 only ever drops)
+	MaxSendDrops int
+
+	// Stroke tools clients may draw with (a subset of models.StrokeTools)
+	Tools []string
+
+	// Where uploaded images are stored (nil disables deleting their files)
+	Uploads storage.Store
+
+	// Inbound messages allowed per client per second, with bursts up to
+	// one second's worth (0 disables rate limiting)
+	MessageRate float64
+
+	// Minimum time between cursor_move broadcasts from one client; faster
+	// moves are coalesced to the latest position (0 broadcasts every move)
+	CursorInterval time.Duration
+
+	// How long a text_editing_start lasts without a stop or another start
+	// (0 keeps it until the client stops or leaves)
+	TextEditingTimeout time.Duration
+
+	// How long a client may send nothing before it is announced with
+	// participant_idle (0 disables idle tracking)
+	IdleTimeout time.Duration
+
+	// How often each active room is sent a state_checksum (0 disables)
+	ChecksumInterval time.Duration
+
+	// How often room activity (peak participants, last message) is written
+	// to the database (0 disables)
+	ActivityFlushInterval time.Duration
+
+	// Most clients (including viewers) connected to one room at a time;
+	// further connections are turned away (0 means unlimited)
+	MaxParticipants int
+
+	// How long after a clear_all its content can be brought back with
+	// undo_clear (0 disables)
+	UndoClearWindow time.Duration
+
+	// Most rooms open at once; clients opening another room are turned
+	// away (0 means unlimited)
+	MaxRooms int
+
+	// Elements held with lock, by room (see elementlock.go)
+	elementLocks map[string]map[elementKey]*Client
+	locksMu      sync.Mutex
+
+	// Connections following a room besides their own, by room (see
+	// subscribe.go); guarded by RoomsMu
+	subscribers map[string]map[*Client]bool
+
+	// Content removed by each room's last clear_all (see undoclear.go)
+	clearSnapshots map[string]*clearSnapshot
+	snapshotsMu    sync.Mutex
+
+	// Recently added strokes by room and client stroke ID (see dedupe.go)
+	recentStrokes map[string]recentStroke
+	recentPruned  time.Time
+	recentMu      sync.Mutex
+
+	// Activity per room since the last flush (see activity.go)
+	roomActivity map[string]*roomActivity
+	activityMu   sync.Mutex
+
+	// Stroke point writes waiting for the flush interval
+	pendingPoints map[string]*pendingPoints
+	pendingMu     sync.Mutex
+
+	// Receives client IDs acknowledging server_shutdown while shutting down
+	shutdownAcks   chan string
+	shutdownAcksMu sync.Mutex
 }
 
 // NewHub creates a new Hub instance
 func NewHub(db *pgxpool.Pool) *Hub {
 	return &Hub{
-		DB:         db,
-		Rooms:      make(map[string]map[*Client]bool),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+		DB:                  db,
+		Rooms:               make(map[string]map[*Client]bool),
+		ephemeralRooms:      make(map[string]*ephemeralRoom),
+		Register:            make(chan *Client),
+		Unregister:          make(chan *Client),
+		CoordinatePrecision: -1,
+		PingInterval:        30 * time.Second,
+		PongTimeout:         60 * time.Second,
+		MaxMessageSize:      1 << 20,
+		MaxStrokePoints:     10000,
+		SendBufferSize:      256,
+		ReadBufferSize:      4096,
+		WriteBufferSize:     4096,
+		MaxSendDrops:        8,
+		SimplifyEpsilon:     0.5,
+		Tools:               models.StrokeTools,
+		MessageRate:         120,
+		CursorInterval:      time.Second / 30,
+		MaxParticipants:     50,
+		IdleTimeout:         60 * time.Second,
+		TextEditingTimeout:  10 * time.Second,
+		ChecksumInterval:    30 * time.Second,
+		pendingPoints:       make(map[string]*pendingPoints),
+		elementLocks:        make(map[string]map[elementKey]*Client),
+		roomActivity:        make(map[string]*roomActivity),
+		subscribers:         make(map[string]map[*Client]bool),
+		recentStrokes:       make(map[string]recentStroke),
+		clearSnapshots:      make(map[string]*clearSnapshot),
+
+		ActivityFlushInterval: time.Minute,
+		StrokeDedupeWindow:    10 * time.Second,
+		UndoClearWindow:       5 * time.Minute,
+
 		Colors: []string{
 			"#FF3B30", // Red
 			"#007AFF", // Blue
@@ -54,44 +221,170 @@ func NewHub(db *pgxpool.Pool) *Hub {
 
 // Run starts the hub's main loop
 func (h *Hub) Run() {
+	if h.ChecksumInterval > 0 {
+		go h.broadcastChecksums()
+	}
+	if h.ActivityFlushInterval > 0 {
+		go h.persistActivity()
+	}
 	for {
-		select {
-		case client := <-h.Register:
-			h.registerClient(client)
+		h.runOnce()
+	}
+}
 
-		case client := <-h.Unregister:
-			h.unregisterClient(client)
+// runOnce handles a single register/unregister event. A panic is logged and
+// swallowed so one bad event cannot stop the loop and freeze every room.
+func (h *Hub) runOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in hub loop: %v\n%s", r, debug.Stack())
 		}
+	}()
+
+	select {
+	case client := <-h.Register:
+		h.registerClient(client)
+
+	case client := <-h.Unregister:
+		h.unregisterClient(client)
 	}
 }
 
 func (h *Hub) registerClient(client *Client) {
+	if reason := h.addClient(client); reason != "" {
+		// The client never joined, so close its channel here; WritePump
+		// sends the error and then closes the connection. Cancelling first
+		// keeps anything still running for the client from sending on it.
+		log.Printf("[%s] Rejected client %s for room %s: %s", client.RequestID, client.ID, client.RoomID, reason)
+		h.sendError(client, reason)
+		client.cancelContext()
+		close(client.Send)
+		return
+	}
+
+	h.startIdleTimer(client)
+
+	// Tell the new client who it is
+	self := client.ToParticipant()
+	h.sendToClient(client, &ServerMessage{
+		Type:        "connected",
+		Participant: &self,
+	})
+
+	// And what this server supports
+	h.sendToClient(client, &ServerMessage{
+		Type:         "capabilities",
+		Capabilities: h.Capabilities(),
+	})
+
+	// Send room state to the new client (after releasing lock)
+	if client.Since != nil {
+		go h.sendRoomDelta(client, *client.Since)
+	} else {
+		go h.sendRoomState(client)
+	}
+}
+
+// addClient places the client in its room and announces it to the others.
+// If the room is full, or opening it would exceed MaxRooms, the client is
+// left out and the reason returned.
+func (h *Hub) addClient(client *Client) string {
 	h.RoomsMu.Lock()
+	defer h.RoomsMu.Unlock()
+
+	if h.MaxParticipants > 0 && len(h.Rooms[client.RoomID]) >= h.MaxParticipants {
+		metrics.RejectedConnections.WithLabelValues("room_full").Inc()
+		return "Room is full"
+	}
+	if h.MaxRooms > 0 && h.Rooms[client.RoomID] == nil && len(h.Rooms) >= h.MaxRooms {
+		metrics.RejectedConnections.WithLabelValues("too_many_rooms").Inc()
+		return "Server is at capacity, try again later"
+	}
 
 	// Create room if it doesn't exist
 	if h.Rooms[client.RoomID] == nil {
 		h.Rooms[client.RoomID] = make(map[*Client]bool)
+		metrics.ActiveRooms.Inc()
+	}
+
+	// Ephemeral content must be held in memory before the client's first
+	// write, or the write would fall through to the database
+	if client.Ephemeral && h.ephemeralRooms[client.RoomID] == nil {
+		h.ephemeralRooms[client.RoomID] = newEphemeralRoom()
 	}
 
-	// Assign a color to the client
-	colorIndex := len(h.Rooms[client.RoomID]) % len(h.Colors)
-	client.Color = h.Colors[colorIndex]
+	// Honor a requested color if it is valid and free, otherwise pick one
+	if !models.IsValidColor(client.Color) || colorTaken(h.Rooms[client.RoomID], client.Color) {
+		client.Color = h.pickColor(h.Rooms[client.RoomID])
+	}
+
+	// Give unnamed clients a distinct fallback name
+	if client.Name == "" {
+		client.guestNumber = nextGuestNumber(h.Rooms[client.RoomID])
+		client.Name = fmt.Sprintf("Guest %d", client.guestNumber)
+	}
 
 	// Add client to room
 	h.Rooms[client.RoomID][client] = true
+	client.joinedAt = time.Now()
+	metrics.ActiveConnections.Inc()
+	h.recordJoin(client.RoomID, len(h.Rooms[client.RoomID]))
 
-	log.Printf("Client %s joined room %s (total: %d)", client.ID, client.RoomID, len(h.Rooms[client.RoomID]))
+	log.Printf("[%s] Client %s joined room %s (total: %d)", client.RequestID, client.ID, client.RoomID, len(h.Rooms[client.RoomID]))
 
 	// Notify other clients in the room (while holding lock, use unsafe version)
+	participant := client.ToParticipant()
 	h.broadcastToRoomUnsafe(client.RoomID, &ServerMessage{
-		Type:        "participant_join",
-		Participant: &Participant{ID: client.ID, Color: client.Color, Name: client.Name},
+		Type:             "participant_join",
+		Participant:      &participant,
+		ParticipantCount: len(h.Rooms[client.RoomID]),
 	}, client)
+	return ""
+}
+
+// isMember reports whether the client is connected to its room
+func (h *Hub) isMember(client *Client) bool {
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+	return h.Rooms[client.RoomID][client]
+}
 
-	h.RoomsMu.Unlock()
+// pickColor returns the first palette color unused in the room, cycling
+// through the palette only once every color is taken
+func (h *Hub) pickColor(room map[*Client]bool) string {
+	for _, color := range h.Colors {
+		if !colorTaken(room, color) {
+			return color
+		}
+	}
+	return h.Colors[len(room)%len(h.Colors)]
+}
 
-	// Send room state to the new client (after releasing lock)
-	go h.sendRoomState(client)
+// colorTaken reports whether a client in the room already uses color
+func colorTaken(room map[*Client]bool, color string) bool {
+	for c := range room {
+		if strings.EqualFold(c.Color, color) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextGuestNumber returns the lowest guest number not held by a client in the room.
+// Numbers are released when their client leaves, so they are reused.
+func nextGuestNumber(room map[*Client]bool) int {
+	taken := make(map[int]bool, len(room))
+	for c := range room {
+		if c.guestNumber > 0 {
+			taken[c.guestNumber] = true
+		}
+	}
+
+	n := 1
+	for taken[n] {
+		n++
+	}
+	return n
 }
 
 func (h *Hub) unregisterClient(client *Client) {
@@ -101,19 +394,36 @@ func (h *Hub) unregisterClient(client *Client) {
 	if room, ok := h.Rooms[client.RoomID]; ok {
 		if _, ok := room[client]; ok {
 			delete(room, client)
+			h.unsubscribeAllUnsafe(client)
+			client.cancelContext()
 			close(client.Send)
+			client.stopCursor()
+			client.stopIdle()
+			metrics.ActiveConnections.Dec()
 
 			log.Printf("Client %s left room %s (remaining: %d)", client.ID, client.RoomID, len(room))
 
+			// Clear the client's typing indicators
+			h.stopEditingUnsafe(client)
+
+			// Free anything the client held with lock
+			h.releaseLocksUnsafe(client)
+
 			// Notify other clients
 			h.broadcastToRoomUnsafe(client.RoomID, &ServerMessage{
-				Type:          "participant_leave",
-				ParticipantID: client.ID,
+				Type:             "participant_leave",
+				ParticipantID:    client.ID,
+				ParticipantCount: len(room),
 			}, nil)
 
+			// Record the end of the session for presence analytics
+			go h.recordSession(client, time.Now())
+
 			// Clean up empty rooms
 			if len(room) == 0 {
 				delete(h.Rooms, client.RoomID)
+				delete(h.ephemeralRooms, client.RoomID)
+				metrics.ActiveRooms.Dec()
 				log.Printf("Room %s is now empty", client.RoomID)
 			}
 		}
@@ -128,70 +438,91 @@ func (h *Hub) sendRoomState(client *Client) {
 		}
 	}()
 
-	ctx := context.Background()
+	ctx := client.Context()
 
-    start := time.Now()
-	roomState, err := models.GetRoomState(ctx, h.DB, client.RoomID)
-    duration := time.Since(start)
-    if duration > 100 * time.Millisecond {
-        log.Printf("GetRoomState took %v for room %s", duration, client.RoomID)
-    }
+	start := time.Now()
+	roomState, err := models.GetRoomState(ctx, h.DB, client.Tenant, client.RoomID)
+	duration := time.Since(start)
+	metrics.ObserveQuery("room_state", start)
+	if duration > 100*time.Millisecond {
+		log.Printf("GetRoomState took %v for room %s", duration, client.RoomID)
+	}
 
 	if err != nil {
-		log.Printf("Failed to get room state: %v. Creating new room %s", err, client.RoomID)
-		// Auto-create room for offline clients syncing back
-		newRoom, createErr := models.CreateRoom(ctx, h.DB, client.RoomID, "Untitled")
-		if createErr != nil {
-			log.Printf("Failed to auto-create room: %v", createErr)
-			return
-		}
-		
-		roomState = &models.RoomState{
-			Room:       *newRoom,
-			Strokes:    []models.Stroke{},
-			TextBlocks: []models.TextBlock{},
-		}
+		// The handler checked the room exists, so it was deleted since
+		log.Printf("Failed to get room state for %s: %v", client.RoomID, err)
+		h.sendError(client, "Room not found")
+		return
+	}
+
+	// Record the session now the room is known to exist
+	go h.recordSession(client, time.Time{})
+
+	// Ephemeral rooms serve content from memory
+	if roomState.Room.Ephemeral {
+		roomState = h.loadEphemeralState(roomState)
 	}
+	roomState.IsNew = client.CreatedRoom
+
+	client.filterRoomState(roomState)
 
 	// Get current participants and verify client is still connected
 	h.RoomsMu.RLock()
-    // Verify client is still in the room (prevent sending on closed channel)
-    room, roomExists := h.Rooms[client.RoomID]
-    if !roomExists || !room[client] {
-        h.RoomsMu.RUnlock()
-        log.Printf("Client %s disconnected before room state could be sent", client.ID)
-        return
-    }
+	// Verify client is still in the room (prevent sending on closed channel)
+	room, roomExists := h.Rooms[client.RoomID]
+	if !roomExists || !room[client] {
+		h.RoomsMu.RUnlock()
+		log.Printf("Client %s disconnected before room state could be sent", client.ID)
+		return
+	}
 
 	var participants []Participant
-    for c := range room {
-        participants = append(participants, c.ToParticipant())
-    }
+	for c := range room {
+		participants = append(participants, c.ToParticipant())
+	}
 	h.RoomsMu.RUnlock()
 
 	msg := &ServerMessage{
 		Type:         "room_state",
 		RoomState:    roomState,
 		Participants: participants,
+		SyncedAt:     &start,
 	}
 
-	data, err := json.Marshal(msg)
+	data, err := h.marshalSnapshot(client, msg)
 	if err != nil {
 		log.Printf("Failed to marshal room state: %v", err)
 		return
 	}
 
-    // Recover from panic just in case
+	// Recover from panic just in case
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Recovered from panic in sendRoomState: %v", r)
 		}
 	}()
 
-	select {
-	case client.Send <- data:
-	default:
-		log.Printf("Client %s send buffer full", client.ID)
+	h.trySend(client, data)
+}
+
+// recordSession persists a client's session start, or its end if leftAt is set
+func (h *Hub) recordSession(client *Client, leftAt time.Time) {
+	session := &models.ParticipantSession{
+		ParticipantID: client.ID,
+		RoomID:        client.RoomID,
+		Name:          client.Name,
+		JoinedAt:      client.joinedAt,
+	}
+
+	var err error
+	if leftAt.IsZero() {
+		err = models.RecordSessionStart(context.Background(), h.DB, session)
+	} else {
+		session.LeftAt = &leftAt
+		err = models.RecordSessionEnd(context.Background(), h.DB, session)
+	}
+	if err != nil {
+		log.Printf("Failed to record session for client %s: %v", client.ID, err)
 	}
 }
 
@@ -204,27 +535,138 @@ func (h *Hub) broadcastToRoom(roomID string, msg *ServerMessage, exclude *Client
 
 // broadcastToRoomUnsafe assumes the caller holds the lock
 func (h *Hub) broadcastToRoomUnsafe(roomID string, msg *ServerMessage, exclude *Client) {
-	room, ok := h.Rooms[roomID]
-	if !ok {
+	room := h.Rooms[roomID]
+	subscribers := h.subscribers[roomID]
+	if len(room) == 0 && len(subscribers) == 0 {
 		return
 	}
 
-	data, err := json.Marshal(msg)
+	encoded, err := newEncodedMessage(msg)
 	if err != nil {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
 
+	kind := messageKind(msg)
 	for client := range room {
-		if client != exclude {
-			select {
-			case client.Send <- data:
-			default:
-				// Buffer full, skip
-				log.Printf("Client %s send buffer full, skipping", client.ID)
+		if client != exclude && client.Wants(kind) {
+			data, err := encoded.forClient(client)
+			if err != nil {
+				log.Printf("Failed to encode message for client %s: %v", client.ID, err)
+				continue
+			}
+			h.trySend(client, data)
+		}
+	}
+
+	if len(subscribers) > 0 {
+		h.broadcastToSubscribersUnsafe(roomID, subscribers, msg, exclude)
+	}
+}
+
+// broadcastToSubscribersUnsafe sends a room's message, tagged with its
+// roomId, to the connections following it with subscribe
+func (h *Hub) broadcastToSubscribersUnsafe(roomID string, subscribers map[*Client]bool, msg *ServerMessage, exclude *Client) {
+	tagged := *msg
+	tagged.RoomID = roomID
+	encoded, err := newEncodedMessage(&tagged)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+
+	kind := messageKind(msg)
+	for client := range subscribers {
+		if client != exclude && client.Wants(kind) {
+			data, err := encoded.forClient(client)
+			if err != nil {
+				log.Printf("Failed to encode message for client %s: %v", client.ID, err)
+				continue
 			}
+			h.trySend(client, data)
+		}
+	}
+}
+
+// sendToClient sends a message to a single client, dropping it if the buffer is full
+func (h *Hub) sendToClient(client *Client, msg *ServerMessage) {
+	data, err := client.marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+
+	h.trySend(client, data)
+}
+
+// BroadcastAll sends a message to every client in every room
+func (h *Hub) BroadcastAll(msg *ServerMessage) {
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	for roomID := range h.Rooms {
+		h.broadcastToRoomUnsafe(roomID, msg, nil)
+	}
+}
+
+// Shutdown warns every client that the server is going away, gives them up to
+// grace to flush pending work and reply with shutdown_ack, then closes all
+// connections. reconnectAfter hints how long clients should wait to reconnect.
+func (h *Hub) Shutdown(reconnectAfter time.Duration, grace time.Duration) {
+	var clients []*Client
+	h.RoomsMu.RLock()
+	for _, room := range h.Rooms {
+		for client := range room {
+			clients = append(clients, client)
 		}
 	}
+	h.RoomsMu.RUnlock()
+
+	acks := make(chan string, len(clients))
+	h.shutdownAcksMu.Lock()
+	h.shutdownAcks = acks
+	h.shutdownAcksMu.Unlock()
+
+	log.Printf("Notifying %d clients of shutdown", len(clients))
+	h.BroadcastAll(&ServerMessage{
+		Type:             "server_shutdown",
+		ReconnectAfterMs: reconnectAfter.Milliseconds(),
+	})
+
+	// Wait for every client to acknowledge, or for the grace period to end
+	acked := make(map[string]bool)
+	timeout := time.After(grace)
+wait:
+	for len(acked) < len(clients) {
+		select {
+		case id := <-acks:
+			acked[id] = true
+		case <-timeout:
+			break wait
+		}
+	}
+	log.Printf("%d of %d clients acknowledged shutdown", len(acked), len(clients))
+
+	for _, client := range clients {
+		h.Unregister <- client
+	}
+
+	h.FlushPendingStrokes()
+	h.FlushActivity()
+}
+
+// ackShutdown records a client's acknowledgement of server_shutdown
+func (h *Hub) ackShutdown(client *Client) {
+	h.shutdownAcksMu.Lock()
+	defer h.shutdownAcksMu.Unlock()
+
+	if h.shutdownAcks == nil {
+		return
+	}
+	select {
+	case h.shutdownAcks <- client.ID:
+	default:
+	}
 }
 
 // GetRoomParticipants returns all participants in a room
@@ -240,3 +682,66 @@ func (h *Hub) GetRoomParticipants(roomID string) []Participant {
 	}
 	return participants
 }
+
+// ActiveRoomIDs returns the IDs of rooms with at least one connected client
+func (h *Hub) ActiveRoomIDs() []string {
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	ids := make([]string, 0, len(h.Rooms))
+	for roomID := range h.Rooms {
+		ids = append(ids, roomID)
+	}
+	return ids
+}
+
+// DisconnectClient closes the connection with the given client ID, wherever it is.
+// It reports whether a live connection was found.
+func (h *Hub) DisconnectClient(clientID string, reason string) bool {
+	h.RoomsMu.RLock()
+	var target *Client
+	for _, room := range h.Rooms {
+		for client := range room {
+			if client.ID == clientID {
+				target = client
+				break
+			}
+		}
+	}
+	h.RoomsMu.RUnlock()
+
+	if target == nil {
+		return false
+	}
+
+	h.closeClient(target, websocket.ClosePolicyViolation, reason)
+	log.Printf("Client %s disconnected: %s", clientID, reason)
+	return true
+}
+
+// CloseRoom disconnects every client in a room and returns how many were
+// connected. Used when the room itself goes away
+func (h *Hub) CloseRoom(roomID string, reason string) int {
+	h.RoomsMu.RLock()
+	var targets []*Client
+	for client := range h.Rooms[roomID] {
+		targets = append(targets, client)
+	}
+	h.RoomsMu.RUnlock()
+
+	for _, client := range targets {
+		h.closeClient(client, websocket.CloseGoingAway, reason)
+	}
+	if len(targets) > 0 {
+		log.Printf("Closed room %s (%d clients): %s", roomID, len(targets), reason)
+	}
+	return len(targets)
+}
+
+// closeClient tells the peer why before tearing the connection down
+func (h *Hub) closeClient(client *Client, code int, reason string) {
+	closeMsg := websocket.FormatCloseMessage(code, reason)
+	client.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(writeWait))
+
+	h.Unregister <- client
+}
@@ -0,0 +1,421 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/metrics"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestClient returns a client for roomID whose outgoing messages can be
+// read from its Send channel
+func newTestClient(h *Hub, id, roomID string) *Client {
+	return &Client{ID: id, Name: id, RoomID: roomID, Hub: h, Send: make(chan []byte, 64)}
+}
+
+// join adds the client to its room the way registration does
+func join(t *testing.T, h *Hub, client *Client) {
+	t.Helper()
+	if reason := h.addClient(client); reason != "" {
+		t.Fatalf("client %s rejected: %s", client.ID, reason)
+	}
+}
+
+// receive decodes the client's next outgoing message
+func receive(t *testing.T, client *Client) ServerMessage {
+	t.Helper()
+	select {
+	case data := <-client.Send:
+		var msg ServerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return ServerMessage{}
+	}
+}
+
+// receiveType skips the client's outgoing messages up to the first of type
+// msgType
+func receiveType(t *testing.T, client *Client, msgType string) ServerMessage {
+	t.Helper()
+	for {
+		if msg := receive(t, client); msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// expectNothing fails if the client has a message waiting
+func expectNothing(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case data := <-client.Send:
+		t.Errorf("unexpected message %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// drain discards the client's pending outgoing messages
+func drain(client *Client) {
+	for {
+		select {
+		case <-client.Send:
+		default:
+			return
+		}
+	}
+}
+
+func TestRunOnceRecoversFromPanic(t *testing.T) {
+	h := NewHub(nil)
+
+	// Registering a nil client panics inside the loop
+	go func() {
+		h.Register <- nil
+		h.Register <- nil
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("runOnce let a panic escape: %v", r)
+		}
+	}()
+
+	// The loop keeps handling events after the first panic
+	h.runOnce()
+	h.runOnce()
+}
+
+func TestGuestNames(t *testing.T) {
+	// Leaving records the session, which needs a pool to fail against
+	h := NewHub(unreachablePool(t))
+
+	guests := make([]*Client, 3)
+	for i := range guests {
+		guests[i] = &Client{ID: fmt.Sprintf("g%d", i), RoomID: "room", Hub: h, Ephemeral: true, Send: make(chan []byte, 64)}
+		h.registerClient(guests[i])
+		want := fmt.Sprintf("Guest %d", i+1)
+		if msg := receiveType(t, guests[i], "connected"); msg.Participant == nil || msg.Participant.Name != want {
+			t.Errorf("guest %d connected as %+v, want %q", i, msg.Participant, want)
+		}
+	}
+	if msg := receiveType(t, guests[0], "participant_join"); msg.Participant.Name != "Guest 2" {
+		t.Errorf("participant_join named %q, want Guest 2", msg.Participant.Name)
+	}
+
+	// Named clients keep their names and take no number
+	named := newTestClient(h, "ada", "room")
+	named.Name = "Ada"
+	join(t, h, named)
+	if named.Name != "Ada" || named.guestNumber != 0 {
+		t.Errorf("named client became %q (guest %d)", named.Name, named.guestNumber)
+	}
+
+	// A freed number goes to the next guest
+	h.unregisterClient(guests[1])
+	next := &Client{ID: "g3", RoomID: "room", Hub: h, Send: make(chan []byte, 64)}
+	join(t, h, next)
+	if next.Name != "Guest 2" {
+		t.Errorf("next guest named %q, want the freed Guest 2", next.Name)
+	}
+
+	// Numbers are per room
+	elsewhere := &Client{ID: "g4", RoomID: "other", Hub: h, Send: make(chan []byte, 64)}
+	join(t, h, elsewhere)
+	if elsewhere.Name != "Guest 1" {
+		t.Errorf("guest in another room named %q, want Guest 1", elsewhere.Name)
+	}
+}
+
+func TestRequestedColor(t *testing.T) {
+	h := NewHub(nil)
+
+	first := newTestClient(h, "first", "room")
+	first.Color = "#123456"
+	join(t, h, first)
+	if first.Color != "#123456" {
+		t.Errorf("free color replaced with %q", first.Color)
+	}
+
+	// Taken (in any case) or invalid colors fall back to the palette
+	for _, requested := range []string{"#123456", "#ABCDEF0", "red", ""} {
+		client := newTestClient(h, "c"+requested, "room")
+		client.Color = strings.ToUpper(requested)
+		join(t, h, client)
+		if !slices.Contains(h.Colors, client.Color) {
+			t.Errorf("requested %q: got %q, want a palette color", requested, client.Color)
+		}
+	}
+
+	// Others learn the color actually assigned
+	watcher := newTestClient(h, "watcher", "other")
+	join(t, h, watcher)
+	late := newTestClient(h, "late", "other")
+	late.Color = "#123456"
+	join(t, h, late)
+	if msg := receiveType(t, watcher, "participant_join"); msg.Participant.Color != "#123456" {
+		t.Errorf("participant_join color %q, want the requested #123456", msg.Participant.Color)
+	}
+}
+
+func TestConnectSendsCapabilities(t *testing.T) {
+	h := NewHub(nil)
+	h.MaxMessageSize = 1 << 16
+	h.CursorInterval = 40 * time.Millisecond
+	h.Compression = true
+
+	client := newTestClient(h, "c1", "room")
+	client.Ephemeral = true
+	h.registerClient(client)
+
+	if msg := receive(t, client); msg.Type != "connected" {
+		t.Fatalf("first message %s, want connected", msg.Type)
+	}
+	msg := receive(t, client)
+	if msg.Type != "capabilities" || msg.Capabilities == nil {
+		t.Fatalf("second message %s, want capabilities", msg.Type)
+	}
+	caps := msg.Capabilities
+	if caps.ProtocolVersion != ProtocolVersion || caps.MaxMessageSize != 1<<16 || caps.CursorThrottleMs != 40 || !caps.Compression || caps.StrokeMerging {
+		t.Errorf("capabilities %+v don't describe the hub", caps)
+	}
+	for _, msgType := range []string{"stroke_add", "text_diff", "undo"} {
+		if !slices.Contains(caps.MessageTypes, msgType) {
+			t.Errorf("message types %v lack %s", caps.MessageTypes, msgType)
+		}
+	}
+}
+
+func TestIncludeFilter(t *testing.T) {
+	if got := ParseInclude(" strokes, cursors"); len(got) != 2 || !got[KindStrokes] || !got[KindCursors] {
+		t.Errorf("ParseInclude = %v, want strokes and cursors", got)
+	}
+	if ParseInclude("") != nil {
+		t.Error("an empty include list should mean everything")
+	}
+
+	h := NewHub(nil)
+	writer := newTestClient(h, "writer", "room")
+	viewer := newTestClient(h, "viewer", "room")
+	viewer.Include = ParseInclude("strokes")
+	joinEphemeral(t, h, "room", writer, viewer)
+
+	state := &models.RoomState{
+		Strokes:    []models.Stroke{{ID: "s1"}},
+		TextBlocks: []models.TextBlock{{ID: "t1"}},
+		Shapes:     []models.Shape{{ID: "sh1"}},
+		Images:     []models.Image{{ID: "i1"}},
+	}
+	viewer.filterRoomState(state)
+	if len(state.Strokes) != 1 || len(state.TextBlocks)+len(state.Shapes)+len(state.Images) != 0 {
+		t.Errorf("filtered state %+v, want only strokes", state)
+	}
+
+	// Broadcasts of excluded kinds skip the viewer
+	h.HandleMessage(writer, &ClientMessage{Type: "text_add", TextBlock: &models.TextBlock{Content: "hidden"}})
+	h.HandleMessage(writer, &ClientMessage{Type: "cursor_move", X: 1, Y: 1})
+	h.HandleMessage(writer, &ClientMessage{Type: "stroke_delete", StrokeID: "s1"})
+	if msg := receive(t, viewer); msg.Type != "stroke_delete" {
+		t.Errorf("viewer got %s, want only the stroke_delete", msg.Type)
+	}
+	expectNothing(t, viewer)
+}
+
+func TestShutdownWaitsForAcks(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	a := newTestClient(h, "a", "room1")
+	b := newTestClient(h, "b", "room2")
+	join(t, h, a)
+	join(t, h, b)
+
+	done := make(chan struct{})
+	go func() {
+		h.Shutdown(3*time.Second, time.Minute)
+		close(done)
+	}()
+
+	for _, client := range []*Client{a, b} {
+		msg := receiveType(t, client, "server_shutdown")
+		if msg.ReconnectAfterMs != 3000 {
+			t.Errorf("client %s told to reconnect after %dms, want 3000", client.ID, msg.ReconnectAfterMs)
+		}
+		h.HandleMessage(client, &ClientMessage{Type: "shutdown_ack"})
+	}
+
+	// Everyone acknowledged, so the connections close well before the grace period ends
+	closed := map[*Client]bool{<-h.Unregister: true, <-h.Unregister: true}
+	if !closed[a] || !closed[b] {
+		t.Error("not every client was closed")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown kept waiting after every client acknowledged")
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	silent := newTestClient(h, "silent", "room")
+	join(t, h, silent)
+
+	start := time.Now()
+	go h.Shutdown(time.Second, 50*time.Millisecond)
+	receiveType(t, silent, "server_shutdown")
+	if got := <-h.Unregister; got != silent {
+		t.Error("a different client was closed")
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("closed after %v, before the grace period", waited)
+	}
+}
+
+func TestColorsDistinctUntilPaletteExhausted(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	h.Colors = []string{"#111111", "#222222", "#333333"}
+
+	// Joiners arriving together still get distinct colors
+	clients := make([]*Client, len(h.Colors))
+	rejected := make(chan string)
+	for i := range clients {
+		clients[i] = newTestClient(h, fmt.Sprintf("c%d", i), "room")
+		go func(c *Client) { rejected <- h.addClient(c) }(clients[i])
+	}
+	for range clients {
+		if reason := <-rejected; reason != "" {
+			t.Fatalf("client rejected: %s", reason)
+		}
+	}
+	seen := map[string]bool{}
+	for _, c := range clients {
+		seen[c.ToParticipant().Color] = true
+	}
+	if len(seen) != len(h.Colors) {
+		t.Errorf("colors %v, want every palette color once", seen)
+	}
+
+	// A color is reused once its holder leaves
+	freed := clients[1].Color
+	h.unregisterClient(clients[1])
+	rejoined := newTestClient(h, "rejoined", "room")
+	join(t, h, rejoined)
+	if rejoined.ToParticipant().Color != freed {
+		t.Errorf("rejoined with %q, want the freed %q", rejoined.Color, freed)
+	}
+
+	// Only then do colors repeat
+	extra := newTestClient(h, "extra", "room")
+	join(t, h, extra)
+	if !slices.Contains(h.Colors, extra.Color) {
+		t.Errorf("extra joiner got %q, want a palette color", extra.Color)
+	}
+}
+
+func TestDisplayNameAnnounced(t *testing.T) {
+	h := NewHub(nil)
+	watcher := newTestClient(h, "watcher", "room")
+	join(t, h, watcher)
+
+	named := newTestClient(h, "c1", "room")
+	named.Name = SanitizeName("  Grace   Hopper ")
+	join(t, h, named)
+	if msg := receiveType(t, watcher, "participant_join"); msg.Participant.Name != "Grace Hopper" {
+		t.Errorf("participant_join named %q, want Grace Hopper", msg.Participant.Name)
+	}
+
+	names := map[string]bool{}
+	for _, p := range h.GetRoomParticipants("room") {
+		names[p.Name] = true
+	}
+	if !names["Grace Hopper"] || !names["watcher"] {
+		t.Errorf("participants %v, want both names listed", names)
+	}
+}
+
+func TestMaxParticipants(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	h.MaxParticipants = 2
+
+	first := newTestClient(h, "c1", "room")
+	second := newTestClient(h, "c2", "room")
+	join(t, h, first)
+	join(t, h, second)
+	if msg := receiveType(t, first, "participant_join"); msg.ParticipantCount != 2 {
+		t.Errorf("participant_join count %d, want 2", msg.ParticipantCount)
+	}
+
+	// The one over the cap is told why and its connection closed
+	over := newTestClient(h, "c3", "room")
+	h.registerClient(over)
+	if msg := receive(t, over); msg.Type != "error" || msg.Error != "Room is full" {
+		t.Errorf("rejected client got %s %q, want error \"Room is full\"", msg.Type, msg.Error)
+	}
+	if _, open := <-over.Send; open {
+		t.Error("rejected client's channel left open")
+	}
+	if n := len(h.GetRoomParticipants("room")); n != 2 {
+		t.Errorf("%d participants, want 2", n)
+	}
+
+	// Nothing it sends reaches the room
+	h.HandleMessage(over, &ClientMessage{Type: "cursor_move", X: 1, Y: 1})
+	expectNothing(t, first)
+
+	// Leaving frees the place
+	h.unregisterClient(second)
+	if msg := receiveType(t, first, "participant_leave"); msg.ParticipantCount != 1 {
+		t.Errorf("participant_leave count %d, want 1", msg.ParticipantCount)
+	}
+	late := newTestClient(h, "c4", "room")
+	join(t, h, late)
+}
+
+func TestMaxRooms(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	h.MaxRooms = 2
+	rooms := testutil.ToFloat64(metrics.ActiveRooms)
+	rejected := testutil.ToFloat64(metrics.RejectedConnections.WithLabelValues("too_many_rooms"))
+
+	first := newTestClient(h, "c1", "room1")
+	join(t, h, first)
+	second := newTestClient(h, "c2", "room2")
+	join(t, h, second)
+	if got := testutil.ToFloat64(metrics.ActiveRooms) - rooms; got != 2 {
+		t.Errorf("active rooms metric rose by %v, want 2", got)
+	}
+
+	// Open rooms still take more people
+	join(t, h, newTestClient(h, "c3", "room1"))
+
+	// A third room is refused
+	over := newTestClient(h, "c4", "room3")
+	h.registerClient(over)
+	if msg := receive(t, over); msg.Type != "error" || msg.Error != "Server is at capacity, try again later" {
+		t.Errorf("rejected client got %s %q, want the capacity error", msg.Type, msg.Error)
+	}
+	if _, open := <-over.Send; open {
+		t.Error("rejected client's channel left open")
+	}
+	if len(h.ActiveRoomIDs()) != 2 {
+		t.Errorf("open rooms = %v, want 2", h.ActiveRoomIDs())
+	}
+	if got := testutil.ToFloat64(metrics.RejectedConnections.WithLabelValues("too_many_rooms")) - rejected; got != 1 {
+		t.Errorf("too_many_rooms rejections rose by %v, want 1", got)
+	}
+
+	// Closing a room makes space
+	h.unregisterClient(second)
+	join(t, h, newTestClient(h, "c5", "room3"))
+	if got := testutil.ToFloat64(metrics.ActiveRooms) - rooms; got != 2 {
+		t.Errorf("active rooms metric at %v over the start, want 2", got)
+	}
+}
@@ -0,0 +1,86 @@
+package hub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idleTracker notices when a client stops sending messages. The flags are
+// atomic so ToParticipant can read them under RoomsMu without lock ordering
+// concerns; mu only guards the timer.
+type idleTracker struct {
+	lastActive atomic.Int64 // unix nanoseconds of the last message
+	idle       atomic.Bool
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+// schedule runs fn after d unless the tracker has been stopped
+func (t *idleTracker) schedule(d time.Duration, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.timer = time.AfterFunc(d, fn)
+}
+
+// startIdleTimer begins watching a newly joined client for inactivity
+func (h *Hub) startIdleTimer(client *Client) {
+	if h.IdleTimeout <= 0 {
+		return
+	}
+	client.activity.lastActive.Store(time.Now().UnixNano())
+	client.activity.schedule(h.IdleTimeout, func() { h.checkIdle(client) })
+}
+
+// checkIdle marks the client idle if it has been quiet for IdleTimeout,
+// otherwise checks again when it could next become idle
+func (h *Hub) checkIdle(client *Client) {
+	t := &client.activity
+	quiet := time.Since(time.Unix(0, t.lastActive.Load()))
+	if remaining := h.IdleTimeout - quiet; remaining > 0 {
+		t.schedule(remaining, func() { h.checkIdle(client) })
+		return
+	}
+	if !t.idle.CompareAndSwap(false, true) {
+		return
+	}
+
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:          "participant_idle",
+		ParticipantID: client.ID,
+	}, client)
+}
+
+// markActive records a message from the client, announcing its return if
+// it had gone idle (called from ReadPump only)
+func (h *Hub) markActive(client *Client) {
+	if h.IdleTimeout <= 0 {
+		return
+	}
+	t := &client.activity
+	t.lastActive.Store(time.Now().UnixNano())
+	if !t.idle.CompareAndSwap(true, false) {
+		return
+	}
+
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:          "participant_active",
+		ParticipantID: client.ID,
+	}, client)
+	t.schedule(h.IdleTimeout, func() { h.checkIdle(client) })
+}
+
+// stopIdle cancels idle tracking for a departing client
+func (c *Client) stopIdle() {
+	c.activity.mu.Lock()
+	defer c.activity.mu.Unlock()
+	c.activity.stopped = true
+	if c.activity.timer != nil {
+		c.activity.timer.Stop()
+	}
+}
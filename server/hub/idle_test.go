@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParticipantIdle(t *testing.T) {
+	h := NewHub(nil)
+	h.IdleTimeout = 50 * time.Millisecond
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+	h.startIdleTimer(a)
+	defer a.stopIdle()
+
+	// Quiet for the timeout, a is announced idle once
+	start := time.Now()
+	if msg := receiveType(t, b, "participant_idle"); msg.ParticipantID != "a" {
+		t.Errorf("participant_idle for %q, want a", msg.ParticipantID)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("went idle after %v, before the timeout", waited)
+	}
+	if !a.ToParticipant().Idle {
+		t.Error("idle participant not marked idle")
+	}
+	expectNothing(t, b)
+
+	// Any message brings it back
+	h.HandleMessage(a, &ClientMessage{Type: "cursor_move", X: 1, Y: 1})
+	if msg := receiveType(t, b, "participant_active"); msg.ParticipantID != "a" {
+		t.Errorf("participant_active for %q, want a", msg.ParticipantID)
+	}
+	if a.ToParticipant().Idle {
+		t.Error("returning participant still marked idle")
+	}
+
+	// And the timer starts over
+	receiveType(t, b, "participant_idle")
+}
+
+func TestActivityDefersIdle(t *testing.T) {
+	h := NewHub(nil)
+	h.IdleTimeout = 100 * time.Millisecond
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+	h.startIdleTimer(a)
+	defer a.stopIdle()
+
+	// Messages more often than the timeout keep a active
+	for range 4 {
+		time.Sleep(40 * time.Millisecond)
+		h.markActive(a)
+	}
+	if a.ToParticipant().Idle {
+		t.Error("active participant marked idle")
+	}
+	for len(b.Send) > 0 {
+		var msg ServerMessage
+		if err := json.Unmarshal(<-b.Send, &msg); err == nil && msg.Type == "participant_idle" {
+			t.Error("participant_idle sent for an active participant")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// AddImage places an uploaded image in a room and tells everyone connected
+func (h *Hub) AddImage(ctx context.Context, img *models.Image) error {
+	img.RoundCoordinates(h.CoordinatePrecision)
+	if err := h.createImage(ctx, img); err != nil {
+		return err
+	}
+
+	h.broadcastToRoom(img.RoomID, &ServerMessage{
+		Type:  "image_add",
+		Image: img,
+	}, nil)
+	return nil
+}
+
+func (h *Hub) handleImageDelete(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.ImageID == "" {
+		return
+	}
+
+	img, err := h.deleteImage(ctx, client.RoomID, msg.ImageID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		h.sendError(client, "Image not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete image: %v", err)
+		h.sendError(client, "Failed to delete image")
+		return
+	}
+
+	// Images imported before imports copied their files share the source
+	// room's file and have no key of their own
+	if img.Key != "" {
+		h.DeleteUploads([]string{img.Key})
+	}
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "image_delete",
+		ImageID:         msg.ImageID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+// DeleteUploads removes the stored files of deleted images in the
+// background
+func (h *Hub) DeleteUploads(keys []string) {
+	if h.Uploads == nil || len(keys) == 0 {
+		return
+	}
+	go func() {
+		for _, key := range keys {
+			if err := h.Uploads.Delete(context.Background(), key); err != nil {
+				log.Printf("Failed to delete image file %s: %v", key, err)
+			}
+		}
+	}()
+}
+
+// HeldUploadKeys returns the storage keys of images only held in memory:
+// by ephemeral rooms, which have no database rows referencing their files,
+// and by clear snapshots that undo_clear can still restore
+func (h *Hub) HeldUploadKeys() map[string]bool {
+	keys := make(map[string]bool)
+	h.snapshotUploadKeys(keys)
+
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	for _, room := range h.ephemeralRooms {
+		room.mu.Lock()
+		for _, img := range room.state.Images {
+			if img.Key != "" {
+				keys[img.Key] = true
+			}
+		}
+		room.mu.Unlock()
+	}
+	return keys
+}
@@ -0,0 +1,56 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestImageDeleteRemovesUpload(t *testing.T) {
+	h := NewHub(nil)
+	store := uploadStore(t, "room/a.png", "room/b.png")
+	h.Uploads = store
+
+	client := newTestClient(h, "a", "room")
+	joinEphemeral(t, h, "room", client)
+	h.ephemeralRooms["room"].state.Images = []models.Image{
+		{ID: "i1", RoomID: "room", Key: "room/a.png"},
+		{ID: "i2", RoomID: "room", Key: "room/b.png"},
+	}
+	if held := h.HeldUploadKeys(); !held["room/a.png"] || !held["room/b.png"] {
+		t.Fatalf("held keys = %v, want both images' files", held)
+	}
+
+	h.HandleMessage(client, &ClientMessage{Type: "image_delete", ImageID: "i1"})
+
+	if uploadExists(store, "room/a.png") {
+		t.Error("file of a deleted image kept")
+	}
+	if !uploadExists(store, "room/b.png") {
+		t.Error("file of a remaining image deleted")
+	}
+	if held := h.HeldUploadKeys(); held["room/a.png"] || !held["room/b.png"] {
+		t.Errorf("held keys after delete = %v, want only room/b.png", held)
+	}
+}
+
+func TestGetImageElement(t *testing.T) {
+	h := NewHub(nil)
+	client := newTestClient(h, "a", "room")
+	joinEphemeral(t, h, "room", client)
+	h.ephemeralRooms["room"].state.Images = []models.Image{{ID: "i1", RoomID: "room", URL: "/uploads/room/a.png"}}
+
+	element, err := h.GetElement(context.Background(), "room", "image", "i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, ok := element.(*models.Image); !ok || img.ID != "i1" {
+		t.Errorf("GetElement = %+v, want image i1", element)
+	}
+	if _, err := h.GetElement(context.Background(), "room", "image", "missing"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("missing image: got %v, want pgx.ErrNoRows", err)
+	}
+}
@@ -2,25 +2,150 @@ package hub
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/dre4success/bethel/server/metrics"
 	"github.com/dre4success/bethel/server/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
+// readOnlyMessageTypes are the client messages that don't change the room
+var readOnlyMessageTypes = map[string]bool{
+	"cursor_move":  true,
+	"shutdown_ack": true,
+	"resync":       true,
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"set_name":     true,
+	"set_color":    true,
+}
+
+// isMutating reports whether a client message type changes room content
+func isMutating(msgType string) bool {
+	return !readOnlyMessageTypes[msgType]
+}
+
+// ownerMessageTypes are the client messages only the room's owner may send,
+// like the owner-token guarded HTTP routes, with the error others get
+var ownerMessageTypes = map[string]string{
+	"room_update":  "Only the room owner can rename the room",
+	"clear_all":    "Only the room owner can clear the room",
+	"undo_clear":   "Only the room owner can undo a clear",
+	"lock_element": "Only the room owner can lock elements",
+}
+
+// messageTypeLabel bounds the metric label to known message types
+func messageTypeLabel(msgType string) string {
+	for _, t := range clientMessageTypes {
+		if t == msgType {
+			return t
+		}
+	}
+	return "unknown"
+}
+
+// ProtocolVersion is bumped on incompatible changes to the message protocol
+const ProtocolVersion = 1
+
+// clientMessageTypes lists the message types HandleMessage understands
+var clientMessageTypes = []string{
+	"stroke_add",
+	"strokes_batch_add",
+	"stroke_update",
+	"stroke_delete",
+	"stroke_reorder",
+	"undo_delete",
+	"erase_region",
+	"text_add",
+	"text_update",
+	"text_diff",
+	"text_delete",
+	"text_editing_start",
+	"text_editing_stop",
+	"shape_add",
+	"shape_update",
+	"shape_delete",
+	"image_delete",
+	"cursor_move",
+	"room_update",
+	"clear_all",
+	"undo_clear",
+	"lock_element",
+	"lock",
+	"unlock",
+	"undo",
+	"redo",
+	"shutdown_ack",
+	"resync",
+	"subscribe",
+	"unsubscribe",
+	"set_name",
+	"set_color",
+}
+
+// Capabilities describes what the server supports, sent after connect
+type Capabilities struct {
+	ProtocolVersion  int      `json:"protocolVersion"`
+	MessageTypes     []string `json:"messageTypes"`
+	MaxMessageSize   int64    `json:"maxMessageSize"`
+	MaxStrokePoints  int      `json:"maxStrokePoints"`  // 0 means unlimited
+	CursorThrottleMs int      `json:"cursorThrottleMs"` // 0 means unthrottled
+	Tools            []string `json:"tools"`
+	Compression      bool     `json:"compression"`
+	StrokeMerging    bool     `json:"strokeMerging"`
+	ProtocolVersions []int    `json:"protocolVersions"` // offered as bethel.v<N> subprotocols
+	Codecs           []string `json:"codecs"`
+	MaxParticipants  int      `json:"maxParticipants"` // 0 means unlimited
+}
+
 // ClientMessage represents messages from client to server
 type ClientMessage struct {
 	Type string `json:"type"`
 
 	// For stroke operations
-	Stroke   *models.Stroke  `json:"stroke,omitempty"`
-	StrokeID string          `json:"strokeId,omitempty"`
-	Points   []models.Point  `json:"points,omitempty"`
+	Stroke   *models.Stroke `json:"stroke,omitempty"`
+	StrokeID string         `json:"strokeId,omitempty"`
+	Points   []models.Point `json:"points,omitempty"`
+
+	// For stroke_reorder (new stacking order, bottom to top)
+	StrokeIDs []string `json:"strokeIds,omitempty"`
+
+	// For strokes_batch_add (stacked in order, bottom to top)
+	Strokes []*models.Stroke `json:"strokes,omitempty"`
+
+	// For erase_region (area whose stroke geometry is removed)
+	Region *models.Region `json:"region,omitempty"`
+
+	// Pointer (finger/pen) a stroke belongs to, for multitouch
+	PointerID int `json:"pointerId,omitempty"`
+
+	// Marks the last stroke_update of a stroke (pen up)
+	Final bool `json:"final,omitempty"`
 
 	// For text operations
-	TextBlock     *models.TextBlock       `json:"textBlock,omitempty"`
-	TextBlockID   string                  `json:"textBlockId,omitempty"`
-	TextUpdates   *models.TextBlockUpdate `json:"updates,omitempty"`
+	TextBlock   *models.TextBlock       `json:"textBlock,omitempty"`
+	TextBlockID string                  `json:"textBlockId,omitempty"`
+	TextUpdates *models.TextBlockUpdate `json:"updates,omitempty"`
+	TextDiff    *models.TextDiff        `json:"diff,omitempty"`
+
+	// For text_update: the block's version as last seen; the update is
+	// rejected with a conflict if the block has moved on (unconditional when absent)
+	Version *int `json:"version,omitempty"`
+
+	// For shape operations
+	Shape        *models.Shape       `json:"shape,omitempty"`
+	ShapeID      string              `json:"shapeId,omitempty"`
+	ShapeUpdates *models.ShapeUpdate `json:"shapeUpdates,omitempty"`
+
+	// For image operations (images are added by uploading over HTTP)
+	ImageID string `json:"imageId,omitempty"`
 
 	// For cursor
 	X float64 `json:"x,omitempty"`
@@ -28,29 +153,95 @@ type ClientMessage struct {
 
 	// For room updates
 	RoomTitle string `json:"roomTitle,omitempty"`
+
+	// For element locking
+	Locked *bool `json:"locked,omitempty"`
+
+	// For lock and unlock (ElementType is "stroke" or "text")
+	ElementID   string `json:"elementId,omitempty"`
+	ElementType string `json:"elementType,omitempty"`
+
+	// For conditional clear_all (room updatedAt as last synced)
+	ExpectedUpdatedAt *time.Time `json:"expectedUpdatedAt,omitempty"`
+
+	// For resync (syncedAt from the last room_state or room_delta; full
+	// state is sent when absent)
+	Since *time.Time `json:"since,omitempty"`
+
+	// Sequence number chosen by the client for a mutating message; the
+	// server replies with an ack or nack carrying it once the change is
+	// saved. A stroke_update carrying one is written immediately rather
+	// than coalesced, so send it with the final update of a stroke.
+	ClientSeq *int64 `json:"clientSeq,omitempty"`
+
+	// For set_name and set_color
+	Name  string `json:"name,omitempty"`
+	Color string `json:"color,omitempty"`
+
+	// For subscribe and unsubscribe (Password for protected rooms)
+	RoomID   string `json:"roomId,omitempty"`
+	Password string `json:"password,omitempty"`
 }
 
 // ServerMessage represents messages from server to client
 type ServerMessage struct {
 	Type string `json:"type"`
 
+	// Room the message comes from, set only for rooms followed with subscribe
+	RoomID string `json:"roomId,omitempty"`
+
 	// For room_state
 	RoomState    *models.RoomState `json:"roomState,omitempty"`
 	Participants []Participant     `json:"participants,omitempty"`
 
-	// For participant events
-	Participant   *Participant `json:"participant,omitempty"`
-	ParticipantID string       `json:"participantId,omitempty"`
+	// For room_delta
+	RoomDelta *models.RoomDelta `json:"roomDelta,omitempty"`
+
+	// Server time the room_state or room_delta was read at; pass it back as
+	// since to resync
+	SyncedAt *time.Time `json:"syncedAt,omitempty"`
+
+	// For participant events (participant_update carries the new name and
+	// color), and attribution on element events
+	Participant     *Participant `json:"participant,omitempty"`
+	ParticipantID   string       `json:"participantId,omitempty"`
+	ParticipantName string       `json:"participantName,omitempty"`
+
+	// For participant_join and participant_leave: clients now in the room
+	ParticipantCount int `json:"participantCount,omitempty"`
 
 	// For stroke events
 	Stroke   *models.Stroke `json:"stroke,omitempty"`
 	StrokeID string         `json:"strokeId,omitempty"`
 	Points   []models.Point `json:"points,omitempty"`
 
+	// For stroke_reorder, and strokes_batch_created (server IDs, in batch order)
+	StrokeIDs []string `json:"strokeIds,omitempty"`
+
+	// For strokes_batch_add
+	Strokes []*models.Stroke `json:"strokes,omitempty"`
+
+	// For strokes_batch_created (the IDs the sender gave, matching StrokeIDs)
+	ClientStrokeIDs []string `json:"clientStrokeIds,omitempty"`
+
+	PointerID int `json:"pointerId,omitempty"`
+
 	// For text events
 	TextBlock   *models.TextBlock       `json:"textBlock,omitempty"`
 	TextBlockID string                  `json:"textBlockId,omitempty"`
 	TextUpdates *models.TextBlockUpdate `json:"updates,omitempty"`
+	TextDiff    *models.TextDiff        `json:"diff,omitempty"`
+	UpdatedBy   string                  `json:"updatedBy,omitempty"` // last editor, on text_update and text_diff
+	Version     int                     `json:"version,omitempty"`   // block version after text_update and text_diff
+
+	// For shape events
+	Shape        *models.Shape       `json:"shape,omitempty"`
+	ShapeID      string              `json:"shapeId,omitempty"`
+	ShapeUpdates *models.ShapeUpdate `json:"shapeUpdates,omitempty"`
+
+	// For image events
+	Image   *models.Image `json:"image,omitempty"`
+	ImageID string        `json:"imageId,omitempty"`
 
 	// For cursor
 	X     float64 `json:"x,omitempty"`
@@ -60,30 +251,150 @@ type ServerMessage struct {
 	// For room updates
 	RoomTitle string `json:"roomTitle,omitempty"`
 
-	// For errors
+	// For element locking
+	Locked *bool `json:"locked,omitempty"`
+
+	// For lock and unlock
+	ElementID   string `json:"elementId,omitempty"`
+	ElementType string `json:"elementType,omitempty"`
+
+	// For stroke_merge (stroke the sender's StrokeID was folded into)
+	MergedInto string `json:"mergedInto,omitempty"`
+
+	// For stroke_created (the ID the sender gave the stroke StrokeID)
+	ClientStrokeID string `json:"clientStrokeId,omitempty"`
+
+	// For state_checksum (same as RoomState.Checksum)
+	Checksum string `json:"checksum,omitempty"`
+
+	// For capabilities
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// For server_shutdown
+	ReconnectAfterMs int64 `json:"reconnectAfterMs,omitempty"`
+
+	// For ack and nack (the message's clientSeq, and for ack the ID of an
+	// element it created)
+	ClientSeq *int64 `json:"clientSeq,omitempty"`
+	ID        string `json:"id,omitempty"`
+
+	// For errors, and nack
 	Error string `json:"error,omitempty"`
 }
 
+// messageKind returns the element kind a server message carries, or "" if
+// it should reach every client regardless of filters
+func messageKind(msg *ServerMessage) string {
+	switch {
+	case strings.HasPrefix(msg.Type, "stroke_"), strings.HasPrefix(msg.Type, "strokes_"), msg.Type == "lock_element" && msg.StrokeID != "":
+		return KindStrokes
+	case strings.HasPrefix(msg.Type, "text_"), msg.Type == "lock_element" && msg.TextBlockID != "":
+		return KindText
+	case strings.HasPrefix(msg.Type, "shape_"):
+		return KindShapes
+	case strings.HasPrefix(msg.Type, "image_"):
+		return KindImages
+	case msg.Type == "cursor_move":
+		return KindCursors
+	}
+	return ""
+}
+
+// Capabilities reports the protocol features this hub supports
+func (h *Hub) Capabilities() *Capabilities {
+	return &Capabilities{
+		ProtocolVersion:  ProtocolVersion,
+		MessageTypes:     clientMessageTypes,
+		MaxMessageSize:   h.MaxMessageSize,
+		MaxStrokePoints:  h.MaxStrokePoints,
+		CursorThrottleMs: int(h.CursorInterval / time.Millisecond),
+		Tools:            h.Tools,
+		Compression:      h.Compression,
+		StrokeMerging:    h.StrokeMergeWindow > 0,
+		ProtocolVersions: SupportedProtocolVersions,
+		Codecs:           []string{CodecJSON, CodecMsgPack},
+		MaxParticipants:  h.MaxParticipants,
+	}
+}
+
 // HandleMessage processes incoming client messages
 func (h *Hub) HandleMessage(client *Client, msg *ClientMessage) {
-	ctx := context.Background()
+	// Clients turned away at registration (or already gone) have no room
+	// to act on and nowhere to send replies
+	if !h.isMember(client) {
+		return
+	}
+
+	ctx := client.Context()
+	metrics.MessagesTotal.WithLabelValues(messageTypeLabel(msg.Type)).Inc()
+	h.markActive(client)
+	h.recordActivity(client.RoomID)
+	if client.beginAck(msg) {
+		defer h.finishAck(client)
+	}
+
+	if client.ReadOnly && isMutating(msg.Type) {
+		h.sendError(client, "This room is view-only")
+		return
+	}
+	if errMsg, ok := ownerMessageTypes[msg.Type]; ok && !client.Owner {
+		h.sendError(client, errMsg)
+		return
+	}
+	client.resolveStrokeIDs(msg)
+	if h.blockedByLock(client, msg) {
+		return
+	}
 
 	switch msg.Type {
 	case "stroke_add":
 		h.handleStrokeAdd(ctx, client, msg)
 
+	case "strokes_batch_add":
+		h.handleStrokesBatchAdd(ctx, client, msg)
+
 	case "stroke_update":
 		h.handleStrokeUpdate(ctx, client, msg)
 
+	case "stroke_delete":
+		h.handleStrokeDelete(ctx, client, msg)
+
+	case "stroke_reorder":
+		h.handleStrokeReorder(ctx, client, msg)
+
+	case "undo_delete":
+		h.handleUndoDelete(ctx, client, msg)
+
+	case "erase_region":
+		h.handleEraseRegion(ctx, client, msg)
+
 	case "text_add":
 		h.handleTextAdd(ctx, client, msg)
 
 	case "text_update":
 		h.handleTextUpdate(ctx, client, msg)
 
+	case "text_diff":
+		h.handleTextDiff(ctx, client, msg)
+
 	case "text_delete":
 		h.handleTextDelete(ctx, client, msg)
 
+	case "text_editing_start", "text_editing_stop":
+		h.handleTextEditing(client, msg)
+
+	case "shape_add":
+		h.handleShapeAdd(ctx, client, msg)
+
+	case "shape_update":
+		h.handleShapeUpdate(ctx, client, msg)
+
+	case "shape_delete":
+		h.handleShapeDelete(ctx, client, msg)
+
+	case "image_delete":
+		h.handleImageDelete(ctx, client, msg)
+
 	case "cursor_move":
 		h.handleCursorMove(client, msg)
 
@@ -91,7 +402,43 @@ func (h *Hub) HandleMessage(client *Client, msg *ClientMessage) {
 		h.handleRoomUpdate(ctx, client, msg)
 
 	case "clear_all":
-		h.handleClearAll(ctx, client)
+		h.handleClearAll(ctx, client, msg)
+
+	case "undo_clear":
+		h.handleUndoClear(ctx, client)
+
+	case "lock_element":
+		h.handleLockElement(ctx, client, msg)
+
+	case "lock":
+		h.handleLock(client, msg)
+
+	case "unlock":
+		h.handleUnlock(client, msg)
+
+	case "undo":
+		h.handleUndo(ctx, client)
+
+	case "redo":
+		h.handleRedo(ctx, client)
+
+	case "shutdown_ack":
+		h.ackShutdown(client)
+
+	case "resync":
+		h.handleResync(client, msg)
+
+	case "subscribe":
+		h.handleSubscribe(ctx, client, msg)
+
+	case "unsubscribe":
+		h.handleUnsubscribe(client, msg)
+
+	case "set_name":
+		h.handleSetName(client, msg)
+
+	case "set_color":
+		h.handleSetColor(client, msg)
 
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
@@ -103,42 +450,346 @@ func (h *Hub) handleStrokeAdd(ctx context.Context, client *Client, msg *ClientMe
 		return
 	}
 
+	if h.tooManyPoints(client, len(msg.Stroke.Points)) {
+		return
+	}
+	if err := msg.Stroke.Validate(); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+	if !slices.Contains(h.Tools, msg.Stroke.Tool) {
+		h.sendError(client, fmt.Sprintf("Tool %q is not enabled", msg.Stroke.Tool))
+		return
+	}
+
+	// A retried message gets the original's ID back instead of a second copy
+	clientStrokeID := msg.Stroke.ID
+	fingerprint := strokeFingerprint(msg.Stroke)
+	if serverID, ok := h.duplicateStroke(client.RoomID, clientStrokeID, fingerprint); ok {
+		client.strokeAliases.add(clientStrokeID, serverID)
+		client.setAckID(serverID)
+		h.sendToClient(client, &ServerMessage{
+			Type:           "stroke_created",
+			StrokeID:       serverID,
+			ClientStrokeID: clientStrokeID,
+			PointerID:      msg.PointerID,
+		})
+		return
+	}
+
 	stroke := msg.Stroke
 	stroke.RoomID = client.RoomID
-	stroke.CreatedBy = client.ID
+	stroke.CreatedBy = client.author()
+	stroke.Locked = false
+	models.RoundPoints(stroke.Points, h.CoordinatePrecision)
+	if client.Simplify {
+		stroke.Points = models.SimplifyPoints(stroke.Points, h.SimplifyEpsilon)
+	}
+
+	if h.tryMergeStroke(ctx, client, msg.PointerID, stroke) {
+		return
+	}
+
+	// The server picks stroke IDs, so a client can't claim (and suppress)
+	// another client's stroke by reusing its ID
+	stroke.ID = uuid.New().String()
 
 	// Persist to database
-	if err := models.CreateStroke(ctx, h.DB, stroke); err != nil {
+	if err := h.createStroke(ctx, stroke); err != nil {
 		log.Printf("Failed to save stroke: %v", err)
 		h.sendError(client, "Failed to save stroke")
 		return
 	}
 
+	h.rememberStroke(client.RoomID, clientStrokeID, stroke.ID, fingerprint)
+	client.setAckID(stroke.ID)
+
+	// Tell the sender which ID its stroke got
+	if clientStrokeID != "" {
+		client.strokeAliases.add(clientStrokeID, stroke.ID)
+	}
+	h.sendToClient(client, &ServerMessage{
+		Type:           "stroke_created",
+		StrokeID:       stroke.ID,
+		ClientStrokeID: clientStrokeID,
+		PointerID:      msg.PointerID,
+	})
+
+	client.recordOperation(operation{kind: "stroke_add", strokeID: stroke.ID})
+
+	if client.openStrokes == nil {
+		client.openStrokes = make(map[int]*openStroke)
+	}
+	client.openStrokes[msg.PointerID] = &openStroke{stroke: stroke, at: time.Now()}
+
 	// Broadcast to other clients
 	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "stroke_add",
-		Stroke:        stroke,
-		ParticipantID: client.ID,
+		Type:            "stroke_add",
+		Stroke:          stroke,
+		PointerID:       msg.PointerID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+// handleStrokesBatchAdd stores many strokes at once (e.g. a paste). Every
+// stroke must be valid or none are stored.
+func (h *Hub) handleStrokesBatchAdd(ctx context.Context, client *Client, msg *ClientMessage) {
+	if len(msg.Strokes) == 0 {
+		return
+	}
+
+	for _, stroke := range msg.Strokes {
+		if stroke == nil {
+			h.sendError(client, "Batch contains an empty stroke")
+			return
+		}
+		if h.tooManyPoints(client, len(stroke.Points)) {
+			return
+		}
+		if err := stroke.Validate(); err != nil {
+			h.sendError(client, err.Error())
+			return
+		}
+		if !slices.Contains(h.Tools, stroke.Tool) {
+			h.sendError(client, fmt.Sprintf("Tool %q is not enabled", stroke.Tool))
+			return
+		}
+	}
+
+	clientStrokeIDs := make([]string, len(msg.Strokes))
+	strokeIDs := make([]string, len(msg.Strokes))
+	for i, stroke := range msg.Strokes {
+		clientStrokeIDs[i] = stroke.ID
+		stroke.ID = uuid.New().String()
+		stroke.RoomID = client.RoomID
+		stroke.CreatedBy = client.author()
+		stroke.Locked = false
+		models.RoundPoints(stroke.Points, h.CoordinatePrecision)
+		if client.Simplify {
+			stroke.Points = models.SimplifyPoints(stroke.Points, h.SimplifyEpsilon)
+		}
+		strokeIDs[i] = stroke.ID
+	}
+
+	if err := h.createStrokes(ctx, client.RoomID, msg.Strokes); err != nil {
+		log.Printf("Failed to save stroke batch: %v", err)
+		h.sendError(client, "Failed to save strokes")
+		return
+	}
+
+	for i, id := range clientStrokeIDs {
+		if id != "" {
+			client.strokeAliases.add(id, strokeIDs[i])
+		}
+	}
+	h.sendToClient(client, &ServerMessage{
+		Type:            "strokes_batch_created",
+		StrokeIDs:       strokeIDs,
+		ClientStrokeIDs: clientStrokeIDs,
+	})
+
+	// Broadcast to other clients as one event
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "strokes_batch_add",
+		Strokes:         msg.Strokes,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+// tooManyPoints rejects strokes longer than MaxStrokePoints, telling the client
+func (h *Hub) tooManyPoints(client *Client, n int) bool {
+	if h.MaxStrokePoints <= 0 || n <= h.MaxStrokePoints {
+		return false
+	}
+	h.sendError(client, fmt.Sprintf("Stroke has %d points, the limit is %d", n, h.MaxStrokePoints))
+	return true
+}
+
+// tryMergeStroke appends stroke to the client's previous stroke when merging is
+// enabled and the two are close enough in time and space. It reports whether
+// the stroke was merged (and announced) instead of needing its own row.
+func (h *Hub) tryMergeStroke(ctx context.Context, client *Client, pointerID int, stroke *models.Stroke) bool {
+	open := client.openStrokes[pointerID]
+	if h.StrokeMergeWindow <= 0 || open == nil || len(open.stroke.Points) == 0 || len(stroke.Points) == 0 {
+		return false
+	}
+	prev := open.stroke
+	if prev.Color != stroke.Color || prev.Tool != stroke.Tool || time.Since(open.at) > h.StrokeMergeWindow {
+		return false
+	}
+	if h.MaxStrokePoints > 0 && len(prev.Points)+len(stroke.Points) > h.MaxStrokePoints {
+		return false
+	}
+	if h.StrokeMergeDistance > 0 {
+		end, start := prev.Points[len(prev.Points)-1], stroke.Points[0]
+		if math.Hypot(start.X-end.X, start.Y-end.Y) > h.StrokeMergeDistance {
+			return false
+		}
+	}
+
+	points := append(append([]models.Point{}, prev.Points...), stroke.Points...)
+	h.cancelPendingPoints(prev.ID)
+	if err := h.updateStrokePoints(ctx, client.RoomID, prev.ID, points); err != nil {
+		// Locked or failed; fall back to storing the stroke on its own
+		return false
+	}
+	prev.Points = points
+	open.at = time.Now()
+
+	// The sender drops its local copy in favour of the merged stroke
+	h.sendToClient(client, &ServerMessage{
+		Type:       "stroke_merge",
+		StrokeID:   stroke.ID,
+		MergedInto: prev.ID,
+		Points:     points,
+		PointerID:  pointerID,
+	})
+
+	// Everyone else just sees the previous stroke grow
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "stroke_update",
+		StrokeID:        prev.ID,
+		Points:          points,
+		PointerID:       pointerID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}, client)
+
+	return true
 }
 
 func (h *Hub) handleStrokeUpdate(ctx context.Context, client *Client, msg *ClientMessage) {
+	// resolveStrokeIDs routed an update without an ID to this stroke
+	open := client.openStrokes[msg.PointerID]
+
 	if msg.StrokeID == "" || msg.Points == nil {
 		return
 	}
+	if h.tooManyPoints(client, len(msg.Points)) {
+		return
+	}
+	if err := models.ValidatePoints(msg.Points); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+	models.RoundPoints(msg.Points, h.CoordinatePrecision)
 
-	// Update in database
-	if err := models.UpdateStrokePoints(ctx, h.DB, msg.StrokeID, msg.Points); err != nil {
+	// Update in database (coalesced; broadcast below stays immediate). An
+	// update awaiting an ack is written now so the ack reports the write.
+	final := msg.Final || client.ack.Load() != nil
+	if err := h.queueStrokePoints(ctx, client.RoomID, msg.StrokeID, msg.Points, final); err != nil {
+		if errors.Is(err, models.ErrLocked) {
+			h.sendError(client, "Stroke is locked")
+			return
+		}
 		log.Printf("Failed to update stroke: %v", err)
+		h.sendError(client, "Failed to update stroke")
 		return
 	}
 
+	if open != nil && open.stroke.ID == msg.StrokeID {
+		open.stroke.Points = msg.Points
+		open.at = time.Now()
+	}
+
 	// Broadcast to other clients
 	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "stroke_update",
-		StrokeID:      msg.StrokeID,
-		Points:        msg.Points,
-		ParticipantID: client.ID,
+		Type:            "stroke_update",
+		StrokeID:        msg.StrokeID,
+		Points:          msg.Points,
+		PointerID:       msg.PointerID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+func (h *Hub) handleStrokeDelete(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.StrokeID == "" {
+		return
+	}
+
+	// Soft-delete so the stroke can be restored with undo_delete
+	if err := h.deleteStroke(ctx, client.RoomID, msg.StrokeID); err != nil {
+		if errors.Is(err, models.ErrLocked) {
+			h.sendError(client, "Stroke is locked")
+			return
+		}
+		log.Printf("Failed to delete stroke: %v", err)
+		h.sendError(client, "Failed to delete stroke")
+		return
+	}
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "stroke_delete",
+		StrokeID:        msg.StrokeID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+// handleStrokeReorder restacks strokes among the positions they already
+// hold, so e.g. [b, a] moves a above b without touching anything else
+func (h *Hub) handleStrokeReorder(ctx context.Context, client *Client, msg *ClientMessage) {
+	if len(msg.StrokeIDs) < 2 {
+		return
+	}
+	seen := make(map[string]bool, len(msg.StrokeIDs))
+	for _, id := range msg.StrokeIDs {
+		if seen[id] {
+			h.sendError(client, "Duplicate stroke in reorder")
+			return
+		}
+		seen[id] = true
+	}
+
+	if err := h.reorderStrokes(ctx, client.RoomID, msg.StrokeIDs); err != nil {
+		if errors.Is(err, models.ErrLocked) {
+			h.sendError(client, "Stroke is locked")
+			return
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.sendError(client, "Stroke not found")
+			return
+		}
+		log.Printf("Failed to reorder strokes: %v", err)
+		h.sendError(client, "Failed to reorder strokes")
+		return
+	}
+
+	// Broadcast to other clients (the sender applied it optimistically)
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "stroke_reorder",
+		StrokeIDs:       msg.StrokeIDs,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+func (h *Hub) handleUndoDelete(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.StrokeID == "" {
+		return
+	}
+
+	stroke, err := h.restoreStroke(ctx, client.RoomID, msg.StrokeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		h.sendError(client, "Stroke cannot be restored")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to restore stroke: %v", err)
+		h.sendError(client, "Failed to restore stroke")
+		return
+	}
+
+	// Other clients see the stroke come back
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "stroke_add",
+		Stroke:          stroke,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}, client)
 }
 
@@ -146,22 +797,36 @@ func (h *Hub) handleTextAdd(ctx context.Context, client *Client, msg *ClientMess
 	if msg.TextBlock == nil {
 		return
 	}
+	msg.TextBlock.ApplyDefaults()
+	if err := msg.TextBlock.Validate(); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
 
 	textBlock := msg.TextBlock
 	textBlock.RoomID = client.RoomID
+	textBlock.CreatedBy = client.author()
+	textBlock.Locked = false
+	textBlock.RoundCoordinates(h.CoordinatePrecision)
 
 	// Persist to database
-	if err := models.CreateTextBlock(ctx, h.DB, textBlock); err != nil {
+	if err := h.createTextBlock(ctx, textBlock); err != nil {
 		log.Printf("Failed to save text block: %v", err)
 		h.sendError(client, "Failed to save text block")
 		return
 	}
 
+	client.setAckID(textBlock.ID)
+
+	saved := *textBlock
+	client.recordOperation(operation{kind: "text_add", textBlock: &saved})
+
 	// Broadcast to other clients
 	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "text_add",
-		TextBlock:     textBlock,
-		ParticipantID: client.ID,
+		Type:            "text_add",
+		TextBlock:       textBlock,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}, client)
 }
 
@@ -169,55 +834,226 @@ func (h *Hub) handleTextUpdate(ctx context.Context, client *Client, msg *ClientM
 	if msg.TextBlockID == "" || msg.TextUpdates == nil {
 		return
 	}
+	if err := msg.TextUpdates.Validate(); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+	msg.TextUpdates.RoundCoordinates(h.CoordinatePrecision)
 
 	// Update in database
-	if err := models.UpdateTextBlock(ctx, h.DB, msg.TextBlockID, msg.TextUpdates); err != nil {
+	version, err := h.updateTextBlock(ctx, client.RoomID, msg.TextBlockID, msg.TextUpdates, client.author(), msg.Version)
+	if err != nil {
+		if errors.Is(err, models.ErrLocked) {
+			h.sendError(client, "Text block is locked")
+			return
+		}
+		if errors.Is(err, models.ErrStaleVersion) {
+			h.sendTextConflict(ctx, client, msg.TextBlockID)
+			return
+		}
 		log.Printf("Failed to update text block: %v", err)
+		h.sendError(client, "Failed to update text block")
+		return
+	}
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "text_update",
+		TextBlockID:     msg.TextBlockID,
+		TextUpdates:     msg.TextUpdates,
+		UpdatedBy:       client.author(),
+		Version:         version,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+func (h *Hub) handleTextDiff(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.TextBlockID == "" || msg.TextDiff == nil {
+		return
+	}
+
+	// Apply against the stored content
+	version, err := h.applyTextDiff(ctx, client.RoomID, msg.TextBlockID, msg.TextDiff, client.author())
+	if err != nil {
+		if errors.Is(err, models.ErrLocked) {
+			h.sendError(client, "Text block is locked")
+			return
+		}
+		if errors.Is(err, models.ErrInvalidDiff) {
+			h.sendTextResync(ctx, client, msg.TextBlockID)
+			return
+		}
+		log.Printf("Failed to apply text diff: %v", err)
+		h.sendError(client, "Failed to update text block")
 		return
 	}
 
 	// Broadcast to other clients
 	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "text_update",
-		TextBlockID:   msg.TextBlockID,
-		TextUpdates:   msg.TextUpdates,
-		ParticipantID: client.ID,
+		Type:            "text_diff",
+		TextBlockID:     msg.TextBlockID,
+		TextDiff:        msg.TextDiff,
+		UpdatedBy:       client.author(),
+		Version:         version,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}, client)
 }
 
+// sendTextResync sends the client the authoritative copy of a text block
+func (h *Hub) sendTextResync(ctx context.Context, client *Client, textBlockID string) {
+	textBlock, err := h.getTextBlock(ctx, client.RoomID, textBlockID)
+	if err != nil {
+		log.Printf("Failed to load text block for resync: %v", err)
+		h.sendError(client, "Failed to load text block")
+		return
+	}
+
+	h.sendToClient(client, &ServerMessage{
+		Type:      "text_resync",
+		TextBlock: textBlock,
+	})
+}
+
+// sendTextConflict tells the client its text_update was based on a stale
+// version, with the current copy of the block to resync from
+func (h *Hub) sendTextConflict(ctx context.Context, client *Client, textBlockID string) {
+	textBlock, err := h.getTextBlock(ctx, client.RoomID, textBlockID)
+	if err != nil {
+		log.Printf("Failed to load text block for conflict: %v", err)
+		h.sendError(client, "Failed to load text block")
+		return
+	}
+
+	h.sendToClient(client, &ServerMessage{
+		Type:        "conflict",
+		TextBlockID: textBlockID,
+		TextBlock:   textBlock,
+		Error:       "Text block changed since your version",
+	})
+}
+
 func (h *Hub) handleTextDelete(ctx context.Context, client *Client, msg *ClientMessage) {
 	if msg.TextBlockID == "" {
 		return
 	}
 
+	// Keep a copy so the delete can be undone
+	saved, err := h.getTextBlock(ctx, client.RoomID, msg.TextBlockID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		h.sendError(client, "Text block not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load text block before delete: %v", err)
+		h.sendError(client, "Failed to delete text block")
+		return
+	}
+
 	// Delete from database
-	if err := models.DeleteTextBlock(ctx, h.DB, msg.TextBlockID); err != nil {
+	if err := h.deleteTextBlock(ctx, client.RoomID, msg.TextBlockID); err != nil {
+		if errors.Is(err, models.ErrLocked) {
+			h.sendError(client, "Text block is locked")
+			return
+		}
 		log.Printf("Failed to delete text block: %v", err)
+		h.sendError(client, "Failed to delete text block")
 		return
 	}
 
+	client.recordOperation(operation{kind: "text_delete", textBlock: saved})
+
 	// Broadcast to other clients
 	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "text_delete",
-		TextBlockID:   msg.TextBlockID,
-		ParticipantID: client.ID,
+		Type:            "text_delete",
+		TextBlockID:     msg.TextBlockID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}, client)
 }
 
-func (h *Hub) handleCursorMove(client *Client, msg *ClientMessage) {
-	// Broadcast cursor position to other clients (no persistence needed)
-	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "cursor_move",
-		X:             msg.X,
-		Y:             msg.Y,
-		Color:         client.Color,
-		ParticipantID: client.ID,
-	}, client)
+// ClearRoom removes all content from a room on behalf of an HTTP caller and
+// tells everyone connected to it
+func (h *Hub) ClearRoom(ctx context.Context, roomID string) error {
+	// Participants holding elements are mid-edit
+	if h.roomHeldByOther(roomID, nil) {
+		return models.ErrLocked
+	}
+	if err := h.clearRoom(ctx, roomID, nil); err != nil {
+		log.Printf("Failed to clear room %s: %v", roomID, err)
+		return err
+	}
+
+	h.broadcastToRoom(roomID, &ServerMessage{Type: "clear_all"}, nil)
+	return nil
+}
+
+// DeleteStroke removes a stroke on behalf of an HTTP caller (e.g. a
+// moderator) and tells everyone in the room. It returns pgx.ErrNoRows if the
+// stroke isn't live in the room and models.ErrLocked if it is locked or a
+// participant holds it.
+func (h *Hub) DeleteStroke(ctx context.Context, roomID, strokeID string) error {
+	if _, err := h.getStroke(ctx, roomID, strokeID); err != nil {
+		return err
+	}
+	if h.heldByOther(roomID, nil, ElementStroke, strokeID) {
+		return models.ErrLocked
+	}
+
+	h.cancelPendingPoints(strokeID)
+	if err := h.deleteStroke(ctx, roomID, strokeID); err != nil {
+		return err
+	}
+
+	h.broadcastToRoom(roomID, &ServerMessage{Type: "stroke_delete", StrokeID: strokeID}, nil)
+	return nil
 }
 
-func (h *Hub) handleClearAll(ctx context.Context, client *Client) {
+// GetElement returns a room's element for an HTTP caller, read from memory
+// for ephemeral rooms. elementType is "stroke", "text", "shape" or "image"; it
+// returns pgx.ErrNoRows if the room has no such element.
+func (h *Hub) GetElement(ctx context.Context, roomID, elementType, id string) (any, error) {
+	switch elementType {
+	case "stroke":
+		h.FlushPendingStrokes()
+		return h.getStroke(ctx, roomID, id)
+	case "text":
+		return h.getTextBlock(ctx, roomID, id)
+	case "shape":
+		return h.getShape(ctx, roomID, id)
+	case "image":
+		return h.getImage(ctx, roomID, id)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// RenameRoom tells everyone in a room that an HTTP caller renamed it. The
+// title must already be saved with models.UpdateRoomTitle
+func (h *Hub) RenameRoom(roomID string, title string) {
+	h.withEphemeral(roomID, func(state *models.RoomState) error {
+		state.Room.Title = title
+		return nil
+	})
+
+	h.broadcastToRoom(roomID, &ServerMessage{Type: "room_renamed", RoomTitle: title}, nil)
+}
+
+func (h *Hub) handleClearAll(ctx context.Context, client *Client, msg *ClientMessage) {
+	if h.roomHeldByOther(client.RoomID, client) {
+		h.sendError(client, "Elements are locked by other participants")
+		return
+	}
+
 	// Clear room content in database
-	if err := models.ClearRoom(ctx, h.DB, client.RoomID); err != nil {
+	if err := h.clearRoom(ctx, client.RoomID, msg.ExpectedUpdatedAt); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			h.sendToClient(client, &ServerMessage{
+				Type:  "conflict",
+				Error: "Room changed since last sync",
+			})
+			return
+		}
 		log.Printf("Failed to clear room: %v", err)
 		h.sendError(client, "Failed to clear room")
 		return
@@ -227,50 +1063,78 @@ func (h *Hub) handleClearAll(ctx context.Context, client *Client) {
 	h.RoomsMu.RLock()
 	defer h.RoomsMu.RUnlock()
 
-	msg := &ServerMessage{
-		Type:          "clear_all",
-		ParticipantID: client.ID,
+	out := &ServerMessage{
+		Type:            "clear_all",
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}
 
-	data, _ := json.Marshal(msg)
+	h.broadcastToRoomUnsafe(client.RoomID, out, nil)
+}
 
-	if room, ok := h.Rooms[client.RoomID]; ok {
-		for c := range room {
-			select {
-			case c.Send <- data:
-			default:
-			}
-		}
+func (h *Hub) handleLockElement(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.Locked == nil || (msg.StrokeID == "" && msg.TextBlockID == "") {
+		return
+	}
+
+	// Persist to database
+	var err error
+	if msg.StrokeID != "" {
+		err = h.setStrokeLocked(ctx, client.RoomID, msg.StrokeID, *msg.Locked)
+	} else {
+		err = h.setTextBlockLocked(ctx, client.RoomID, msg.TextBlockID, *msg.Locked)
 	}
+	if err != nil {
+		log.Printf("Failed to lock element: %v", err)
+		h.sendError(client, "Failed to lock element")
+		return
+	}
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "lock_element",
+		StrokeID:        msg.StrokeID,
+		TextBlockID:     msg.TextBlockID,
+		Locked:          msg.Locked,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
 }
 
 func (h *Hub) handleRoomUpdate(ctx context.Context, client *Client, msg *ClientMessage) {
-	if msg.RoomTitle == "" {
+	// Validated like PUT /api/rooms/{id}
+	title, err := models.NormalizeTitle(msg.RoomTitle)
+	if err != nil {
+		h.sendError(client, "Invalid title: "+err.Error())
 		return
 	}
 
 	// Persist to database
-	if err := models.UpdateRoomTitle(ctx, h.DB, client.RoomID, msg.RoomTitle); err != nil {
+	if err := models.UpdateRoomTitle(ctx, h.DB, client.RoomID, title); err != nil {
 		log.Printf("Failed to update room title: %v", err)
+		h.sendError(client, "Failed to rename room")
 		return
 	}
+	h.withEphemeral(client.RoomID, func(state *models.RoomState) error {
+		state.Room.Title = title
+		return nil
+	})
 
 	// Broadcast to other clients (optimistic update on sender side)
 	h.broadcastToRoom(client.RoomID, &ServerMessage{
-		Type:          "room_update",
-		RoomTitle:     msg.RoomTitle,
-		ParticipantID: client.ID,
+		Type:            "room_update",
+		RoomTitle:       title,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
 	}, client)
 }
 
 func (h *Hub) sendError(client *Client, errMsg string) {
+	client.noteFailure(errMsg)
 	msg := &ServerMessage{
 		Type:  "error",
 		Error: errMsg,
 	}
-	data, _ := json.Marshal(msg)
-	select {
-	case client.Send <- data:
-	default:
-	}
+	data, _ := client.marshal(msg)
+	h.trySend(client, data)
 }
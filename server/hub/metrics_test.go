@@ -0,0 +1,66 @@
+package hub
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dre4success/bethel/server/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	h := NewHub(nil)
+	rooms := testutil.ToFloat64(metrics.ActiveRooms)
+	conns := testutil.ToFloat64(metrics.ActiveConnections)
+	cursors := testutil.ToFloat64(metrics.MessagesTotal.WithLabelValues("cursor_move"))
+	unknown := testutil.ToFloat64(metrics.MessagesTotal.WithLabelValues("unknown"))
+	drops := testutil.ToFloat64(metrics.SendBufferDrops)
+
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	join(t, h, a)
+	join(t, h, b)
+	h.HandleMessage(a, &ClientMessage{Type: "cursor_move", X: 1, Y: 1})
+	h.HandleMessage(a, &ClientMessage{Type: "made_up"})
+
+	// A client that stops reading loses messages once its buffer fills
+	slow := &Client{ID: "slow", RoomID: "other", Hub: h, Send: make(chan []byte, 1)}
+	join(t, h, slow)
+	drain(slow)
+	h.trySend(slow, []byte("{}"))
+	h.trySend(slow, []byte("{}"))
+
+	if got := testutil.ToFloat64(metrics.ActiveRooms) - rooms; got != 2 {
+		t.Errorf("active rooms rose by %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.ActiveConnections) - conns; got != 3 {
+		t.Errorf("active connections rose by %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(metrics.MessagesTotal.WithLabelValues("cursor_move")) - cursors; got != 1 {
+		t.Errorf("cursor_move count rose by %v, want 1", got)
+	}
+	// Unrecognized types share one label so clients can't grow the series
+	if got := testutil.ToFloat64(metrics.MessagesTotal.WithLabelValues("unknown")) - unknown; got != 1 {
+		t.Errorf("unknown message count rose by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.SendBufferDrops) - drops; got != 1 {
+		t.Errorf("send buffer drops rose by %v, want 1", got)
+	}
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, name := range []string{
+		"bethel_active_rooms",
+		"bethel_active_connections",
+		"bethel_messages_total",
+		"bethel_send_buffer_drops_total",
+	} {
+		if !strings.Contains(string(body), "\n"+name) {
+			t.Errorf("/metrics is missing %s", name)
+		}
+	}
+}
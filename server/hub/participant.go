@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// handleSetName renames the client and announces it with participant_update
+func (h *Hub) handleSetName(client *Client, msg *ClientMessage) {
+	if utf8.RuneCountInString(msg.Name) > MaxNameLength {
+		h.sendError(client, fmt.Sprintf("Name must be at most %d characters", MaxNameLength))
+		return
+	}
+	name := SanitizeName(msg.Name)
+	if name == "" {
+		h.sendError(client, "Name required")
+		return
+	}
+
+	h.RoomsMu.Lock()
+	defer h.RoomsMu.Unlock()
+
+	client.Name = name
+	client.guestNumber = 0
+	h.broadcastParticipantUpdateUnsafe(client)
+}
+
+// handleSetColor changes the client's color to a free #RRGGBB color and
+// announces it with participant_update
+func (h *Hub) handleSetColor(client *Client, msg *ClientMessage) {
+	if err := models.ValidateColor("color", msg.Color); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+
+	h.RoomsMu.Lock()
+	defer h.RoomsMu.Unlock()
+
+	for c := range h.Rooms[client.RoomID] {
+		if c != client && strings.EqualFold(c.Color, msg.Color) {
+			h.sendError(client, "Color is already in use")
+			return
+		}
+	}
+	client.Color = msg.Color
+	h.broadcastParticipantUpdateUnsafe(client)
+}
+
+// broadcastParticipantUpdateUnsafe sends the client's participant info to
+// everyone in its room, the client included; the caller holds RoomsMu
+func (h *Hub) broadcastParticipantUpdateUnsafe(client *Client) {
+	participant := client.ToParticipant()
+	h.broadcastToRoomUnsafe(client.RoomID, &ServerMessage{
+		Type:        "participant_update",
+		Participant: &participant,
+	}, nil)
+}
@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetName(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	a.Name = ""
+	b := newTestClient(h, "b", "room")
+	join(t, h, a)
+	join(t, h, b)
+	drain(a)
+	drain(b)
+
+	h.HandleMessage(a, &ClientMessage{Type: "set_name", Name: "  Ada\tLovelace "})
+	for _, c := range []*Client{a, b} {
+		msg := receiveType(t, c, "participant_update")
+		if msg.Participant == nil || msg.Participant.ID != "a" || msg.Participant.Name != "Ada Lovelace" {
+			t.Errorf("%s got participant_update %+v, want a renamed Ada Lovelace", c.ID, msg.Participant)
+		}
+	}
+	if a.guestNumber != 0 {
+		t.Errorf("renamed guest keeps guest number %d", a.guestNumber)
+	}
+
+	// Overlong and blank names are refused
+	for _, name := range []string{strings.Repeat("x", MaxNameLength+1), " \t "} {
+		h.HandleMessage(a, &ClientMessage{Type: "set_name", Name: name})
+		receiveType(t, a, "error")
+		expectNothing(t, b)
+	}
+	if a.Name != "Ada Lovelace" {
+		t.Errorf("name = %q after rejected changes", a.Name)
+	}
+}
+
+func TestSetColor(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	join(t, h, a)
+	join(t, h, b)
+	drain(a)
+	drain(b)
+	original := a.Color
+
+	for _, color := range []string{"red", "#12345", "#GGGGGG", b.Color, strings.ToLower(b.Color)} {
+		h.HandleMessage(a, &ClientMessage{Type: "set_color", Color: color})
+		if msg := receiveType(t, a, "error"); msg.Error == "" {
+			t.Errorf("set_color %q: empty error", color)
+		}
+		expectNothing(t, b)
+	}
+	if a.Color != original {
+		t.Errorf("color = %q after rejected changes, want %q", a.Color, original)
+	}
+
+	h.HandleMessage(a, &ClientMessage{Type: "set_color", Color: "#123456"})
+	if msg := receiveType(t, b, "participant_update"); msg.Participant == nil || msg.Participant.Color != "#123456" {
+		t.Errorf("participant_update %+v, want the new color", msg.Participant)
+	}
+	if a.Color != "#123456" {
+		t.Errorf("color = %q, want #123456", a.Color)
+	}
+}
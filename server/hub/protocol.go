@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SubprotocolPrefix names this server's WebSocket subprotocols; clients
+// offer "bethel.v<version>" in Sec-WebSocket-Protocol
+const SubprotocolPrefix = "bethel.v"
+
+// SupportedProtocolVersions lists the protocol versions the hub can speak
+var SupportedProtocolVersions = []int{ProtocolVersion}
+
+// Subprotocol returns the subprotocol name of a protocol version
+func Subprotocol(version int) string {
+	return SubprotocolPrefix + strconv.Itoa(version)
+}
+
+// NegotiateProtocol picks the newest supported protocol version among the
+// subprotocols a client offered, returning the subprotocol to accept with.
+// Clients offering none of ours get the current version and no subprotocol.
+// Clients offering only unsupported versions get an error, along with an
+// offered subprotocol to complete the handshake with so the rejection can
+// be delivered as a close frame.
+func NegotiateProtocol(offered []string) (version int, subprotocol string, err error) {
+	var ours []string
+	for _, p := range offered {
+		v, ok := strings.CutPrefix(p, SubprotocolPrefix)
+		if !ok {
+			continue
+		}
+		ours = append(ours, p)
+		if n, err := strconv.Atoi(v); err == nil && n > version && isSupportedVersion(n) {
+			version, subprotocol = n, p
+		}
+	}
+
+	switch {
+	case version > 0:
+		return version, subprotocol, nil
+	case len(ours) == 0:
+		return ProtocolVersion, "", nil
+	default:
+		return 0, ours[0], fmt.Errorf("unsupported protocol %s, this server speaks %s", strings.Join(ours, ", "), Subprotocol(ProtocolVersion))
+	}
+}
+
+func isSupportedVersion(version int) bool {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package hub
+
+import "testing"
+
+func TestNegotiateProtocol(t *testing.T) {
+	supported := SupportedProtocolVersions
+	t.Cleanup(func() { SupportedProtocolVersions = supported })
+	SupportedProtocolVersions = []int{1, 2}
+
+	tests := []struct {
+		offered     []string
+		version     int
+		subprotocol string
+		wantErr     bool
+	}{
+		{nil, ProtocolVersion, "", false},
+		{[]string{"graphql-ws"}, ProtocolVersion, "", false},
+		{[]string{"bethel.v1"}, 1, "bethel.v1", false},
+		{[]string{"graphql-ws", "bethel.v1"}, 1, "bethel.v1", false},
+		{[]string{"bethel.v1", "bethel.v2"}, 2, "bethel.v2", false},
+		{[]string{"bethel.v99", "bethel.v1"}, 1, "bethel.v1", false},
+		{[]string{"bethel.v99"}, 0, "bethel.v99", true},
+		{[]string{"bethel.vnext", "bethel.v0"}, 0, "bethel.vnext", true},
+	}
+	for _, tt := range tests {
+		version, subprotocol, err := NegotiateProtocol(tt.offered)
+		if version != tt.version || subprotocol != tt.subprotocol || (err != nil) != tt.wantErr {
+			t.Errorf("NegotiateProtocol(%v) = %d, %q, %v; want %d, %q, error %v",
+				tt.offered, version, subprotocol, err, tt.version, tt.subprotocol, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package hub
+
+import "time"
+
+// tokenBucket allows bursts up to its capacity and refills at rate tokens
+// per second. It is touched from a single ReadPump, so it needs no locking.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, capacity: rate, tokens: rate, last: now}
+}
+
+// allow takes a token if one is available
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// throttle reports whether the client's next message should be dropped and
+// whether the client has exceeded the limit long enough to be disconnected.
+// Clients are warned once per burst of dropped messages.
+func (c *Client) throttle() (drop bool, disconnect bool) {
+	if c.Hub.MessageRate <= 0 {
+		return false, false
+	}
+
+	now := time.Now()
+	if c.limiter == nil {
+		c.limiter = newTokenBucket(c.Hub.MessageRate, now)
+	}
+
+	if c.limiter.allow(now) {
+		c.dropped = 0
+		return false, false
+	}
+
+	c.dropped++
+	if c.dropped == 1 {
+		c.Hub.sendError(c, "Rate limit exceeded, messages are being dropped")
+	}
+
+	// Dropping a further second's worth of messages counts as abuse
+	if float64(c.dropped) > c.Hub.MessageRate {
+		c.Hub.sendError(c, "Rate limit exceeded, disconnecting")
+		return true, true
+	}
+	return true, false
+}
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(5, now)
+
+	for i := 0; i < 5; i++ {
+		if !b.allow(now) {
+			t.Fatalf("message %d of the burst was refused", i+1)
+		}
+	}
+	if b.allow(now) {
+		t.Fatal("bucket allowed more than its capacity")
+	}
+
+	// A fifth of a second refills one token at 5/s
+	now = now.Add(200 * time.Millisecond)
+	if !b.allow(now) {
+		t.Fatal("bucket did not refill")
+	}
+	if b.allow(now) {
+		t.Fatal("bucket refilled more than one token")
+	}
+
+	// Refilling stops at the capacity
+	now = now.Add(time.Minute)
+	for i := 0; i < 5; i++ {
+		b.allow(now)
+	}
+	if b.allow(now) {
+		t.Fatal("bucket refilled past its capacity")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	h := NewHub(nil)
+	h.MessageRate = 5
+	client := &Client{ID: "c1", Hub: h, Send: make(chan []byte, 16)}
+
+	for i := 0; i < 5; i++ {
+		if drop, _ := client.throttle(); drop {
+			t.Fatalf("message %d within the rate was dropped", i+1)
+		}
+	}
+
+	// Messages over the rate are dropped, with a single warning
+	for i := 0; i < 5; i++ {
+		drop, disconnect := client.throttle()
+		if !drop || disconnect {
+			t.Fatalf("over-limit message %d: drop=%v disconnect=%v", i+1, drop, disconnect)
+		}
+	}
+	if len(client.Send) != 1 {
+		t.Fatalf("got %d warnings, want 1", len(client.Send))
+	}
+
+	// Another second's worth of dropped messages disconnects
+	if _, disconnect := client.throttle(); !disconnect {
+		t.Fatal("sustained flood did not disconnect")
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	h := NewHub(nil)
+	h.MessageRate = 0
+	client := &Client{ID: "c1", Hub: h, Send: make(chan []byte, 1)}
+
+	for i := 0; i < 1000; i++ {
+		if drop, disconnect := client.throttle(); drop || disconnect {
+			t.Fatal("throttled with rate limiting disabled")
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"github.com/dre4success/bethel/server/metrics"
+	"github.com/dre4success/bethel/server/models"
+)
+
+// handleResync brings a client's copy of the room up to date, sending only
+// what changed since its last sync when it says when that was
+func (h *Hub) handleResync(client *Client, msg *ClientMessage) {
+	if msg.Since == nil {
+		go h.sendRoomState(client)
+		return
+	}
+	go h.sendRoomDelta(client, *msg.Since)
+}
+
+// sendRoomDelta sends the client a room_delta of changes after since
+func (h *Hub) sendRoomDelta(client *Client, since time.Time) {
+	ctx := client.Context()
+
+	start := time.Now()
+	delta, err := models.GetRoomDelta(ctx, h.DB, client.Tenant, client.RoomID, since)
+	metrics.ObserveQuery("room_delta", start)
+	if err != nil {
+		log.Printf("Failed to get room delta for %s: %v", client.RoomID, err)
+		h.sendError(client, "Room not found")
+		return
+	}
+
+	// Ephemeral rooms serve content from memory, which isn't timestamped
+	// for every change, so they always get the full state
+	if delta.Room.Ephemeral {
+		h.sendRoomState(client)
+		return
+	}
+
+	go h.recordSession(client, time.Time{})
+
+	// Leave out content the client asked not to receive
+	if !client.Wants(KindStrokes) {
+		delta.Strokes, delta.StrokeIDs = []models.Stroke{}, []string{}
+	}
+	if !client.Wants(KindText) {
+		delta.TextBlocks, delta.TextBlockIDs = []models.TextBlock{}, []string{}
+	}
+	if !client.Wants(KindShapes) {
+		delta.Shapes, delta.ShapeIDs = []models.Shape{}, []string{}
+	}
+	if !client.Wants(KindImages) {
+		delta.Images, delta.ImageIDs = []models.Image{}, []string{}
+	}
+
+	// Send while holding the lock so the client can't be unregistered (and
+	// its channel closed) in between
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	room := h.Rooms[client.RoomID]
+	if !room[client] {
+		return
+	}
+	var participants []Participant
+	for c := range room {
+		participants = append(participants, c.ToParticipant())
+	}
+
+	data, err := h.marshalSnapshot(client, &ServerMessage{
+		Type:         "room_delta",
+		RoomDelta:    delta,
+		Participants: participants,
+		SyncedAt:     &start,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal room delta: %v", err)
+		return
+	}
+
+	h.trySend(client, data)
+}
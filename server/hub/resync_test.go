@@ -0,0 +1,50 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestResync(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	old := newTestStroke(t, pool)
+	roomID := old.RoomID
+
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	fresh := &models.Stroke{RoomID: roomID, Points: []models.Point{{X: 5, Y: 5}}, Color: "#000000", Tool: "pen"}
+	if err := models.CreateStroke(ctx, pool, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHub(pool)
+	client := newTestClient(h, "c1", roomID)
+	join(t, h, client)
+
+	// With a since, only what changed after it is sent
+	h.HandleMessage(client, &ClientMessage{Type: "resync", Since: &since})
+	msg := receiveType(t, client, "room_delta")
+	if msg.RoomDelta == nil || len(msg.RoomDelta.Strokes) != 1 || msg.RoomDelta.Strokes[0].ID != fresh.ID {
+		t.Errorf("room_delta %+v, want only the new stroke", msg.RoomDelta)
+	}
+	if msg.RoomDelta != nil && len(msg.RoomDelta.StrokeIDs) != 2 {
+		t.Errorf("room_delta lists %d live strokes, want 2", len(msg.RoomDelta.StrokeIDs))
+	}
+	if msg.SyncedAt == nil {
+		t.Error("room_delta has no syncedAt for the next resync")
+	}
+
+	// Without one, the full state
+	h.HandleMessage(client, &ClientMessage{Type: "resync"})
+	state := receiveType(t, client, "room_state")
+	if state.RoomState == nil || len(state.RoomState.Strokes) != 2 {
+		t.Errorf("room_state %+v, want both strokes", state.RoomState)
+	}
+}
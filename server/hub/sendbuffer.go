@@ -0,0 +1,41 @@
+package hub
+
+import (
+	"log"
+
+	"github.com/dre4success/bethel/server/metrics"
+	"github.com/gorilla/websocket"
+)
+
+// trySend queues data for the client without blocking. A full buffer drops
+// the message; after MaxSendDrops drops in a row the client is disconnected
+// so it reconnects and resyncs instead of silently diverging.
+func (h *Hub) trySend(client *Client, data []byte) bool {
+	// The client left (its Send channel is closed or about to be)
+	if client.Context().Err() != nil {
+		return false
+	}
+
+	select {
+	case client.Send <- data:
+		client.sendDrops.Store(0)
+		return true
+	default:
+	}
+
+	metrics.SendBufferDrops.Inc()
+	drops := client.sendDrops.Add(1)
+	log.Printf("Client %s send buffer full, skipping (%d in a row)", client.ID, drops)
+
+	if h.MaxSendDrops > 0 && int(drops) >= h.MaxSendDrops && client.evicting.CompareAndSwap(false, true) {
+		// Callers may hold RoomsMu, which unregistering needs
+		go h.evictSlowClient(client)
+	}
+	return false
+}
+
+// evictSlowClient disconnects a client that can't keep up with its room
+func (h *Hub) evictSlowClient(client *Client) {
+	log.Printf("Disconnecting client %s: send buffer overflowed %d times in a row", client.ID, h.MaxSendDrops)
+	h.closeClient(client, websocket.CloseTryAgainLater, "Too far behind, reconnect to resync")
+}
@@ -0,0 +1,51 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSlowClientDisconnected(t *testing.T) {
+	h := NewHub(unreachablePool(t))
+	h.MaxSendDrops = 3
+	go h.Run()
+
+	// No write pump: the client never drains its buffer
+	server, conn, _ := compressedPair(t)
+	stalled := &Client{ID: "slow", RoomID: "room", Hub: h, Conn: server, Send: make(chan []byte, 2)}
+	sender := newTestClient(h, "sender", "room")
+	join(t, h, stalled)
+	join(t, h, sender)
+	drain(stalled)
+
+	broadcast := func(n int) {
+		for range n {
+			h.broadcastToRoom("room", &ServerMessage{Type: "cursor_move", ParticipantID: "sender"}, sender)
+		}
+	}
+
+	// Drops below the limit, or broken up by a successful send, are tolerated
+	broadcast(2 + h.MaxSendDrops - 1)
+	<-stalled.Send
+	broadcast(1 + h.MaxSendDrops - 1)
+	time.Sleep(50 * time.Millisecond)
+	if len(h.GetRoomParticipants("room")) != 2 {
+		t.Fatal("client disconnected before overflowing MaxSendDrops times in a row")
+	}
+
+	broadcast(1)
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) || !strings.Contains(err.Error(), "resync") {
+		t.Errorf("peer saw %v, want close 1013 asking it to resync", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.GetRoomParticipants("room")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("slow client still in the room")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
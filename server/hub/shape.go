@@ -0,0 +1,85 @@
+package hub
+
+import (
+	"context"
+	"log"
+)
+
+func (h *Hub) handleShapeAdd(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.Shape == nil {
+		return
+	}
+	if err := msg.Shape.Validate(); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+
+	shape := msg.Shape
+	shape.RoomID = client.RoomID
+	shape.RoundCoordinates(h.CoordinatePrecision)
+
+	// Persist to database
+	if err := h.createShape(ctx, shape); err != nil {
+		log.Printf("Failed to save shape: %v", err)
+		h.sendError(client, "Failed to save shape")
+		return
+	}
+
+	client.setAckID(shape.ID)
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "shape_add",
+		Shape:           shape,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+func (h *Hub) handleShapeUpdate(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.ShapeID == "" || msg.ShapeUpdates == nil {
+		return
+	}
+	if err := msg.ShapeUpdates.Validate(); err != nil {
+		h.sendError(client, err.Error())
+		return
+	}
+	msg.ShapeUpdates.RoundCoordinates(h.CoordinatePrecision)
+
+	// Update in database
+	if err := h.updateShape(ctx, client.RoomID, msg.ShapeID, msg.ShapeUpdates); err != nil {
+		log.Printf("Failed to update shape: %v", err)
+		h.sendError(client, "Failed to update shape")
+		return
+	}
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "shape_update",
+		ShapeID:         msg.ShapeID,
+		ShapeUpdates:    msg.ShapeUpdates,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
+
+func (h *Hub) handleShapeDelete(ctx context.Context, client *Client, msg *ClientMessage) {
+	if msg.ShapeID == "" {
+		return
+	}
+
+	// Delete from database
+	if err := h.deleteShape(ctx, client.RoomID, msg.ShapeID); err != nil {
+		log.Printf("Failed to delete shape: %v", err)
+		h.sendError(client, "Failed to delete shape")
+		return
+	}
+
+	// Broadcast to other clients
+	h.broadcastToRoom(client.RoomID, &ServerMessage{
+		Type:            "shape_delete",
+		ShapeID:         msg.ShapeID,
+		ParticipantID:   client.ID,
+		ParticipantName: client.Name,
+	}, client)
+}
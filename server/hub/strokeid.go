@@ -0,0 +1,51 @@
+package hub
+
+// maxStrokeAliases bounds how many client-chosen stroke IDs a connection
+// remembers; older ones fall back to being treated as server IDs
+const maxStrokeAliases = 1000
+
+// strokeAliases maps the IDs a client gave its strokes to the IDs the
+// server assigned, so the client can keep referring to its optimistic
+// copies until it reconciles them (touched from ReadPump only)
+type strokeAliases struct {
+	ids   map[string]string
+	order []string
+}
+
+// add remembers that the client's stroke clientID is stored as serverID
+func (a *strokeAliases) add(clientID, serverID string) {
+	if a.ids == nil {
+		a.ids = make(map[string]string)
+	}
+	a.ids[clientID] = serverID
+	a.order = append(a.order, clientID)
+	if len(a.order) > maxStrokeAliases {
+		delete(a.ids, a.order[0])
+		a.order = a.order[1:]
+	}
+}
+
+// resolve returns the server ID for a stroke ID sent by the client
+func (a *strokeAliases) resolve(id string) string {
+	if serverID, ok := a.ids[id]; ok {
+		return serverID
+	}
+	return id
+}
+
+// resolveStrokeIDs rewrites the stroke IDs in a client message to the
+// server-assigned ones. A stroke_update without an ID goes to the stroke
+// open on its pointer.
+func (c *Client) resolveStrokeIDs(msg *ClientMessage) {
+	if msg.Type == "stroke_update" && msg.StrokeID == "" {
+		if open := c.openStrokes[msg.PointerID]; open != nil {
+			msg.StrokeID = open.stroke.ID
+		}
+	}
+	if msg.StrokeID != "" {
+		msg.StrokeID = c.strokeAliases.resolve(msg.StrokeID)
+	}
+	for i, id := range msg.StrokeIDs {
+		msg.StrokeIDs[i] = c.strokeAliases.resolve(id)
+	}
+}
@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dre4success/bethel/server/metrics"
+	"github.com/dre4success/bethel/server/models"
+)
+
+// maxSubscriptions caps the extra rooms one connection may follow
+const maxSubscriptions = 8
+
+// handleSubscribe adds another room to the client's connection. The client
+// receives that room's state and, from then on, its broadcasts tagged with
+// roomId; edits still apply to the room the connection was opened for.
+func (h *Hub) handleSubscribe(ctx context.Context, client *Client, msg *ClientMessage) {
+	roomID := msg.RoomID
+	if roomID == "" || roomID == client.RoomID {
+		h.sendError(client, "Invalid room ID")
+		return
+	}
+
+	tenant, found, err := models.GetRoomTenant(ctx, h.DB, roomID)
+	if err != nil {
+		h.sendError(client, "Failed to subscribe")
+		return
+	}
+	if !found || tenant != client.Tenant {
+		h.sendError(client, "Room not found")
+		return
+	}
+	err = models.VerifyRoomPassword(ctx, h.DB, client.Tenant, roomID, msg.Password)
+	if errors.Is(err, models.ErrWrongPassword) {
+		h.sendError(client, "Room password required")
+		return
+	}
+	if err != nil {
+		h.sendError(client, "Failed to subscribe")
+		return
+	}
+
+	h.RoomsMu.Lock()
+	if !h.Rooms[client.RoomID][client] {
+		// Disconnected meanwhile
+		h.RoomsMu.Unlock()
+		return
+	}
+	if !client.subscriptions[roomID] && len(client.subscriptions) >= maxSubscriptions {
+		h.RoomsMu.Unlock()
+		h.sendError(client, "Too many subscriptions")
+		return
+	}
+	if client.subscriptions == nil {
+		client.subscriptions = make(map[string]bool)
+	}
+	client.subscriptions[roomID] = true
+	if h.subscribers[roomID] == nil {
+		h.subscribers[roomID] = make(map[*Client]bool)
+	}
+	h.subscribers[roomID][client] = true
+	h.RoomsMu.Unlock()
+
+	h.sendToClient(client, &ServerMessage{Type: "subscribed", RoomID: roomID})
+	go h.sendSubscribedState(client, roomID)
+}
+
+// handleUnsubscribe stops a connection following a room added with subscribe
+func (h *Hub) handleUnsubscribe(client *Client, msg *ClientMessage) {
+	h.RoomsMu.Lock()
+	subscribed := client.subscriptions[msg.RoomID]
+	h.unsubscribeUnsafe(client, msg.RoomID)
+	h.RoomsMu.Unlock()
+
+	if subscribed {
+		h.sendToClient(client, &ServerMessage{Type: "unsubscribed", RoomID: msg.RoomID})
+	}
+}
+
+// unsubscribeUnsafe drops one of the client's subscriptions; the caller
+// holds RoomsMu
+func (h *Hub) unsubscribeUnsafe(client *Client, roomID string) {
+	delete(client.subscriptions, roomID)
+	if subs, ok := h.subscribers[roomID]; ok {
+		delete(subs, client)
+		if len(subs) == 0 {
+			delete(h.subscribers, roomID)
+		}
+	}
+}
+
+// unsubscribeAllUnsafe drops every subscription of a leaving client; the
+// caller holds RoomsMu
+func (h *Hub) unsubscribeAllUnsafe(client *Client) {
+	for roomID := range client.subscriptions {
+		h.unsubscribeUnsafe(client, roomID)
+	}
+}
+
+// sendSubscribedState sends a subscribed room's room_state, tagged with its
+// roomId
+func (h *Hub) sendSubscribedState(client *Client, roomID string) {
+	ctx := client.Context()
+
+	start := time.Now()
+	roomState, err := models.GetRoomState(ctx, h.DB, client.Tenant, roomID)
+	metrics.ObserveQuery("room_state", start)
+	if err != nil {
+		log.Printf("Failed to get room state for %s: %v", roomID, err)
+		h.sendError(client, "Room not found")
+		return
+	}
+	if roomState.Room.Ephemeral {
+		roomState = h.loadEphemeralState(roomState)
+	}
+	client.filterRoomState(roomState)
+
+	// Still subscribed and connected (Send is closed once the client leaves)
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+	if !h.subscribers[roomID][client] {
+		return
+	}
+	var participants []Participant
+	for c := range h.Rooms[roomID] {
+		participants = append(participants, c.ToParticipant())
+	}
+
+	data, err := h.marshalSnapshot(client, &ServerMessage{
+		Type:         "room_state",
+		RoomID:       roomID,
+		RoomState:    roomState,
+		Participants: participants,
+		SyncedAt:     &start,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal room state: %v", err)
+		return
+	}
+	h.trySend(client, data)
+}
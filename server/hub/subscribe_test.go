@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestSubscribeTwoRooms(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := NewHub(pool)
+
+	var rooms []*models.Room
+	for _, title := range []string{"Home", "First", "Second"} {
+		room, err := models.CreateRoom(ctx, pool, "", title, models.RoomOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rooms = append(rooms, room)
+	}
+	home, first, second := rooms[0], rooms[1], rooms[2]
+
+	client := &Client{ID: "c1", RoomID: home.ID, Hub: h, Send: make(chan []byte, 32)}
+	h.Rooms[home.ID] = map[*Client]bool{client: true}
+
+	h.handleSubscribe(ctx, client, &ClientMessage{Type: "subscribe", RoomID: first.ID})
+	h.handleSubscribe(ctx, client, &ClientMessage{Type: "subscribe", RoomID: second.ID})
+
+	// Each room is confirmed and its state sent, tagged with its ID
+	got := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		msg := receive(t, client)
+		got[msg.Type+" "+msg.RoomID]++
+	}
+	for _, roomID := range []string{first.ID, second.ID} {
+		for _, typ := range []string{"subscribed", "room_state"} {
+			if got[typ+" "+roomID] != 1 {
+				t.Errorf("got %d %s for room %s, want 1", got[typ+" "+roomID], typ, roomID)
+			}
+		}
+	}
+
+	// Broadcasts from either room reach the client tagged with their room
+	for _, roomID := range []string{first.ID, second.ID} {
+		h.broadcastToRoom(roomID, &ServerMessage{Type: "room_renamed", RoomTitle: "Renamed"}, nil)
+		if msg := receive(t, client); msg.Type != "room_renamed" || msg.RoomID != roomID {
+			t.Errorf("got %s for room %q, want room_renamed for %s", msg.Type, msg.RoomID, roomID)
+		}
+	}
+
+	// Unsubscribing from one leaves the other
+	h.handleUnsubscribe(client, &ClientMessage{Type: "unsubscribe", RoomID: first.ID})
+	if msg := receive(t, client); msg.Type != "unsubscribed" || msg.RoomID != first.ID {
+		t.Errorf("got %s for room %q, want unsubscribed for %s", msg.Type, msg.RoomID, first.ID)
+	}
+	h.broadcastToRoom(first.ID, &ServerMessage{Type: "room_renamed", RoomTitle: "Again"}, nil)
+	expectNothing(t, client)
+
+	h.broadcastToRoom(second.ID, &ServerMessage{Type: "room_renamed", RoomTitle: "Again"}, nil)
+	if msg := receive(t, client); msg.RoomID != second.ID {
+		t.Errorf("got a broadcast for room %q, want %s", msg.RoomID, second.ID)
+	}
+}
+
+func TestSubscribeProtectedRoom(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	h := NewHub(pool)
+
+	home, err := models.CreateRoom(ctx, pool, "", "Home", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := models.CreateRoom(ctx, pool, "", "Secret", models.RoomOptions{Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{ID: "c1", RoomID: home.ID, Hub: h, Send: make(chan []byte, 32)}
+	h.Rooms[home.ID] = map[*Client]bool{client: true}
+
+	h.handleSubscribe(ctx, client, &ClientMessage{Type: "subscribe", RoomID: secret.ID, Password: "wrong"})
+	if msg := receive(t, client); msg.Type != "error" {
+		t.Errorf("got %s, want error", msg.Type)
+	}
+	if len(h.subscribers[secret.ID]) != 0 {
+		t.Error("subscribed without the password")
+	}
+
+	h.handleSubscribe(ctx, client, &ClientMessage{Type: "subscribe", RoomID: secret.ID, Password: "hunter2"})
+	if msg := receive(t, client); msg.Type != "subscribed" {
+		t.Errorf("got %s, want subscribed", msg.Type)
+	}
+}
@@ -0,0 +1,120 @@
+package hub
+
+import (
+	"context"
+	"log"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// maxUndoOps caps each participant's undo and redo stacks
+const maxUndoOps = 50
+
+// operation is an undoable change made by a participant
+type operation struct {
+	kind      string            // "stroke_add", "text_add" or "text_delete"
+	strokeID  string            // for stroke_add
+	textBlock *models.TextBlock // copy of the block, to recreate it
+}
+
+// recordOperation pushes an operation onto the client's undo stack and drops
+// its redo history. Stacks live on the client, so they go when it disconnects.
+func (c *Client) recordOperation(op operation) {
+	c.undoStack = pushOperation(c.undoStack, op)
+	c.redoStack = nil
+}
+
+func pushOperation(stack []operation, op operation) []operation {
+	stack = append(stack, op)
+	if len(stack) > maxUndoOps {
+		stack = stack[len(stack)-maxUndoOps:]
+	}
+	return stack
+}
+
+func (h *Hub) handleUndo(ctx context.Context, client *Client) {
+	n := len(client.undoStack)
+	if n == 0 {
+		return
+	}
+	op := client.undoStack[n-1]
+	client.undoStack = client.undoStack[:n-1]
+
+	if !h.applyOperation(ctx, client, &op, true) {
+		return
+	}
+	client.redoStack = pushOperation(client.redoStack, op)
+}
+
+func (h *Hub) handleRedo(ctx context.Context, client *Client) {
+	n := len(client.redoStack)
+	if n == 0 {
+		return
+	}
+	op := client.redoStack[n-1]
+	client.redoStack = client.redoStack[:n-1]
+
+	if !h.applyOperation(ctx, client, &op, false) {
+		return
+	}
+	client.undoStack = pushOperation(client.undoStack, op)
+}
+
+// applyOperation reverts op (undo) or re-applies it (redo) and tells the whole
+// room, sender included, what changed. It reports whether it succeeded.
+func (h *Hub) applyOperation(ctx context.Context, client *Client, op *operation, undo bool) bool {
+	// Undoing an add is a delete and vice versa
+	remove := undo == (op.kind != "text_delete")
+
+	// Held elements are off limits to undo like to any other change
+	key := elementKey{kind: ElementStroke, id: op.strokeID}
+	if op.kind != "stroke_add" {
+		key = elementKey{kind: ElementText, id: op.textBlock.ID}
+	}
+	if h.heldByOther(client.RoomID, client, key.kind, key.id) {
+		h.sendError(client, errHeldByOther)
+		return false
+	}
+
+	var msg *ServerMessage
+	var err error
+
+	switch {
+	case op.kind == "stroke_add" && remove:
+		err = h.deleteStroke(ctx, client.RoomID, op.strokeID)
+		msg = &ServerMessage{Type: "stroke_delete", StrokeID: op.strokeID}
+
+	case op.kind == "stroke_add":
+		var stroke *models.Stroke
+		stroke, err = h.restoreStroke(ctx, client.RoomID, op.strokeID)
+		msg = &ServerMessage{Type: "stroke_add", Stroke: stroke}
+
+	case remove:
+		// Keep the latest content so a redo brings back what was removed
+		if current, getErr := h.getTextBlock(ctx, client.RoomID, op.textBlock.ID); getErr == nil {
+			op.textBlock = current
+		}
+		err = h.deleteTextBlock(ctx, client.RoomID, op.textBlock.ID)
+		msg = &ServerMessage{Type: "text_delete", TextBlockID: op.textBlock.ID}
+
+	default:
+		textBlock := *op.textBlock
+		err = h.createTextBlock(ctx, &textBlock)
+		msg = &ServerMessage{Type: "text_add", TextBlock: &textBlock}
+	}
+
+	if err != nil {
+		log.Printf("Failed to apply undo/redo of %s: %v", op.kind, err)
+		if undo {
+			h.sendError(client, "Failed to undo")
+		} else {
+			h.sendError(client, "Failed to redo")
+		}
+		return false
+	}
+
+	msg.ParticipantID = client.ID
+	msg.ParticipantName = client.Name
+	h.broadcastToRoom(client.RoomID, msg, nil)
+	return true
+}
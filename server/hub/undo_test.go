@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// addStroke has client draw a stroke and returns the ID the server gave it
+func addStroke(t *testing.T, h *Hub, client *Client, others ...*Client) string {
+	t.Helper()
+	h.HandleMessage(client, &ClientMessage{Type: "stroke_add", Stroke: &models.Stroke{
+		Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}},
+	}})
+	id := receiveType(t, client, "stroke_created").StrokeID
+	for _, c := range others {
+		receiveType(t, c, "stroke_add")
+	}
+	return id
+}
+
+func TestUndoIsPerParticipant(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "a", "room")
+	b := newTestClient(h, "b", "room")
+	joinEphemeral(t, h, "room", a, b)
+
+	mine := addStroke(t, h, a, b)
+	theirs := addStroke(t, h, b, a)
+
+	// A's undo takes back A's stroke, though B drew last
+	h.HandleMessage(a, &ClientMessage{Type: "undo"})
+	if msg := receiveType(t, b, "stroke_delete"); msg.StrokeID != mine || msg.ParticipantID != "a" {
+		t.Errorf("B saw delete of %q by %q, want %q by a", msg.StrokeID, msg.ParticipantID, mine)
+	}
+	receiveType(t, a, "stroke_delete")
+
+	ids := strokeIDs(liveContent(h.ephemeralRooms["room"].state).Strokes)
+	if slices.Contains(ids, mine) || !slices.Contains(ids, theirs) {
+		t.Errorf("strokes after A's undo = %v, want B's %q only removed A's", ids, theirs)
+	}
+
+	// A has nothing left to undo; B's stroke stays
+	h.HandleMessage(a, &ClientMessage{Type: "undo"})
+	expectNothing(t, b)
+	if !slices.Contains(strokeIDs(liveContent(h.ephemeralRooms["room"].state).Strokes), theirs) {
+		t.Error("second undo by A removed B's stroke")
+	}
+	if len(b.undoStack) != 1 {
+		t.Errorf("B's undo stack has %d operations, want 1", len(b.undoStack))
+	}
+
+	// Redo brings A's stroke back
+	h.HandleMessage(a, &ClientMessage{Type: "redo"})
+	if msg := receiveType(t, b, "stroke_add"); msg.Stroke == nil || msg.Stroke.ID != mine {
+		t.Errorf("redo broadcast %+v, want stroke %q", msg.Stroke, mine)
+	}
+}
+
+func TestUndoStackCapped(t *testing.T) {
+	client := &Client{}
+	for i := 0; i < maxUndoOps+10; i++ {
+		client.recordOperation(operation{kind: "stroke_add", strokeID: string(rune('a' + i%26))})
+	}
+	if len(client.undoStack) != maxUndoOps {
+		t.Errorf("undo stack has %d operations, want %d", len(client.undoStack), maxUndoOps)
+	}
+
+	client.redoStack = []operation{{kind: "stroke_add"}}
+	client.recordOperation(operation{kind: "stroke_add"})
+	if client.redoStack != nil {
+		t.Error("new operation kept the redo history")
+	}
+}
@@ -0,0 +1,239 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// clearSnapshot is the content a room held before its last clear_all
+type clearSnapshot struct {
+	strokes    []models.Stroke
+	textBlocks []models.TextBlock
+	shapes     []models.Shape
+	images     []models.Image
+	at         time.Time
+
+	// Fires when the window closes, deleting the uploads of images the
+	// undo could have brought back
+	timer *time.Timer
+}
+
+// uploadKeys returns the storage keys of the snapshot's images
+func (s *clearSnapshot) uploadKeys() []string {
+	var keys []string
+	for _, img := range s.images {
+		if img.Key != "" {
+			keys = append(keys, img.Key)
+		}
+	}
+	return keys
+}
+
+// snapshotForUndo captures the room's content ahead of a clear. It returns
+// nil when undoing clears is disabled or the content can't be read, in
+// which case the clear goes ahead without an undo.
+func (h *Hub) snapshotForUndo(ctx context.Context, roomID string) *clearSnapshot {
+	if h.UndoClearWindow <= 0 {
+		return nil
+	}
+
+	snapshot := &clearSnapshot{}
+	handled, _ := h.withEphemeral(roomID, func(state *models.RoomState) error {
+		snapshot.strokes = append([]models.Stroke{}, state.Strokes...)
+		snapshot.textBlocks = append([]models.TextBlock{}, state.TextBlocks...)
+		snapshot.shapes = append([]models.Shape{}, state.Shapes...)
+		snapshot.images = append([]models.Image{}, state.Images...)
+		return nil
+	})
+	if !handled {
+		var err error
+		if snapshot.strokes, err = h.getStrokes(ctx, roomID); err == nil {
+			if snapshot.textBlocks, err = models.GetTextBlocksByRoom(ctx, h.DB, roomID); err == nil {
+				if snapshot.shapes, err = models.GetShapesByRoom(ctx, h.DB, roomID); err == nil {
+					snapshot.images, err = models.GetImagesByRoom(ctx, h.DB, roomID)
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to snapshot room %s before clearing: %v", roomID, err)
+			return nil
+		}
+	}
+	return snapshot
+}
+
+// keepSnapshot makes a snapshot the one undo_clear restores for the room.
+// The files of its images are kept until the undo window closes.
+func (h *Hub) keepSnapshot(roomID string, snapshot *clearSnapshot) {
+	if snapshot == nil {
+		return
+	}
+	snapshot.at = time.Now()
+	snapshot.timer = time.AfterFunc(h.UndoClearWindow, func() {
+		h.expireSnapshot(roomID, snapshot)
+	})
+
+	h.snapshotsMu.Lock()
+	var expired []*clearSnapshot
+	if old := h.clearSnapshots[roomID]; old != nil {
+		expired = append(expired, old)
+	}
+	// Drop other rooms' snapshots that can no longer be restored
+	for id, s := range h.clearSnapshots {
+		if id != roomID && time.Since(s.at) > h.UndoClearWindow {
+			delete(h.clearSnapshots, id)
+			expired = append(expired, s)
+		}
+	}
+	h.clearSnapshots[roomID] = snapshot
+	h.snapshotsMu.Unlock()
+
+	for _, s := range expired {
+		h.discardSnapshot(s)
+	}
+}
+
+// takeSnapshot removes and returns the room's snapshot if it is still
+// within UndoClearWindow
+func (h *Hub) takeSnapshot(roomID string) *clearSnapshot {
+	h.snapshotsMu.Lock()
+	snapshot := h.clearSnapshots[roomID]
+	delete(h.clearSnapshots, roomID)
+	h.snapshotsMu.Unlock()
+
+	if snapshot == nil {
+		return nil
+	}
+	if time.Since(snapshot.at) > h.UndoClearWindow {
+		h.discardSnapshot(snapshot)
+		return nil
+	}
+	snapshot.timer.Stop()
+	return snapshot
+}
+
+// expireSnapshot drops the room's snapshot when its undo window closes,
+// unless it was already restored or replaced
+func (h *Hub) expireSnapshot(roomID string, snapshot *clearSnapshot) {
+	h.snapshotsMu.Lock()
+	current := h.clearSnapshots[roomID] == snapshot
+	if current {
+		delete(h.clearSnapshots, roomID)
+	}
+	h.snapshotsMu.Unlock()
+
+	if current {
+		h.DeleteUploads(snapshot.uploadKeys())
+	}
+}
+
+// discardSnapshot deletes the uploads of a snapshot that will never be
+// restored
+func (h *Hub) discardSnapshot(snapshot *clearSnapshot) {
+	if snapshot.timer != nil {
+		snapshot.timer.Stop()
+	}
+	h.DeleteUploads(snapshot.uploadKeys())
+}
+
+// snapshotUploadKeys adds the storage keys of images in snapshots that can
+// still be restored to keys
+func (h *Hub) snapshotUploadKeys(keys map[string]bool) {
+	h.snapshotsMu.Lock()
+	defer h.snapshotsMu.Unlock()
+
+	for _, snapshot := range h.clearSnapshots {
+		for _, key := range snapshot.uploadKeys() {
+			keys[key] = true
+		}
+	}
+}
+
+// handleUndoClear restores the content removed by the room's last
+// clear_all, if it happened within UndoClearWindow, and resends everyone
+// the room's state
+func (h *Hub) handleUndoClear(ctx context.Context, client *Client) {
+	snapshot := h.takeSnapshot(client.RoomID)
+	if snapshot == nil {
+		h.sendError(client, "Nothing to undo")
+		return
+	}
+
+	// Restored content keeps its place below anything drawn since the
+	// clear: strokes keep their seq, and in memory go first in the slices
+	handled, err := h.changeEphemeral(client.RoomID, func(state *models.RoomState) error {
+		state.Strokes = append(snapshot.strokes, state.Strokes...)
+		state.TextBlocks = append(snapshot.textBlocks, state.TextBlocks...)
+		state.Shapes = append(snapshot.shapes, state.Shapes...)
+		state.Images = append(snapshot.images, state.Images...)
+		return nil
+	})
+	if !handled {
+		err = models.RestoreRoomContent(ctx, h.DB, client.RoomID, &models.RoomState{
+			Strokes:    snapshot.strokes,
+			TextBlocks: snapshot.textBlocks,
+			Shapes:     snapshot.shapes,
+			Images:     snapshot.images,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to restore room %s: %v", client.RoomID, err)
+		h.sendError(client, "Failed to undo clear")
+		return
+	}
+
+	h.broadcastRoomState(ctx, client)
+}
+
+// broadcastRoomState sends everyone in the client's room, and connections
+// subscribed to it, a fresh room_state attributed to the client
+func (h *Hub) broadcastRoomState(ctx context.Context, client *Client) {
+	start := time.Now()
+	state, ok := h.ephemeralSnapshot(client.RoomID)
+	if !ok {
+		var err error
+		state, err = models.GetRoomState(ctx, h.DB, client.Tenant, client.RoomID)
+		if err != nil {
+			log.Printf("Failed to get room state for %s: %v", client.RoomID, err)
+			return
+		}
+	}
+
+	h.RoomsMu.RLock()
+	defer h.RoomsMu.RUnlock()
+
+	room := h.Rooms[client.RoomID]
+	participants := make([]Participant, 0, len(room))
+	for c := range room {
+		participants = append(participants, c.ToParticipant())
+	}
+
+	send := func(c *Client, roomID string) {
+		filtered := *state
+		c.filterRoomState(&filtered)
+		data, err := h.marshalSnapshot(c, &ServerMessage{
+			Type:            "room_state",
+			RoomID:          roomID,
+			RoomState:       &filtered,
+			Participants:    participants,
+			SyncedAt:        &start,
+			ParticipantID:   client.ID,
+			ParticipantName: client.Name,
+		})
+		if err != nil {
+			log.Printf("Failed to marshal room state: %v", err)
+			return
+		}
+		h.trySend(c, data)
+	}
+	for c := range room {
+		send(c, "")
+	}
+	// Subscribers get it tagged with the room, like its other broadcasts
+	for c := range h.subscribers[client.RoomID] {
+		send(c, client.RoomID)
+	}
+}
@@ -0,0 +1,263 @@
+package hub
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+)
+
+func TestTakeSnapshotExpiry(t *testing.T) {
+	h := NewHub(nil)
+	h.UndoClearWindow = time.Minute
+
+	h.keepSnapshot("room", &clearSnapshot{})
+	if h.takeSnapshot("room") == nil {
+		t.Fatal("fresh snapshot not returned")
+	}
+	if h.takeSnapshot("room") != nil {
+		t.Error("snapshot returned twice")
+	}
+
+	// Snapshots older than the window can't be restored
+	h.keepSnapshot("room", &clearSnapshot{})
+	h.clearSnapshots["room"].at = time.Now().Add(-2 * time.Minute)
+	if h.takeSnapshot("room") != nil {
+		t.Error("expired snapshot returned")
+	}
+}
+
+func TestKeepSnapshotPrunesExpired(t *testing.T) {
+	h := NewHub(nil)
+	h.UndoClearWindow = time.Minute
+
+	h.keepSnapshot("old", &clearSnapshot{})
+	h.clearSnapshots["old"].at = time.Now().Add(-2 * time.Minute)
+	h.keepSnapshot("recent", &clearSnapshot{})
+	h.keepSnapshot("new", &clearSnapshot{})
+
+	if _, ok := h.clearSnapshots["old"]; ok {
+		t.Error("expired snapshot kept")
+	}
+	if _, ok := h.clearSnapshots["recent"]; !ok {
+		t.Error("live snapshot pruned")
+	}
+}
+
+func TestSnapshotDisabled(t *testing.T) {
+	h := NewHub(nil)
+	h.UndoClearWindow = 0
+
+	if h.snapshotForUndo(context.Background(), "room") != nil {
+		t.Error("snapshot taken with undo disabled")
+	}
+}
+
+func TestClearThenUndo(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	stroke := newTestStroke(t, pool)
+	roomID := stroke.RoomID
+
+	tb := &models.TextBlock{RoomID: roomID, Content: "hello"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	shape := &models.Shape{RoomID: roomID, Type: "rect", Width: 10, Height: 10, StrokeColor: "#000000"}
+	if err := models.CreateShape(ctx, pool, shape); err != nil {
+		t.Fatal(err)
+	}
+	img := &models.Image{RoomID: roomID, Width: 10, Height: 10, URL: "/uploads/" + roomID + "/a.png", Key: roomID + "/a.png", ContentType: "image/png"}
+	if err := models.CreateImage(ctx, pool, img); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHub(pool)
+	h.StrokeFlushInterval = time.Hour
+	h.Uploads = uploadStore(t, img.Key)
+	client := &Client{ID: "c1", RoomID: roomID, Hub: h, Send: make(chan []byte, 32)}
+	h.Rooms[roomID] = map[*Client]bool{client: true}
+
+	// Points still queued at the clear are part of what undo restores
+	points := append(stroke.Points, models.Point{X: 1, Y: 1, Pressure: 0.5})
+	if err := h.queueStrokePoints(ctx, roomID, stroke.ID, points, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.clearRoom(ctx, roomID, nil); err != nil {
+		t.Fatal(err)
+	}
+	state, err := models.GetRoomState(ctx, pool, "", roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Strokes) != 0 || len(state.TextBlocks) != 0 {
+		t.Fatalf("clear left %d strokes and %d text blocks", len(state.Strokes), len(state.TextBlocks))
+	}
+
+	h.handleUndoClear(ctx, client)
+	msg := receive(t, client)
+	if msg.Type != "room_state" {
+		t.Fatalf("got %s, want room_state", msg.Type)
+	}
+	if len(msg.RoomState.Strokes) != 1 || len(msg.RoomState.TextBlocks) != 1 {
+		t.Fatalf("undo restored %d strokes and %d text blocks, want 1 and 1",
+			len(msg.RoomState.Strokes), len(msg.RoomState.TextBlocks))
+	}
+	if len(msg.RoomState.Shapes) != 1 || len(msg.RoomState.Images) != 1 {
+		t.Errorf("undo restored %d shapes and %d images, want 1 and 1",
+			len(msg.RoomState.Shapes), len(msg.RoomState.Images))
+	}
+	if !uploadExists(h.Uploads.(*storage.LocalStore), img.Key) {
+		t.Error("restored image's upload was deleted")
+	}
+
+	restored, err := models.GetStroke(ctx, pool, roomID, stroke.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Points) != len(points) {
+		t.Errorf("restored stroke has %d points, want %d", len(restored.Points), len(points))
+	}
+	if restored.Seq != stroke.Seq {
+		t.Errorf("restored stroke has seq %d, want its original %d", restored.Seq, stroke.Seq)
+	}
+	if got, err := models.GetTextBlock(ctx, pool, roomID, tb.ID); err != nil || got.Content != "hello" {
+		t.Errorf("text block not restored: %v, %v", got, err)
+	}
+
+	// The snapshot is used up
+	h.handleUndoClear(ctx, client)
+	if msg := receive(t, client); msg.Type != "error" {
+		t.Errorf("second undo got %s, want error", msg.Type)
+	}
+}
+
+func TestUndoClearAfterWindow(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	stroke := newTestStroke(t, pool)
+	roomID := stroke.RoomID
+
+	h := NewHub(pool)
+	client := &Client{ID: "c1", RoomID: roomID, Hub: h, Send: make(chan []byte, 32)}
+	h.Rooms[roomID] = map[*Client]bool{client: true}
+
+	if err := h.clearRoom(ctx, roomID, nil); err != nil {
+		t.Fatal(err)
+	}
+	h.clearSnapshots[roomID].at = time.Now().Add(-h.UndoClearWindow - time.Second)
+
+	h.handleUndoClear(ctx, client)
+	if msg := receive(t, client); msg.Type != "error" {
+		t.Errorf("late undo got %s, want error", msg.Type)
+	}
+	if _, err := models.GetStroke(ctx, pool, roomID, stroke.ID); err == nil {
+		t.Error("stroke restored after the undo window")
+	}
+}
+
+// uploadStore returns a local store holding one file per key
+func uploadStore(t *testing.T, keys ...string) *storage.LocalStore {
+	t.Helper()
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, err := store.Put(context.Background(), key, strings.NewReader("png"), 3, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// uploadExists reports whether key is still in store, waiting briefly for
+// a pending delete (DeleteUploads runs in the background)
+func uploadExists(store *storage.LocalStore, key string) bool {
+	for i := 0; i < 20; i++ {
+		if _, err := os.Stat(filepath.Join(store.Dir, key)); err != nil {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+func TestUndoClearEphemeral(t *testing.T) {
+	h := NewHub(nil)
+	h.UndoClearWindow = time.Minute
+	h.Uploads = uploadStore(t, "room/a.png")
+
+	owner := newTestClient(h, "owner", "room")
+	owner.Owner = true
+	joinEphemeral(t, h, "room", owner)
+	follower := newTestClient(h, "follower", "other")
+	join(t, h, follower)
+	h.subscribers["room"] = map[*Client]bool{follower: true}
+
+	state := h.ephemeralRooms["room"].state
+	state.TextBlocks = []models.TextBlock{{ID: "t1", RoomID: "room", Content: "hello"}}
+	state.Shapes = []models.Shape{{ID: "sh1", RoomID: "room", Type: "rect"}}
+	state.Images = []models.Image{{ID: "i1", RoomID: "room", Key: "room/a.png"}}
+
+	h.HandleMessage(owner, &ClientMessage{Type: "clear_all"})
+	if !uploadExists(h.Uploads.(*storage.LocalStore), "room/a.png") {
+		t.Fatal("clear deleted an upload the undo can restore")
+	}
+	if !h.HeldUploadKeys()["room/a.png"] {
+		t.Error("snapshot upload not held from the orphan sweep")
+	}
+
+	// Drawn after the clear, so it stays on top of the restored stroke
+	if err := h.createStroke(context.Background(), &models.Stroke{ID: "s2", RoomID: "room"}); err != nil {
+		t.Fatal(err)
+	}
+	drain(owner)
+	drain(follower)
+
+	h.HandleMessage(owner, &ClientMessage{Type: "undo_clear"})
+	msg := receiveType(t, owner, "room_state")
+	restored := msg.RoomState
+	if ids := strokeIDs(restored.Strokes); len(ids) != 2 || ids[0] != "s1" || ids[1] != "s2" {
+		t.Errorf("strokes after undo = %v, want [s1 s2]", ids)
+	}
+	if len(restored.TextBlocks) != 1 || len(restored.Shapes) != 1 || len(restored.Images) != 1 {
+		t.Errorf("undo restored %d text blocks, %d shapes and %d images, want 1 of each",
+			len(restored.TextBlocks), len(restored.Shapes), len(restored.Images))
+	}
+
+	// Subscribers see the restored room too, tagged with its ID
+	if msg := receiveType(t, follower, "room_state"); msg.RoomID != "room" || len(msg.RoomState.Strokes) != 2 {
+		t.Errorf("subscriber got room_state for %q with %d strokes", msg.RoomID, len(msg.RoomState.Strokes))
+	}
+}
+
+func TestSnapshotExpiryDeletesUploads(t *testing.T) {
+	h := NewHub(nil)
+	h.UndoClearWindow = 20 * time.Millisecond
+	store := uploadStore(t, "room/a.png")
+	h.Uploads = store
+
+	owner := newTestClient(h, "owner", "room")
+	joinEphemeral(t, h, "room", owner)
+	h.ephemeralRooms["room"].state.Images = []models.Image{{ID: "i1", RoomID: "room", Key: "room/a.png"}}
+
+	if err := h.clearRoom(context.Background(), "room", nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * h.UndoClearWindow)
+	if uploadExists(store, "room/a.png") {
+		t.Error("upload kept after the undo window closed")
+	}
+	if h.HeldUploadKeys()["room/a.png"] {
+		t.Error("expired snapshot still holds its upload")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// janitorConfig sets how often the janitor runs and how long data is kept
+type janitorConfig struct {
+	Interval        time.Duration
+	StrokeRetention time.Duration // soft-deleted strokes
+	RoomRetention   time.Duration // soft-deleted rooms
+	StaleRoomTTL    time.Duration // empty rooms with no activity
+
+	// Uploaded files no image refers to are deleted once this old, which
+	// leaves time for an upload to be saved (0 disables the sweep)
+	UploadOrphanGrace time.Duration
+}
+
+// runJanitor periodically purges data that has outlived its retention
+func runJanitor(pool *pgxpool.Pool, wsHub *hub.Hub, cfg janitorConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+
+		purged, err := models.PurgeDeletedStrokes(ctx, pool, time.Now().Add(-cfg.StrokeRetention))
+		if err != nil {
+			log.Printf("Janitor failed to purge deleted strokes: %v", err)
+		} else if purged > 0 {
+			log.Printf("Janitor purged %d deleted strokes", purged)
+		}
+
+		purged, keys, err := models.PurgeDeletedRooms(ctx, pool, time.Now().Add(-cfg.RoomRetention))
+		if err != nil {
+			log.Printf("Janitor failed to purge deleted rooms: %v", err)
+		} else if purged > 0 {
+			log.Printf("Janitor purged %d deleted rooms", purged)
+		}
+		wsHub.DeleteUploads(keys)
+
+		// Rooms someone is connected to are never stale, however old
+		purged, keys, err = models.PurgeStaleRooms(ctx, pool, time.Now().Add(-cfg.StaleRoomTTL), wsHub.ActiveRoomIDs())
+		if err != nil {
+			log.Printf("Janitor failed to reap stale rooms: %v", err)
+		} else {
+			log.Printf("Janitor reaped %d stale rooms", purged)
+		}
+		wsHub.DeleteUploads(keys)
+
+		if cfg.UploadOrphanGrace > 0 && wsHub.Uploads != nil {
+			sweepOrphanedUploads(ctx, pool, wsHub, cfg.UploadOrphanGrace)
+		}
+	}
+}
+
+// sweepOrphanedUploads deletes stored files older than grace that no image
+// refers to, such as uploads whose image was never saved and files of
+// ephemeral rooms that have closed
+func sweepOrphanedUploads(ctx context.Context, pool *pgxpool.Pool, wsHub *hub.Hub, grace time.Duration) {
+	objects, err := wsHub.Uploads.List(ctx)
+	if err != nil {
+		log.Printf("Janitor failed to list uploads: %v", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-grace)
+	var candidates []storage.Object
+	var keys []string
+	for _, obj := range objects {
+		if obj.ModTime.Before(cutoff) {
+			candidates = append(candidates, obj)
+			keys = append(keys, obj.Key)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	referenced, err := models.ReferencedStorageKeys(ctx, pool, keys)
+	if err != nil {
+		log.Printf("Janitor failed to look up upload references: %v", err)
+		return
+	}
+	live := wsHub.HeldUploadKeys()
+
+	var removed int
+	var reclaimed int64
+	for _, obj := range candidates {
+		if referenced[obj.Key] || live[obj.Key] {
+			continue
+		}
+		if err := wsHub.Uploads.Delete(ctx, obj.Key); err != nil {
+			log.Printf("Janitor failed to delete orphaned upload %s: %v", obj.Key, err)
+			continue
+		}
+		removed++
+		reclaimed += obj.Size
+	}
+	if removed > 0 {
+		log.Printf("Janitor deleted %d orphaned uploads, reclaiming %d bytes", removed, reclaimed)
+	}
+}
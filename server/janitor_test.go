@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
+)
+
+func TestSweepOrphanedUploads(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	store, err := storage.NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsHub := hub.NewHub(pool)
+	wsHub.Uploads = store
+
+	room, err := models.CreateRoom(ctx, pool, "", "Pictures", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateImage(ctx, pool, &models.Image{RoomID: room.ID, URL: "/uploads/used.png", Key: "used.png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"used.png", "orphan.png", "fresh.png"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("png"), 3, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		if key != "fresh.png" {
+			if err := os.Chtimes(filepath.Join(store.Dir, key), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	sweepOrphanedUploads(ctx, pool, wsHub, time.Hour)
+
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(store.Dir, key))
+		return err == nil
+	}
+	if exists("orphan.png") {
+		t.Error("old unreferenced upload kept")
+	}
+	if !exists("used.png") {
+		t.Error("referenced upload deleted")
+	}
+	if !exists("fresh.png") {
+		t.Error("upload within the grace period deleted")
+	}
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dre4success/bethel/server/db"
 	"github.com/dre4success/bethel/server/handlers"
 	"github.com/dre4success/bethel/server/hub"
+	"github.com/dre4success/bethel/server/metrics"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/dre4success/bethel/server/storage"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 )
 
@@ -29,39 +39,283 @@ func main() {
 	if allowedOrigins == "" {
 		allowedOrigins = "http://localhost:5173,http://192.168.7.43:5173"
 	}
+	var origins []string
+	for _, origin := range strings.Split(allowedOrigins, ",") {
+		origins = append(origins, strings.TrimSpace(origin))
+	}
+
+	// Admin endpoints are disabled unless a token is set
+	adminToken := os.Getenv("ADMIN_TOKEN")
+
+	// Require signed JWTs on the API and WebSocket; anonymous when unset
+	jwtSecret := os.Getenv("JWT_SECRET")
 
-	// Initialize database
-	database, err := db.Connect(databaseURL)
+	// Multi-tenant room scoping ("header" or "origin"); single tenant when unset
+	tenantMode := os.Getenv("TENANT_MODE")
+
+	// Initialize database, waiting for it to come up (e.g. under docker-compose)
+	dbOpts := db.Options{
+		MaxAttempts: 10,
+		BaseDelay:   500 * time.Millisecond,
+		Pool:        db.PoolSettingsFromEnv(),
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_CONNECT_ATTEMPTS")); err == nil {
+		dbOpts.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_CONNECT_BACKOFF")); err == nil {
+		dbOpts.BaseDelay = d
+	}
+	connectCtx, stopConnect := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	database, err := db.Connect(connectCtx, databaseURL, dbOpts)
+	stopConnect()
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer database.Close()
 
 	// Run migrations
+	var readiness handlers.Readiness
 	if err := db.RunMigrations(database); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
+	readiness.SetMigrated()
+
+	// Purge soft-deleted strokes and rooms after their retention periods, and
+	// empty rooms nobody has touched in a while
+	janitor := janitorConfig{
+		Interval:        time.Hour,
+		StrokeRetention: 7 * 24 * time.Hour,
+		RoomRetention:   30 * 24 * time.Hour,
+		StaleRoomTTL:    30 * 24 * time.Hour,
+
+		UploadOrphanGrace: 24 * time.Hour,
+	}
+	if d, err := time.ParseDuration(os.Getenv("JANITOR_INTERVAL")); err == nil && d > 0 {
+		janitor.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DELETED_STROKE_RETENTION")); err == nil {
+		janitor.StrokeRetention = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DELETED_ROOM_RETENTION")); err == nil {
+		janitor.RoomRetention = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("STALE_ROOM_TTL")); err == nil {
+		janitor.StaleRoomTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("UPLOAD_ORPHAN_GRACE")); err == nil {
+		janitor.UploadOrphanGrace = d
+	}
 
 	// Initialize WebSocket hub
 	wsHub := hub.NewHub(database)
+	if ms, err := strconv.Atoi(os.Getenv("STROKE_MERGE_WINDOW_MS")); err == nil {
+		wsHub.StrokeMergeWindow = time.Duration(ms) * time.Millisecond
+	}
+	if dist, err := strconv.ParseFloat(os.Getenv("STROKE_MERGE_DISTANCE"), 64); err == nil {
+		wsHub.StrokeMergeDistance = dist
+	}
+	if d, err := time.ParseDuration(os.Getenv("STROKE_DEDUPE_WINDOW")); err == nil {
+		wsHub.StrokeDedupeWindow = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("COORDINATE_PRECISION")); err == nil {
+		wsHub.CoordinatePrecision = n
+	}
+	wsHub.StrokeFlushInterval = 200 * time.Millisecond
+	if ms, err := strconv.Atoi(os.Getenv("STROKE_FLUSH_INTERVAL_MS")); err == nil {
+		wsHub.StrokeFlushInterval = time.Duration(ms) * time.Millisecond
+	}
+	wsHub.Compression = os.Getenv("WS_COMPRESSION") == "true"
+	wsHub.CompressionThreshold = 1024
+	if n, err := strconv.Atoi(os.Getenv("WS_COMPRESSION_THRESHOLD")); err == nil {
+		wsHub.CompressionThreshold = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WS_READ_BUFFER_SIZE")); err == nil && n > 0 {
+		wsHub.ReadBufferSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WS_WRITE_BUFFER_SIZE")); err == nil && n > 0 {
+		wsHub.WriteBufferSize = n
+	}
+	wsHub.WriteBufferPool = os.Getenv("WS_WRITE_BUFFER_POOL") == "true"
+	if d, err := time.ParseDuration(os.Getenv("WS_PING_INTERVAL")); err == nil {
+		wsHub.PingInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("WS_PONG_TIMEOUT")); err == nil {
+		wsHub.PongTimeout = d
+	}
+	if wsHub.PingInterval <= 0 || wsHub.PingInterval >= wsHub.PongTimeout {
+		log.Fatalf("WS_PING_INTERVAL (%v) must be positive and shorter than WS_PONG_TIMEOUT (%v)", wsHub.PingInterval, wsHub.PongTimeout)
+	}
+	if n, err := strconv.ParseInt(os.Getenv("WS_MAX_MESSAGE_BYTES"), 10, 64); err == nil && n > 0 {
+		wsHub.MaxMessageSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_STROKE_POINTS")); err == nil {
+		wsHub.MaxStrokePoints = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WS_SEND_BUFFER")); err == nil && n > 0 {
+		wsHub.SendBufferSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WS_MAX_SEND_DROPS")); err == nil {
+		wsHub.MaxSendDrops = n
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("WS_MESSAGE_RATE"), 64); err == nil {
+		wsHub.MessageRate = rate
+	}
+	if d, err := time.ParseDuration(os.Getenv("TEXT_EDITING_TIMEOUT")); err == nil {
+		wsHub.TextEditingTimeout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("STATE_CHECKSUM_INTERVAL")); err == nil {
+		wsHub.ChecksumInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ROOM_ACTIVITY_FLUSH_INTERVAL")); err == nil {
+		wsHub.ActivityFlushInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("IDLE_TIMEOUT")); err == nil {
+		wsHub.IdleTimeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_ROOM_PARTICIPANTS")); err == nil {
+		wsHub.MaxParticipants = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("UNDO_CLEAR_WINDOW")); err == nil {
+		wsHub.UndoClearWindow = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_ROOMS")); err == nil {
+		wsHub.MaxRooms = n
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("CURSOR_BROADCAST_RATE"), 64); err == nil {
+		wsHub.CursorInterval = 0
+		if rate > 0 {
+			wsHub.CursorInterval = time.Duration(float64(time.Second) / rate)
+		}
+	}
+	wsHub.SimplifyStrokes = os.Getenv("STROKE_SIMPLIFY") == "true"
+	if eps, err := strconv.ParseFloat(os.Getenv("STROKE_SIMPLIFY_EPSILON"), 64); err == nil {
+		wsHub.SimplifyEpsilon = eps
+	}
+	if bound, err := strconv.ParseFloat(os.Getenv("MAX_COORDINATE"), 64); err == nil && bound >= 0 {
+		models.MaxCoordinate = bound
+	}
+	if family := os.Getenv("TEXT_DEFAULT_FONT_FAMILY"); family != "" {
+		models.TextDefaults.FontFamily = family
+	}
+	if size, err := strconv.ParseFloat(os.Getenv("TEXT_DEFAULT_FONT_SIZE"), 64); err == nil && size > 0 {
+		models.TextDefaults.FontSize = size
+	}
+	if color := os.Getenv("TEXT_DEFAULT_COLOR"); color != "" {
+		if !models.IsValidColor(color) {
+			log.Fatalf("Invalid TEXT_DEFAULT_COLOR %q, expected #RRGGBB", color)
+		}
+		models.TextDefaults.Color = color
+	}
+	if tools := os.Getenv("STROKE_TOOLS"); tools != "" {
+		var allowed []string
+		for _, t := range strings.Split(tools, ",") {
+			t = strings.TrimSpace(t)
+			if !models.IsValidTool(t) {
+				log.Fatalf("Invalid STROKE_TOOLS entry %q, expected one of %v", t, models.StrokeTools)
+			}
+			allowed = append(allowed, t)
+		}
+		wsHub.Tools = allowed
+	}
+	if colors := os.Getenv("PARTICIPANT_COLORS"); colors != "" {
+		var palette []string
+		for _, c := range strings.Split(colors, ",") {
+			c = strings.TrimSpace(c)
+			if !models.IsValidColor(c) {
+				log.Fatalf("Invalid PARTICIPANT_COLORS entry %q, expected #RRGGBB", c)
+			}
+			palette = append(palette, c)
+		}
+		wsHub.Colors = palette
+	}
+
+	// Uploaded images go to local disk unless S3-compatible storage is configured
+	maxUploadBytes := int64(10 << 20)
+	if n, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_BYTES"), 10, 64); err == nil && n > 0 {
+		maxUploadBytes = n
+	}
+	var uploads storage.Store
+	var localUploads *storage.LocalStore
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		uploads, err = storage.NewS3Store(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    bucket,
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		})
+	} else {
+		uploadDir := os.Getenv("UPLOAD_DIR")
+		if uploadDir == "" {
+			uploadDir = "./uploads"
+		}
+		localUploads, err = storage.NewLocalStore(uploadDir, "/uploads")
+		uploads = localUploads
+	}
+	if err != nil {
+		log.Fatalf("Failed to set up upload storage: %v", err)
+	}
+	wsHub.Uploads = uploads
 	go wsHub.Run()
+	go runJanitor(database, wsHub, janitor)
 
 	// Set up router
 	r := mux.NewRouter()
+	r.Use(handlers.RequestIDMiddleware)
+	r.Use(metrics.Middleware)
+	r.Use(handlers.TenantMiddleware(tenantMode))
+
+	// Deliberately registered ahead of the API subrouter, outside
+	// AuthMiddleware: clients read authRequired here before they have a
+	// token, and the response holds no room or user data
+	r.HandleFunc("/api/capabilities", handlers.GetCapabilities(wsHub, jwtSecret != "", maxUploadBytes)).Methods("GET")
 
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/rooms", handlers.CreateRoom(database)).Methods("POST")
-	api.HandleFunc("/rooms/{id}", handlers.GetRoom(database)).Methods("GET")
+	api.Use(handlers.AuthMiddleware(jwtSecret))
+	api.HandleFunc("/rooms", handlers.ListRooms(database)).Methods("GET")
+	api.HandleFunc("/rooms", handlers.CreateRoom(database, handlers.NewSeededFunNameGenerator())).Methods("POST")
+	api.HandleFunc("/rooms/search", handlers.SearchRooms(database)).Methods("GET")
+	api.HandleFunc("/rooms/import", handlers.ImportRoom(database, uploads)).Methods("POST")
+	api.HandleFunc("/rooms/{id}", handlers.GetRoom(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}", handlers.RoomExists(database)).Methods("HEAD")
+	api.HandleFunc("/rooms/{id}", handlers.RequireOwner(database, handlers.DeleteRoom(wsHub))).Methods("DELETE")
+	api.HandleFunc("/rooms/{id}", handlers.RequireOwner(database, handlers.RenameRoom(wsHub))).Methods("PUT")
+	api.HandleFunc("/rooms/{id}/password", handlers.RequireOwner(database, handlers.SetRoomPassword(database))).Methods("PUT")
+	api.HandleFunc("/rooms/{id}/elements/{type}/{elementId}", handlers.GetElement(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/summary", handlers.GetRoomSummary(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/strokes", handlers.GetRoomStrokes(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/replay", handlers.ReplayRoom(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/strokes/{strokeId}", handlers.RequireOwner(database, handlers.DeleteStroke(wsHub))).Methods("DELETE")
+	api.HandleFunc("/rooms/{id}/presence", handlers.GetRoomPresence(database)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/participants", handlers.GetRoomParticipants(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/images", handlers.UploadImage(wsHub, uploads, maxUploadBytes)).Methods("POST")
+	api.HandleFunc("/rooms/{id}/clear", handlers.RequireOwner(database, handlers.ClearRoom(wsHub))).Methods("POST")
+	api.HandleFunc("/rooms/{id}/export.png", handlers.ExportPNG(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/export.svg", handlers.ExportSVG(wsHub)).Methods("GET")
+	api.HandleFunc("/rooms/{id}/export.json", handlers.ExportJSON(wsHub)).Methods("GET")
+
+	// Admin routes
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/connections/{clientId}/disconnect", handlers.RequireAdmin(adminToken, handlers.DisconnectConnection(wsHub))).Methods("POST")
+	admin.HandleFunc("/cleanup", handlers.RequireAdmin(adminToken, handlers.CleanupEmptyRooms(wsHub))).Methods("POST")
 
 	// WebSocket route
-	r.HandleFunc("/ws/{roomId}", handlers.WebSocketHandler(wsHub))
+	r.Handle("/ws/{roomId}", handlers.AuthMiddleware(jwtSecret)(handlers.WebSocketHandler(wsHub, origins)))
+
+	// Locally stored uploads
+	if localUploads != nil {
+		r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", handlers.ServeUploads(localUploads.Dir))).Methods("GET")
+	}
 
-	// Health check
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	// Prometheus metrics
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	// Liveness and readiness checks (/health is kept as an alias for /livez)
+	r.HandleFunc("/livez", handlers.Livez()).Methods("GET")
+	r.HandleFunc("/health", handlers.Livez()).Methods("GET")
+	r.HandleFunc("/readyz", handlers.Readyz(database, &readiness)).Methods("GET")
 
 	// Serve static files (frontend)
 	staticDir := "./static"
@@ -73,7 +327,7 @@ func main() {
 		// Note: API and WS routes are already handled by earlier mux rules.
 		r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			path := staticDir + r.URL.Path
-			
+
 			// Check if it's a file that exists (like favicon.ico, robot.txt)
 			if info, err := os.Stat(path); err == nil && !info.IsDir() {
 				http.ServeFile(w, r, path)
@@ -89,19 +343,36 @@ func main() {
 	}
 
 	// CORS configuration
-	c := cors.New(cors.Options{
-		AllowedOrigins:   strings.Split(allowedOrigins, ","),
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	})
+	c := cors.New(corsOptions(origins))
 
 	handler := c.Handler(r)
 
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Allowed origins: %s", allowedOrigins)
 
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: handler,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	// WebSocket connections are hijacked, so the hub closes them itself
+	wsHub.Shutdown(5*time.Second, 3*time.Second)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown failed: %v", err)
 	}
 }
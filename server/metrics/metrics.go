@@ -0,0 +1,104 @@
+// Package metrics defines the Prometheus metrics exposed on /metrics
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ActiveRooms is the number of rooms with at least one connection
+	ActiveRooms = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bethel_active_rooms",
+		Help: "Rooms with at least one connected client.",
+	})
+
+	// ActiveConnections is the number of connected WebSocket clients
+	ActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bethel_active_connections",
+		Help: "Connected WebSocket clients.",
+	})
+
+	// RejectedConnections counts WebSocket clients turned away by the hub's
+	// capacity limits, by reason
+	RejectedConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bethel_rejected_connections_total",
+		Help: "WebSocket clients turned away at capacity, by reason.",
+	}, []string{"reason"})
+
+	// MessagesTotal counts inbound WebSocket messages by type
+	MessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bethel_messages_total",
+		Help: "WebSocket messages received, by message type.",
+	}, []string{"type"})
+
+	// DBQueryDuration observes database query latency by query name
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bethel_db_query_duration_seconds",
+		Help:    "Database query latency, by query.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+
+	// SendBufferDrops counts messages dropped because a client's send buffer was full
+	SendBufferDrops = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bethel_send_buffer_drops_total",
+		Help: "Messages dropped because a client's send buffer was full.",
+	})
+
+	// HTTPRequestDuration observes API latency by route and status
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bethel_http_request_duration_seconds",
+		Help:    "HTTP request latency, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+// ObserveQuery records how long a named database query took since start
+func ObserveQuery(query string, start time.Time) {
+	DBQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap exposes the underlying writer so WebSocket upgrades can hijack it
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware records request latency labelled by the matched route
+// template, so room IDs don't explode label cardinality
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		// Long-lived WebSocket connections would skew latency histograms
+		if route == "/ws/{roomId}" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		HTTPRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Bounds is the axis-aligned box enclosing a stroke's points
+type Bounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// StrokeBounds computes the box enclosing points. It reports false for a
+// stroke without points, which has no bounds.
+func StrokeBounds(points []Point) (Bounds, bool) {
+	if len(points) == 0 {
+		return Bounds{}, false
+	}
+	b := Bounds{MinX: points[0].X, MinY: points[0].Y, MaxX: points[0].X, MaxY: points[0].Y}
+	for _, p := range points[1:] {
+		b.MinX = min(b.MinX, p.X)
+		b.MinY = min(b.MinY, p.Y)
+		b.MaxX = max(b.MaxX, p.X)
+		b.MaxY = max(b.MaxY, p.Y)
+	}
+	return b, true
+}
+
+// Intersects reports whether the box overlaps the region (touching edges
+// included)
+func (b Bounds) Intersects(r Region) bool {
+	return b.MaxX >= r.X && b.MinX <= r.X+r.Width && b.MaxY >= r.Y && b.MinY <= r.Y+r.Height
+}
+
+// boundsArgs returns the min_x, min_y, max_x and max_y column values for a
+// stroke's points (NULLs when it has none)
+func boundsArgs(points []Point) []any {
+	b, ok := StrokeBounds(points)
+	if !ok {
+		return []any{nil, nil, nil, nil}
+	}
+	return []any{b.MinX, b.MinY, b.MaxX, b.MaxY}
+}
+
+// GetStrokesInRegion retrieves a room's strokes whose bounds overlap the
+// region, bottom to top. Strokes are matched on their stored bounds, so a
+// stroke may be returned without any of its points inside the region.
+func GetStrokesInRegion(ctx context.Context, pool *pgxpool.Pool, roomID string, r Region) ([]Stroke, error) {
+	return queryStrokes(ctx, pool,
+		`room_id = $1 AND deleted_at IS NULL AND max_x >= $2 AND min_x <= $3 AND max_y >= $4 AND min_y <= $5`,
+		roomID, r.X, r.X+r.Width, r.Y, r.Y+r.Height,
+	)
+}
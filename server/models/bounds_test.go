@@ -0,0 +1,95 @@
+package models_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestStrokeBounds(t *testing.T) {
+	if _, ok := models.StrokeBounds(nil); ok {
+		t.Error("stroke without points has bounds")
+	}
+
+	b, ok := models.StrokeBounds([]models.Point{{X: 3, Y: -1}, {X: -2, Y: 4}, {X: 10, Y: 0}})
+	if want := (models.Bounds{MinX: -2, MinY: -1, MaxX: 10, MaxY: 4}); !ok || b != want {
+		t.Errorf("bounds = %+v, want %+v", b, want)
+	}
+	if b, _ := models.StrokeBounds([]models.Point{{X: 5, Y: 6}}); b != (models.Bounds{MinX: 5, MinY: 6, MaxX: 5, MaxY: 6}) {
+		t.Errorf("single point bounds = %+v", b)
+	}
+}
+
+func TestBoundsIntersects(t *testing.T) {
+	b := models.Bounds{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10}
+	tests := []struct {
+		r    models.Region
+		want bool
+	}{
+		{models.Region{X: 5, Y: 5, Width: 1, Height: 1}, true},     // inside
+		{models.Region{X: -5, Y: -5, Width: 30, Height: 30}, true}, // around
+		{models.Region{X: 8, Y: -3, Width: 5, Height: 5}, true},    // corner overlap
+		{models.Region{X: 10, Y: 0, Width: 5, Height: 5}, true},    // touching edge
+		{models.Region{X: 11, Y: 0, Width: 5, Height: 5}, false},   // right
+		{models.Region{X: 0, Y: -6, Width: 5, Height: 5}, false},   // above
+	}
+	for _, tt := range tests {
+		if got := b.Intersects(tt.r); got != tt.want {
+			t.Errorf("Intersects(%+v) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestGetStrokesInRegion(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Spatial", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(points ...models.Point) string {
+		stroke := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: points}
+		if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+			t.Fatal(err)
+		}
+		return stroke.ID
+	}
+	// A diagonal crossing the region without a point inside it, one inside,
+	// one far away and one with no points
+	crossing := add(models.Point{X: 0, Y: 0}, models.Point{X: 100, Y: 100})
+	inside := add(models.Point{X: 45, Y: 45}, models.Point{X: 55, Y: 50})
+	far := add(models.Point{X: 500, Y: 500}, models.Point{X: 510, Y: 520})
+	add()
+
+	region := models.Region{X: 40, Y: 40, Width: 20, Height: 20}
+	ids := func() []string {
+		t.Helper()
+		strokes, err := models.GetStrokesInRegion(ctx, pool, room.ID, region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, s := range strokes {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	if got, want := ids(), []string{crossing, inside}; !slices.Equal(got, want) {
+		t.Errorf("strokes in region = %v, want %v", got, want)
+	}
+
+	// Stored bounds follow point updates
+	if err := models.UpdateStrokePoints(ctx, pool, room.ID, far, []models.Point{{X: 50, Y: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.UpdateStrokePoints(ctx, pool, room.ID, inside, []models.Point{{X: 900, Y: 900}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []string{crossing, far}; !slices.Equal(got, want) {
+		t.Errorf("strokes in region after updates = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestComputeChecksum(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	state := func() *models.RoomState {
+		return &models.RoomState{
+			Strokes:    []models.Stroke{{ID: "s1", UpdatedAt: at}, {ID: "s2", UpdatedAt: at}},
+			TextBlocks: []models.TextBlock{{ID: "t1", UpdatedAt: at}},
+			Shapes:     []models.Shape{{ID: "sh1", UpdatedAt: at}},
+			Images:     []models.Image{{ID: "i1", CreatedAt: at}},
+		}
+	}
+
+	base := state().ComputeChecksum()
+	if again := state().ComputeChecksum(); again != base {
+		t.Errorf("identical states hash to %s and %s", base, again)
+	}
+
+	// Stacking order and point data don't matter
+	reordered := state()
+	reordered.Strokes[0], reordered.Strokes[1] = reordered.Strokes[1], reordered.Strokes[0]
+	reordered.Strokes[0].Points = []models.Point{{X: 1, Y: 1}}
+	if sum := reordered.ComputeChecksum(); sum != base {
+		t.Errorf("reordered strokes hash to %s, want %s", sum, base)
+	}
+
+	for name, mutate := range map[string]func(*models.RoomState){
+		"stroke updated": func(s *models.RoomState) { s.Strokes[0].UpdatedAt = at.Add(time.Microsecond) },
+		"stroke removed": func(s *models.RoomState) { s.Strokes = s.Strokes[:1] },
+		"text added": func(s *models.RoomState) {
+			s.TextBlocks = append(s.TextBlocks, models.TextBlock{ID: "t2", UpdatedAt: at})
+		},
+		"shape updated":  func(s *models.RoomState) { s.Shapes[0].UpdatedAt = at.Add(time.Second) },
+		"image replaced": func(s *models.RoomState) { s.Images[0].ID = "i2" },
+	} {
+		s := state()
+		mutate(s)
+		if sum := s.ComputeChecksum(); sum == base {
+			t.Errorf("%s: checksum unchanged", name)
+		}
+	}
+}
+
+func TestGetRoomChecksum(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Checked", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stroke := &models.Stroke{RoomID: room.ID, Points: []models.Point{{X: 1, Y: 1}}, Color: "#000000", Tool: "pen"}
+	if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateTextBlock(ctx, pool, &models.TextBlock{RoomID: room.ID, Width: 100, Height: 40, Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The query and room_state agree
+	state, err := models.GetRoomState(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := models.GetRoomChecksum(ctx, pool, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != state.Checksum {
+		t.Errorf("GetRoomChecksum = %s, room_state checksum %s", sum, state.Checksum)
+	}
+
+	// Deleting a stroke changes it
+	if err := models.DeleteStroke(ctx, pool, room.ID, stroke.ID); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := models.GetRoomChecksum(ctx, pool, room.ID); err != nil || after == sum {
+		t.Errorf("checksum after a delete = %s (%v), want a change from %s", after, err, sum)
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MaxCoordinate bounds the magnitude of canvas coordinates and sizes
+// clients may store (0 only requires them to be finite)
+var MaxCoordinate = 1e6
+
+// ValidateCoordinate checks that a canvas value is finite and within
+// MaxCoordinate
+func ValidateCoordinate(field string, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid %s, must be a finite number", field)
+	}
+	if MaxCoordinate > 0 && math.Abs(v) > MaxCoordinate {
+		return fmt.Errorf("invalid %s %v, must be within ±%v", field, v, MaxCoordinate)
+	}
+	return nil
+}
+
+// ValidatePoints checks every point's coordinates and pressure
+func ValidatePoints(points []Point) error {
+	for _, p := range points {
+		if err := ValidateCoordinate("point x", p.X); err != nil {
+			return err
+		}
+		if err := ValidateCoordinate("point y", p.Y); err != nil {
+			return err
+		}
+		if math.IsNaN(p.Pressure) || math.IsInf(p.Pressure, 0) {
+			return errors.New("invalid point pressure, must be a finite number")
+		}
+	}
+	return nil
+}
+
+// validateCoordinates checks named canvas values, skipping nil ones
+func validateCoordinates(values map[string]*float64) error {
+	for _, field := range []string{"x", "y", "width", "height"} {
+		if v := values[field]; v != nil {
+			if err := ValidateCoordinate(field, *v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestValidateCoordinate(t *testing.T) {
+	for _, tc := range []struct {
+		v     float64
+		valid bool
+	}{
+		{0, true},
+		{-123.45, true},
+		{1e6, true},
+		{-1e6, true},
+		{1e6 + 1, false},
+		{-2e9, false},
+		{math.NaN(), false},
+		{math.Inf(1), false},
+		{math.Inf(-1), false},
+	} {
+		if err := models.ValidateCoordinate("x", tc.v); (err == nil) != tc.valid {
+			t.Errorf("ValidateCoordinate(%v) = %v, want valid %v", tc.v, err, tc.valid)
+		}
+	}
+
+	// Without a bound only non-finite values are rejected
+	bound := models.MaxCoordinate
+	t.Cleanup(func() { models.MaxCoordinate = bound })
+	models.MaxCoordinate = 0
+	if err := models.ValidateCoordinate("x", 1e300); err != nil {
+		t.Errorf("unbounded: %v", err)
+	}
+	if err := models.ValidateCoordinate("x", math.Inf(1)); err == nil {
+		t.Error("unbounded: Inf accepted")
+	}
+}
+
+func TestValidateElementCoordinates(t *testing.T) {
+	nan, huge, fine := math.NaN(), 1e9, 10.0
+
+	stroke := models.Stroke{Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}, {X: 2, Y: math.Inf(1)}}}
+	if err := stroke.Validate(); err == nil {
+		t.Error("stroke with an infinite point accepted")
+	}
+	stroke.Points[1] = models.Point{X: 2, Y: 2, Pressure: nan}
+	if err := stroke.Validate(); err == nil {
+		t.Error("stroke with a NaN pressure accepted")
+	}
+	stroke.Points[1].Pressure = 0.5
+	if err := stroke.Validate(); err != nil {
+		t.Errorf("valid stroke rejected: %v", err)
+	}
+
+	tb := models.TextBlock{X: 1, Y: 1, Width: huge, Height: 40, Color: "#000000"}
+	if err := tb.Validate(); err == nil {
+		t.Error("text block with an out-of-bound width accepted")
+	}
+	tb.Width = 100
+	if err := tb.Validate(); err != nil {
+		t.Errorf("valid text block rejected: %v", err)
+	}
+
+	if err := (&models.TextBlockUpdate{X: &fine, Y: &nan}).Validate(); err == nil {
+		t.Error("update with a NaN y accepted")
+	}
+	if err := (&models.TextBlockUpdate{X: &fine}).Validate(); err != nil {
+		t.Errorf("valid update rejected: %v", err)
+	}
+}
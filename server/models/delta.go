@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RoomDelta is what changed in a room after Since. Deletions aren't listed
+// individually; instead the IDs of every live element are sent so clients can
+// drop anything missing from them
+type RoomDelta struct {
+	Room  Room      `json:"room"`
+	Since time.Time `json:"since"`
+
+	// Elements created or changed after Since
+	Strokes    []Stroke    `json:"strokes"`
+	TextBlocks []TextBlock `json:"textBlocks"`
+	Shapes     []Shape     `json:"shapes"`
+	Images     []Image     `json:"images"`
+
+	// IDs of all elements currently in the room
+	StrokeIDs    []string `json:"strokeIds"`
+	TextBlockIDs []string `json:"textBlockIds"`
+	ShapeIDs     []string `json:"shapeIds"`
+	ImageIDs     []string `json:"imageIds"`
+}
+
+// GetRoomDelta retrieves the changes to a room after since
+func GetRoomDelta(ctx context.Context, pool *pgxpool.Pool, tenant string, roomID string, since time.Time) (*RoomDelta, error) {
+	room, err := GetRoom(ctx, pool, tenant, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &RoomDelta{Room: *room, Since: since}
+
+	if delta.Strokes, err = GetStrokesUpdatedSince(ctx, pool, roomID, since); err != nil {
+		return nil, err
+	}
+	if delta.TextBlocks, err = GetTextBlocksUpdatedSince(ctx, pool, roomID, since); err != nil {
+		return nil, err
+	}
+	if delta.Shapes, err = GetShapesUpdatedSince(ctx, pool, roomID, since); err != nil {
+		return nil, err
+	}
+	if delta.Images, err = GetImagesAddedSince(ctx, pool, roomID, since); err != nil {
+		return nil, err
+	}
+
+	if err := getLiveElementIDs(ctx, pool, roomID, delta); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// getLiveElementIDs fills in the IDs of every element in the room
+func getLiveElementIDs(ctx context.Context, pool *pgxpool.Pool, roomID string, delta *RoomDelta) error {
+	rows, err := pool.Query(ctx,
+		`SELECT 'stroke', id FROM strokes WHERE room_id = $1 AND deleted_at IS NULL
+		 UNION ALL SELECT 'text', id FROM text_blocks WHERE room_id = $1
+		 UNION ALL SELECT 'shape', id FROM shapes WHERE room_id = $1
+		 UNION ALL SELECT 'image', id FROM images WHERE room_id = $1`,
+		roomID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	delta.StrokeIDs = []string{}
+	delta.TextBlockIDs = []string{}
+	delta.ShapeIDs = []string{}
+	delta.ImageIDs = []string{}
+	for rows.Next() {
+		var kind, id string
+		if err := rows.Scan(&kind, &id); err != nil {
+			return err
+		}
+		switch kind {
+		case "stroke":
+			delta.StrokeIDs = append(delta.StrokeIDs, id)
+		case "text":
+			delta.TextBlockIDs = append(delta.TextBlockIDs, id)
+		case "shape":
+			delta.ShapeIDs = append(delta.ShapeIDs, id)
+		case "image":
+			delta.ImageIDs = append(delta.ImageIDs, id)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,75 @@
+package models_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestGetRoomDelta(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Flaky", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newStroke := func() *models.Stroke {
+		stroke := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}}}
+		if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+			t.Fatal(err)
+		}
+		return stroke
+	}
+	old, doomed := newStroke(), newStroke()
+	tb := &models.TextBlock{RoomID: room.ID, Content: "before"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	fresh := newStroke()
+	content := "after"
+	if _, err := models.UpdateTextBlock(ctx, pool, room.ID, tb.ID, &models.TextBlockUpdate{Content: &content}, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DeleteStroke(ctx, pool, room.ID, doomed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	delta, err := models.GetRoomDelta(ctx, pool, "", room.ID, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta.Strokes) != 1 || delta.Strokes[0].ID != fresh.ID {
+		t.Errorf("changed strokes %+v, want only the new one", delta.Strokes)
+	}
+	if len(delta.TextBlocks) != 1 || delta.TextBlocks[0].Content != "after" {
+		t.Errorf("changed text blocks %+v, want the edited one", delta.TextBlocks)
+	}
+
+	// The deleted stroke shows up as missing from the live IDs
+	ids := slices.Clone(delta.StrokeIDs)
+	slices.Sort(ids)
+	want := []string{old.ID, fresh.ID}
+	slices.Sort(want)
+	if !slices.Equal(ids, want) {
+		t.Errorf("live stroke IDs %v, want %v", ids, want)
+	}
+
+	// A sync from before everything returns it all
+	full, err := models.GetRoomDelta(ctx, pool, "", room.ID, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Strokes) != 2 || len(full.TextBlocks) != 1 {
+		t.Errorf("delta since zero time: %d strokes, %d text blocks; want 2 and 1", len(full.Strokes), len(full.TextBlocks))
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+// Region is an axis-aligned rectangle on the canvas
+type Region struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Validate checks the region has a finite, non-empty area
+func (r *Region) Validate() error {
+	for _, v := range []float64{r.X, r.Y, r.Width, r.Height} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("region coordinates must be finite")
+		}
+	}
+	if r.Width <= 0 || r.Height <= 0 {
+		return errors.New("region must have a positive width and height")
+	}
+	return nil
+}
+
+// Contains reports whether p lies inside the region (edges included)
+func (r Region) Contains(p Point) bool {
+	return p.X >= r.X && p.X <= r.X+r.Width && p.Y >= r.Y && p.Y <= r.Y+r.Height
+}
+
+// ErasePoints removes the points inside the region from a stroke's points.
+// It reports whether any point was erased, and returns the runs of points
+// left on either side of each erased stretch. Runs of a single point are
+// dropped since they no longer draw a line, so an empty result means the
+// stroke is gone entirely.
+func ErasePoints(points []Point, r Region) (pieces [][]Point, erased bool) {
+	var run []Point
+	for _, p := range points {
+		if r.Contains(p) {
+			erased = true
+			if len(run) > 1 {
+				pieces = append(pieces, run)
+			}
+			run = nil
+			continue
+		}
+		run = append(run, p)
+	}
+	if !erased {
+		return [][]Point{points}, false
+	}
+	if len(run) > 1 {
+		pieces = append(pieces, run)
+	}
+	return pieces, true
+}
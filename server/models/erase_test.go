@@ -0,0 +1,71 @@
+package models_test
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// line returns points along y=0 at each x
+func line(xs ...float64) []models.Point {
+	points := make([]models.Point, len(xs))
+	for i, x := range xs {
+		points[i] = models.Point{X: x}
+	}
+	return points
+}
+
+// xs lists the x coordinates of each piece
+func xs(pieces [][]models.Point) [][]float64 {
+	var out [][]float64
+	for _, piece := range pieces {
+		var row []float64
+		for _, p := range piece {
+			row = append(row, p.X)
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func TestErasePoints(t *testing.T) {
+	region := models.Region{X: 10, Y: -5, Width: 10, Height: 10} // x from 10 to 20
+
+	tests := []struct {
+		name   string
+		points []models.Point
+		pieces [][]float64
+		erased bool
+	}{
+		{"outside", line(0, 1, 2), [][]float64{{0, 1, 2}}, false},
+		{"contained", line(11, 15, 19), nil, true},
+		{"edges count as inside", line(10, 20), nil, true},
+		{"overlapping one end", line(0, 5, 12, 15), [][]float64{{0, 5}}, true},
+		{"crossing the middle", line(0, 5, 15, 25, 30), [][]float64{{0, 5}, {25, 30}}, true},
+		{"single points left behind are dropped", line(5, 15, 25, 30), [][]float64{{25, 30}}, true},
+	}
+	for _, tt := range tests {
+		pieces, erased := models.ErasePoints(tt.points, region)
+		if erased != tt.erased || !slices.EqualFunc(xs(pieces), tt.pieces, slices.Equal[[]float64]) {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, xs(pieces), erased, tt.pieces, tt.erased)
+		}
+	}
+}
+
+func TestRegionValidate(t *testing.T) {
+	for _, r := range []models.Region{
+		{Width: 0, Height: 1},
+		{Width: 1, Height: -1},
+		{X: math.NaN(), Width: 1, Height: 1},
+		{Width: math.Inf(1), Height: 1},
+	} {
+		if r.Validate() == nil {
+			t.Errorf("region %+v accepted", r)
+		}
+	}
+	if err := (&models.Region{X: -5, Y: -5, Width: 1, Height: 1}).Validate(); err != nil {
+		t.Errorf("valid region rejected: %v", err)
+	}
+}
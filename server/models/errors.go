@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrLocked is returned when modifying an element that has been locked
+	ErrLocked = errors.New("element is locked")
+
+	// ErrConflict is returned when a conditional write finds newer data than the caller expected
+	ErrConflict = errors.New("room changed since last sync")
+
+	// ErrStaleVersion is returned when a versioned update targets an element
+	// that has been changed since the caller's version
+	ErrStaleVersion = errors.New("element changed since the given version")
+
+	// ErrRoomExists is returned when creating a room with an ID already in use
+	ErrRoomExists = errors.New("room already exists")
+
+	// ErrNotOwner is returned when a destructive room operation lacks the owner token
+	ErrNotOwner = errors.New("not the room owner")
+
+	// ErrWrongPassword is returned when a protected room is accessed without its password
+	ErrWrongPassword = errors.New("wrong room password")
+
+	// ErrTitleRequired is returned when renaming a room to a blank title
+	ErrTitleRequired = errors.New("title is required")
+
+	// ErrTitleTooLong is returned when a room title exceeds MaxTitleLength
+	ErrTitleTooLong = fmt.Errorf("title is longer than %d characters", MaxTitleLength)
+
+	// ErrInvalidDiff is returned when a text diff does not fit the current content
+	ErrInvalidDiff = errors.New("text diff out of range")
+)
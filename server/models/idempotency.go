@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdempotencyKeyTTL is how long a room creation key is remembered
+const IdempotencyKeyTTL = 24 * time.Hour
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{8,255}$`)
+
+// IsValidIdempotencyKey reports whether key is 8-255 URL-safe characters
+func IsValidIdempotencyKey(key string) bool {
+	return idempotencyKeyPattern.MatchString(key)
+}
+
+// CreateRoomOnce creates a room unless one was already created with the same
+// idempotency key in the same tenant within IdempotencyKeyTTL, in which case
+// that room is returned instead. It reports whether a new room was created.
+func CreateRoomOnce(ctx context.Context, pool *pgxpool.Pool, key string, id string, title string, opts RoomOptions) (*Room, bool, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize concurrent retries carrying the same key
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`, opts.Tenant, key); err != nil {
+		return nil, false, err
+	}
+
+	// Expire old keys
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM idempotency_keys WHERE created_at < $1`,
+		time.Now().Add(-IdempotencyKeyTTL),
+	); err != nil {
+		return nil, false, err
+	}
+
+	existing := &Room{}
+	err = scanRoom(tx.QueryRow(ctx,
+		`SELECT `+roomColumns+` FROM rooms
+		 WHERE id = (SELECT room_id FROM idempotency_keys WHERE tenant = $2 AND key = $1) AND tenant = $2`,
+		key, opts.Tenant,
+	), existing)
+	if err == nil {
+		return existing, false, tx.Commit(ctx)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	room := newRoom(id, title, opts)
+	if err := insertRoom(ctx, tx, room); err != nil {
+		return nil, false, err
+	}
+
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO idempotency_keys (tenant, key, room_id, created_at) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (tenant, key) DO UPDATE SET room_id = EXCLUDED.room_id, created_at = EXCLUDED.created_at`,
+		opts.Tenant, key, room.ID, room.CreatedAt,
+	); err != nil {
+		return nil, false, err
+	}
+
+	return room, true, tx.Commit(ctx)
+}
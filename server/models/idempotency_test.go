@@ -0,0 +1,80 @@
+package models_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestCreateRoomOnceScopedByTenant(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	const key = "retry-key-1"
+
+	acme, created, err := models.CreateRoomOnce(ctx, pool, key, "", "Acme", models.RoomOptions{Tenant: "acme"})
+	if err != nil || !created {
+		t.Fatalf("first create: created %v, err %v", created, err)
+	}
+
+	// Another tenant using the same key gets its own room
+	globex, created, err := models.CreateRoomOnce(ctx, pool, key, "", "Globex", models.RoomOptions{Tenant: "globex"})
+	if err != nil || !created {
+		t.Fatalf("create by another tenant: created %v, err %v", created, err)
+	}
+	if globex.ID == acme.ID || globex.Tenant != "globex" {
+		t.Errorf("another tenant got room %q of tenant %q", globex.ID, globex.Tenant)
+	}
+
+	// A retry within the tenant still returns the original
+	for tenant, want := range map[string]string{"acme": acme.ID, "globex": globex.ID} {
+		room, created, err := models.CreateRoomOnce(ctx, pool, key, "", "Retry", models.RoomOptions{Tenant: tenant})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created || room.ID != want {
+			t.Errorf("retry in %s: room %q (created %v), want %q", tenant, room.ID, created, want)
+		}
+	}
+}
+
+func TestIsValidIdempotencyKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"3f1c2a7e-9b4d-4e21-8c5a-1d2e3f4a5b6c": true,
+		"order:42.retry_1":                     true,
+		"short":                                false,
+		"has spaces in it":                     false,
+		"slash/not/allowed":                    false,
+		strings.Repeat("k", 255):               true,
+		strings.Repeat("k", 256):               false,
+	} {
+		if got := models.IsValidIdempotencyKey(key); got != want {
+			t.Errorf("IsValidIdempotencyKey(%.20q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestCreateRoomOnceKeyExpires(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+	const key = "expiring-key"
+
+	first, _, err := models.CreateRoomOnce(ctx, pool, key, "", "First", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE idempotency_keys SET created_at = $1`, time.Now().Add(-models.IdempotencyKeyTTL-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	second, created, err := models.CreateRoomOnce(ctx, pool, key, "", "Second", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || second.ID == first.ID {
+		t.Errorf("expired key returned room %q (created %v), want a new room", second.ID, created)
+	}
+}
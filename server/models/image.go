@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Image represents an uploaded picture placed on the canvas
+type Image struct {
+	ID          string    `json:"id"`
+	RoomID      string    `json:"roomId,omitempty"`
+	X           float64   `json:"x"`
+	Y           float64   `json:"y"`
+	Width       float64   `json:"width"`
+	Height      float64   `json:"height"`
+	URL         string    `json:"url"`
+	Key         string    `json:"-"` // storage key of the uploaded file
+	ContentType string    `json:"contentType"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+}
+
+// CreateImage saves a new image record to the database
+func CreateImage(ctx context.Context, pool *pgxpool.Pool, img *Image) error {
+	if img.ID == "" {
+		img.ID = uuid.New().String()
+	}
+	img.CreatedAt = time.Now()
+
+	_, err := pool.Exec(ctx,
+		`INSERT INTO images (id, room_id, x, y, width, height, url, storage_key, content_type, created_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		img.ID, img.RoomID, img.X, img.Y, img.Width, img.Height, img.URL, img.Key, img.ContentType, img.CreatedAt, img.CreatedBy,
+	)
+	return err
+}
+
+// imageColumns is the column list scanned by scanImage
+const imageColumns = `id, room_id, x, y, width, height, url, storage_key, content_type, created_at, created_by`
+
+func scanImage(row pgx.Row, img *Image) error {
+	return row.Scan(&img.ID, &img.RoomID, &img.X, &img.Y, &img.Width, &img.Height, &img.URL, &img.Key, &img.ContentType, &img.CreatedAt, &img.CreatedBy)
+}
+
+// GetImagesByRoom retrieves all images for a room
+func GetImagesByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) ([]Image, error) {
+	return queryImages(ctx, pool, `room_id = $1`, roomID)
+}
+
+// GetImagesAddedSince retrieves a room's images added after since
+func GetImagesAddedSince(ctx context.Context, pool *pgxpool.Pool, roomID string, since time.Time) ([]Image, error) {
+	return queryImages(ctx, pool, `room_id = $1 AND created_at > $2`, roomID, since)
+}
+
+// queryImages retrieves the images matching where, oldest first
+func queryImages(ctx context.Context, pool *pgxpool.Pool, where string, args ...any) ([]Image, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+imageColumns+` FROM images WHERE `+where+` ORDER BY created_at ASC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []Image{}
+	for rows.Next() {
+		var img Image
+		if err := scanImage(rows, &img); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// GetImage retrieves a single image of a room by ID
+func GetImage(ctx context.Context, pool *pgxpool.Pool, roomID, id string) (*Image, error) {
+	img := &Image{}
+	row := pool.QueryRow(ctx, `SELECT `+imageColumns+` FROM images WHERE id = $1 AND room_id = $2`, id, roomID)
+	if err := scanImage(row, img); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DeleteImage deletes an image record
+func DeleteImage(ctx context.Context, pool *pgxpool.Pool, roomID, id string) error {
+	_, err := pool.Exec(ctx, `DELETE FROM images WHERE id = $1 AND room_id = $2`, id, roomID)
+	return err
+}
+
+// collectStorageKeys reads the storage_key column of deleted image rows,
+// skipping imported copies, which have no file of their own
+func collectStorageKeys(rows pgx.Rows) ([]string, error) {
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(keys, func(key string) bool { return key == "" }), nil
+}
+
+// ReferencedStorageKeys returns which of keys are still used by an image
+func ReferencedStorageKeys(ctx context.Context, pool *pgxpool.Pool, keys []string) (map[string]bool, error) {
+	rows, err := pool.Query(ctx, `SELECT DISTINCT storage_key FROM images WHERE storage_key = ANY($1)`, keys)
+	if err != nil {
+		return nil, err
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool, len(found))
+	for _, key := range found {
+		referenced[key] = true
+	}
+	return referenced, nil
+}
@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestUploadReferences(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Pictures", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, img := range []*models.Image{
+		{RoomID: room.ID, URL: "/uploads/a.png", Key: "a.png"},
+		{RoomID: room.ID, URL: "/uploads/b.png", Key: "b.png"},
+		{RoomID: room.ID, URL: "https://example.com/c.png"}, // imported, no file
+	} {
+		if err := models.CreateImage(ctx, pool, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	referenced, err := models.ReferencedStorageKeys(ctx, pool, []string{"a.png", "b.png", "orphan.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !referenced["a.png"] || !referenced["b.png"] || referenced["orphan.png"] {
+		t.Errorf("referenced = %v, want a.png and b.png only", referenced)
+	}
+
+	// Purging the room hands back its files for deletion
+	if err := models.DeleteRoom(ctx, pool, room.ID); err != nil {
+		t.Fatal(err)
+	}
+	purged, keys, err := models.PurgeDeletedRooms(ctx, pool, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if purged != 1 || !slices.Equal(keys, []string{"a.png", "b.png"}) {
+		t.Errorf("purge = %d rooms, keys %v; want 1 room, [a.png b.png]", purged, keys)
+	}
+
+	referenced, err = models.ReferencedStorageKeys(ctx, pool, []string{"a.png", "b.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referenced) != 0 {
+		t.Errorf("keys still referenced after purge: %v", referenced)
+	}
+}
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Validate checks that an exported room state can be imported
+func (s *RoomState) Validate() error {
+	if err := s.Room.Defaults.Validate(); err != nil {
+		return err
+	}
+	for i, stroke := range s.Strokes {
+		if err := stroke.Validate(); err != nil {
+			return fmt.Errorf("stroke %d: %w", i, err)
+		}
+	}
+	for i, tb := range s.TextBlocks {
+		if err := tb.Validate(); err != nil {
+			return fmt.Errorf("text block %d: %w", i, err)
+		}
+	}
+	for i := range s.Shapes {
+		if err := s.Shapes[i].Validate(); err != nil {
+			return fmt.Errorf("shape %d: %w", i, err)
+		}
+	}
+	for i, img := range s.Images {
+		if img.URL == "" {
+			return fmt.Errorf("image %d: missing url", i)
+		}
+		u, err := url.Parse(img.URL)
+		if err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("image %d: invalid url", i)
+		}
+	}
+	return nil
+}
+
+// ImportRoom creates a new room from an exported RoomState, with a generated
+// ID if id is empty. Every element gets a fresh ID; geometry, styling and
+// element order are kept. Images keep their URL and storage key, so the
+// caller copies their files into the new room first. Everything is written
+// in one transaction so a failure leaves no trace.
+func ImportRoom(ctx context.Context, pool *pgxpool.Pool, state *RoomState, id string, title string, tenant string) (*RoomState, error) {
+	if title == "" {
+		title = state.Room.Title
+	}
+	room := newRoom(id, title, RoomOptions{Defaults: state.Room.Defaults, Tenant: tenant})
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertRoom(ctx, tx, room); err != nil {
+		return nil, err
+	}
+
+	// Elements are listed oldest first; space out created_at so they load
+	// back in the same order
+	now := time.Now()
+
+	strokes := make([]Stroke, len(state.Strokes))
+	strokeRows := make([][]any, len(state.Strokes))
+	for i, src := range state.Strokes {
+		stroke := Stroke{
+			ID:        uuid.New().String(),
+			RoomID:    room.ID,
+			Points:    src.Points,
+			Color:     src.Color,
+			Tool:      src.Tool,
+			Locked:    src.Locked,
+			CreatedAt: now.Add(time.Duration(i) * time.Microsecond),
+			UpdatedAt: now,
+			CreatedBy: src.CreatedBy,
+		}
+		if stroke.Points == nil {
+			stroke.Points = []Point{}
+		}
+		pointsJSON, err := json.Marshal(stroke.Points)
+		if err != nil {
+			return nil, err
+		}
+		strokes[i] = stroke
+		strokeRows[i] = append([]any{stroke.ID, stroke.RoomID, pointsJSON, stroke.Color, stroke.Tool, stroke.Locked, stroke.CreatedAt, stroke.UpdatedAt, stroke.CreatedBy}, boundsArgs(stroke.Points)...)
+	}
+
+	textBlocks := make([]TextBlock, len(state.TextBlocks))
+	textRows := make([][]any, len(state.TextBlocks))
+	for i, src := range state.TextBlocks {
+		tb := src
+		tb.ID = uuid.New().String()
+		tb.RoomID = room.ID
+		tb.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		tb.UpdatedAt = now
+		tb.Version = 1
+		tb.ApplyDefaults()
+		textBlocks[i] = tb
+		textRows[i] = []any{tb.ID, tb.RoomID, tb.X, tb.Y, tb.Width, tb.Height, tb.Content, tb.FontSize, tb.Color, tb.FontFamily, tb.Locked, tb.CreatedAt, tb.UpdatedAt, tb.CreatedBy, tb.UpdatedBy}
+	}
+
+	shapes := make([]Shape, len(state.Shapes))
+	shapeRows := make([][]any, len(state.Shapes))
+	for i, src := range state.Shapes {
+		shape := src
+		shape.ID = uuid.New().String()
+		shape.RoomID = room.ID
+		shape.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		shape.UpdatedAt = now
+		shapes[i] = shape
+		shapeRows[i] = []any{shape.ID, shape.RoomID, shape.Type, shape.X, shape.Y, shape.Width, shape.Height, shape.StrokeColor, shape.FillColor, shape.StrokeWidth, shape.CreatedAt, shape.UpdatedAt}
+	}
+
+	images := make([]Image, len(state.Images))
+	imageRows := make([][]any, len(state.Images))
+	for i, src := range state.Images {
+		img := src
+		img.ID = uuid.New().String()
+		img.RoomID = room.ID
+		img.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		images[i] = img
+		imageRows[i] = []any{img.ID, img.RoomID, img.X, img.Y, img.Width, img.Height, img.URL, img.Key, img.ContentType, img.CreatedAt, img.CreatedBy}
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"strokes"},
+		[]string{"id", "room_id", "points", "color", "tool", "locked", "created_at", "updated_at", "created_by", "min_x", "min_y", "max_x", "max_y"},
+		pgx.CopyFromRows(strokeRows),
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"text_blocks"},
+		[]string{"id", "room_id", "x", "y", "width", "height", "content", "font_size", "color", "font_family", "locked", "created_at", "updated_at", "created_by", "updated_by"},
+		pgx.CopyFromRows(textRows),
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"shapes"},
+		[]string{"id", "room_id", "type", "x", "y", "width", "height", "stroke_color", "fill_color", "stroke_width", "created_at", "updated_at"},
+		pgx.CopyFromRows(shapeRows),
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"images"},
+		[]string{"id", "room_id", "x", "y", "width", "height", "url", "storage_key", "content_type", "created_at", "created_by"},
+		pgx.CopyFromRows(imageRows),
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &RoomState{Room: *room, Strokes: strokes, TextBlocks: textBlocks, Shapes: shapes, Images: images}, nil
+}
+
+// RestoreRoomContent puts the content taken from a room back into it with
+// its original IDs, timestamps and stroke seq, e.g. to undo a clear.
+func RestoreRoomContent(ctx context.Context, pool *pgxpool.Pool, roomID string, content *RoomState) error {
+	strokeRows := make([][]any, len(content.Strokes))
+	for i, stroke := range content.Strokes {
+		points := stroke.Points
+		if points == nil {
+			points = []Point{}
+		}
+		pointsJSON, err := json.Marshal(points)
+		if err != nil {
+			return err
+		}
+		strokeRows[i] = append([]any{stroke.ID, roomID, pointsJSON, stroke.Color, stroke.Tool, stroke.Locked, stroke.CreatedAt, stroke.UpdatedAt, stroke.CreatedBy, stroke.Seq}, boundsArgs(points)...)
+	}
+
+	textRows := make([][]any, len(content.TextBlocks))
+	for i, tb := range content.TextBlocks {
+		textRows[i] = []any{tb.ID, roomID, tb.X, tb.Y, tb.Width, tb.Height, tb.Content, tb.FontSize, tb.Color, tb.FontFamily, tb.Locked, tb.CreatedAt, tb.UpdatedAt, tb.CreatedBy, tb.UpdatedBy, tb.Version}
+	}
+
+	shapeRows := make([][]any, len(content.Shapes))
+	for i, sh := range content.Shapes {
+		shapeRows[i] = []any{sh.ID, roomID, sh.Type, sh.X, sh.Y, sh.Width, sh.Height, sh.StrokeColor, sh.FillColor, sh.StrokeWidth, sh.CreatedAt, sh.UpdatedAt}
+	}
+
+	imageRows := make([][]any, len(content.Images))
+	for i, img := range content.Images {
+		imageRows[i] = []any{img.ID, roomID, img.X, img.Y, img.Width, img.Height, img.URL, img.Key, img.ContentType, img.CreatedAt, img.CreatedBy}
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"strokes"},
+		[]string{"id", "room_id", "points", "color", "tool", "locked", "created_at", "updated_at", "created_by", "seq", "min_x", "min_y", "max_x", "max_y"},
+		pgx.CopyFromRows(strokeRows),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"text_blocks"},
+		[]string{"id", "room_id", "x", "y", "width", "height", "content", "font_size", "color", "font_family", "locked", "created_at", "updated_at", "created_by", "updated_by", "version"},
+		pgx.CopyFromRows(textRows),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"shapes"},
+		[]string{"id", "room_id", "type", "x", "y", "width", "height", "stroke_color", "fill_color", "stroke_width", "created_at", "updated_at"},
+		pgx.CopyFromRows(shapeRows),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"images"},
+		[]string{"id", "room_id", "x", "y", "width", "height", "url", "storage_key", "content_type", "created_at", "created_by"},
+		pgx.CopyFromRows(imageRows),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE rooms SET updated_at = $1 WHERE id = $2`, time.Now(), roomID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
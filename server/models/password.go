@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordLength is the longest room password accepted, in bytes (the
+// bcrypt input limit)
+const MaxPasswordLength = 72
+
+// hashRoomPassword returns the stored form of a room password; an empty
+// password stores no hash
+func hashRoomPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// SetRoomPassword protects a room with password, or removes its protection
+// when password is empty
+func SetRoomPassword(ctx context.Context, pool *pgxpool.Pool, id string, password string) error {
+	hash, err := hashRoomPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(ctx,
+		`UPDATE rooms SET password_hash = $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`,
+		id, hash,
+	)
+	return err
+}
+
+// VerifyRoomPassword checks password against the room's password. It returns
+// pgx.ErrNoRows if the room does not exist within the tenant and
+// ErrWrongPassword on a mismatch. Rooms without a password accept any caller.
+func VerifyRoomPassword(ctx context.Context, pool *pgxpool.Pool, tenant string, id string, password string) error {
+	var stored string
+	err := pool.QueryRow(ctx,
+		`SELECT password_hash FROM rooms WHERE id = $1 AND tenant = $2 AND deleted_at IS NULL`,
+		id, tenant,
+	).Scan(&stored)
+	if err != nil {
+		return err
+	}
+
+	if stored == "" {
+		return nil
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrWrongPassword
+	}
+	return err
+}
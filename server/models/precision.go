@@ -0,0 +1,78 @@
+package models
+
+import "math"
+
+// roundTo rounds v to the given number of decimal places
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// RoundPoints rounds point coordinates in place to the given number of
+// decimal places. Negative decimals leave the points untouched.
+func RoundPoints(points []Point, decimals int) {
+	if decimals < 0 {
+		return
+	}
+	for i := range points {
+		points[i].X = roundTo(points[i].X, decimals)
+		points[i].Y = roundTo(points[i].Y, decimals)
+	}
+}
+
+// RoundCoordinates rounds the block's position and size in place
+func (tb *TextBlock) RoundCoordinates(decimals int) {
+	if decimals < 0 {
+		return
+	}
+	tb.X = roundTo(tb.X, decimals)
+	tb.Y = roundTo(tb.Y, decimals)
+	tb.Width = roundTo(tb.Width, decimals)
+	tb.Height = roundTo(tb.Height, decimals)
+}
+
+// RoundCoordinates rounds any position and size fields in the update in place
+func (u *TextBlockUpdate) RoundCoordinates(decimals int) {
+	if decimals < 0 {
+		return
+	}
+	for _, v := range []*float64{u.X, u.Y, u.Width, u.Height} {
+		if v != nil {
+			*v = roundTo(*v, decimals)
+		}
+	}
+}
+
+// RoundCoordinates rounds the shape's bounds in place
+func (s *Shape) RoundCoordinates(decimals int) {
+	if decimals < 0 {
+		return
+	}
+	s.X = roundTo(s.X, decimals)
+	s.Y = roundTo(s.Y, decimals)
+	s.Width = roundTo(s.Width, decimals)
+	s.Height = roundTo(s.Height, decimals)
+}
+
+// RoundCoordinates rounds any bounds fields in the update in place
+func (u *ShapeUpdate) RoundCoordinates(decimals int) {
+	if decimals < 0 {
+		return
+	}
+	for _, v := range []*float64{u.X, u.Y, u.Width, u.Height} {
+		if v != nil {
+			*v = roundTo(*v, decimals)
+		}
+	}
+}
+
+// RoundCoordinates rounds the image's position and size in place
+func (img *Image) RoundCoordinates(decimals int) {
+	if decimals < 0 {
+		return
+	}
+	img.X = roundTo(img.X, decimals)
+	img.Y = roundTo(img.Y, decimals)
+	img.Width = roundTo(img.Width, decimals)
+	img.Height = roundTo(img.Height, decimals)
+}
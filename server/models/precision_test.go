@@ -0,0 +1,82 @@
+package models_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestRoundPoints(t *testing.T) {
+	points := []models.Point{{X: 1.23456, Y: -7.891, Pressure: 0.123456}}
+
+	models.RoundPoints(points, -1)
+	if points[0].X != 1.23456 {
+		t.Errorf("negative precision changed X to %v", points[0].X)
+	}
+
+	models.RoundPoints(points, 1)
+	want := models.Point{X: 1.2, Y: -7.9, Pressure: 0.123456}
+	if points[0] != want {
+		t.Errorf("rounded to %+v, want %+v", points[0], want)
+	}
+}
+
+// penStroke mimics a freehand stroke as browsers report it: pointer
+// positions with long fractional parts from devicePixelRatio scaling
+func penStroke(n int) []models.Point {
+	r := rand.New(rand.NewSource(1))
+	points := make([]models.Point, n)
+	x, y := 120.0, 80.0
+	for i := range points {
+		x += math.Cos(float64(i)/20)*3 + r.Float64()/3
+		y += math.Sin(float64(i)/15)*3 + r.Float64()/3
+		points[i] = models.Point{X: x, Y: y, Pressure: 0.5}
+	}
+	return points
+}
+
+// TestRoundPointsPayloadSize measures what rounding saves on the encoded
+// points, which is what goes into the JSONB column and over the wire.
+// With 2000 points: full precision ≈ 124 KB, 2 decimals ≈ 77 KB, 1 decimal ≈ 73 KB;
+// the keys and pressure values make up most of what is left.
+func TestRoundPointsPayloadSize(t *testing.T) {
+	full, err := json.Marshal(penStroke(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decimals := range []int{2, 1} {
+		points := penStroke(2000)
+		models.RoundPoints(points, decimals)
+		rounded, err := json.Marshal(points)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ratio := float64(len(rounded)) / float64(len(full))
+		t.Logf("%d decimals: %d bytes, %.0f%% of %d at full precision", decimals, len(rounded), ratio*100, len(full))
+		if ratio > 0.7 {
+			t.Errorf("%d decimals only shrank the points to %.0f%%", decimals, ratio*100)
+		}
+	}
+}
+
+func BenchmarkEncodePoints(b *testing.B) {
+	for _, decimals := range []int{-1, 2, 1} {
+		points := penStroke(500)
+		models.RoundPoints(points, decimals)
+		b.Run(fmt.Sprintf("decimals=%d", decimals), func(b *testing.B) {
+			var size int
+			for b.Loop() {
+				data, err := json.Marshal(points)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/stroke")
+		})
+	}
+}
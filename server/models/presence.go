@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ParticipantSession is one connection's stay in a room
+type ParticipantSession struct {
+	ParticipantID string     `json:"participantId"`
+	RoomID        string     `json:"roomId,omitempty"`
+	Name          string     `json:"name"`
+	JoinedAt      time.Time  `json:"joinedAt"`
+	LeftAt        *time.Time `json:"leftAt,omitempty"` // nil while still connected
+}
+
+// ConcurrencyPoint is the number of participants present from At onwards
+type ConcurrencyPoint struct {
+	At    time.Time `json:"at"`
+	Count int       `json:"count"`
+}
+
+// RoomPresence is the presence history of a room, for analytics
+type RoomPresence struct {
+	Sessions       []ParticipantSession `json:"sessions"`
+	Timeline       []ConcurrencyPoint   `json:"timeline"`
+	PeakConcurrent int                  `json:"peakConcurrent"`
+}
+
+// RecordSessionStart stores the start of a participant session
+func RecordSessionStart(ctx context.Context, pool *pgxpool.Pool, session *ParticipantSession) error {
+	_, err := pool.Exec(ctx,
+		`INSERT INTO participant_sessions (participant_id, room_id, name, joined_at)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (participant_id) DO UPDATE SET name = EXCLUDED.name, joined_at = EXCLUDED.joined_at`,
+		session.ParticipantID, session.RoomID, session.Name, session.JoinedAt,
+	)
+	return err
+}
+
+// RecordSessionEnd stores the end of a participant session. It also creates
+// the row if the start has not been written yet.
+func RecordSessionEnd(ctx context.Context, pool *pgxpool.Pool, session *ParticipantSession) error {
+	_, err := pool.Exec(ctx,
+		`INSERT INTO participant_sessions (participant_id, room_id, name, joined_at, left_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (participant_id) DO UPDATE SET left_at = EXCLUDED.left_at`,
+		session.ParticipantID, session.RoomID, session.Name, session.JoinedAt, session.LeftAt,
+	)
+	return err
+}
+
+// GetRoomPresence retrieves a room's sessions and the concurrent participant
+// count over time
+func GetRoomPresence(ctx context.Context, pool *pgxpool.Pool, roomID string) (*RoomPresence, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT participant_id, name, joined_at, left_at
+		 FROM participant_sessions WHERE room_id = $1 ORDER BY joined_at ASC`,
+		roomID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []ParticipantSession{}
+	for rows.Next() {
+		var session ParticipantSession
+		if err := rows.Scan(&session.ParticipantID, &session.Name, &session.JoinedAt, &session.LeftAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	timeline, peak := concurrencyTimeline(sessions)
+
+	return &RoomPresence{
+		Sessions:       sessions,
+		Timeline:       timeline,
+		PeakConcurrent: peak,
+	}, nil
+}
+
+// concurrencyTimeline sweeps join/leave events into a step function of
+// participant counts, returning it along with the peak count
+func concurrencyTimeline(sessions []ParticipantSession) ([]ConcurrencyPoint, int) {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+
+	events := make([]event, 0, len(sessions)*2)
+	for _, s := range sessions {
+		events = append(events, event{s.JoinedAt, 1})
+		if s.LeftAt != nil {
+			events = append(events, event{*s.LeftAt, -1})
+		}
+	}
+
+	// Leaves sort before joins at the same instant so reconnects don't double count
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	timeline := []ConcurrencyPoint{}
+	count, peak := 0, 0
+	for _, e := range events {
+		count += e.delta
+		if count > peak {
+			peak = count
+		}
+
+		// Collapse events at the same instant into one point
+		if n := len(timeline); n > 0 && timeline[n-1].At.Equal(e.at) {
+			timeline[n-1].Count = count
+			continue
+		}
+		timeline = append(timeline, ConcurrencyPoint{At: e.at, Count: count})
+	}
+
+	return timeline, peak
+}
@@ -0,0 +1,63 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestRoomPresence(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Standup", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	left := func(minutes int) *time.Time { end := at(minutes); return &end }
+
+	// Ada stays 0-30; Bob joins at 10 and reconnects at 20, staying on
+	sessions := []models.ParticipantSession{
+		{ParticipantID: "a", RoomID: room.ID, Name: "Ada", JoinedAt: at(0), LeftAt: left(30)},
+		{ParticipantID: "b", RoomID: room.ID, Name: "Bob", JoinedAt: at(10), LeftAt: left(20)},
+		{ParticipantID: "c", RoomID: room.ID, Name: "Bob", JoinedAt: at(20)},
+	}
+	for i := range sessions {
+		if err := models.RecordSessionStart(ctx, pool, &sessions[i]); err != nil {
+			t.Fatal(err)
+		}
+		if sessions[i].LeftAt != nil {
+			if err := models.RecordSessionEnd(ctx, pool, &sessions[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	presence, err := models.GetRoomPresence(ctx, pool, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presence.Sessions) != 3 || presence.Sessions[2].LeftAt != nil {
+		t.Errorf("sessions = %+v, want 3 with c still connected", presence.Sessions)
+	}
+
+	// The reconnect at minute 20 doesn't count Bob twice
+	want := []models.ConcurrencyPoint{{At: at(0), Count: 1}, {At: at(10), Count: 2}, {At: at(20), Count: 2}, {At: at(30), Count: 1}}
+	if len(presence.Timeline) != len(want) {
+		t.Fatalf("timeline = %+v, want %+v", presence.Timeline, want)
+	}
+	for i, point := range presence.Timeline {
+		if !point.At.Equal(want[i].At) || point.Count != want[i].Count {
+			t.Errorf("timeline[%d] = %d at %v, want %d at %v", i, point.Count, point.At, want[i].Count, want[i].At)
+		}
+	}
+	if presence.PeakConcurrent != 2 {
+		t.Errorf("peak = %d, want 2", presence.PeakConcurrent)
+	}
+}
@@ -4,17 +4,65 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Room represents a collaborative drawing room
 type Room struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID        string       `json:"id"`
+	Title     string       `json:"title"`
+	Ephemeral bool         `json:"ephemeral"` // content lives only in memory while the room is active
+	Defaults  RoomDefaults `json:"defaults"`
+	Tenant    string       `json:"-"`
+	Protected bool         `json:"protected,omitempty"` // a password is required to open the room
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+
+	// Secret required for destructive operations; only set on the Room
+	// returned at creation, since just its hash is stored
+	OwnerToken string `json:"ownerToken,omitempty"`
+
+	// Password chosen at creation, hashed when the room is inserted
+	password string
+}
+
+// RoomDefaults are the tool settings suggested to participants on join.
+// Empty fields leave the choice to the client.
+type RoomDefaults struct {
+	Tool  string  `json:"tool,omitempty"`
+	Color string  `json:"color,omitempty"`
+	Width float64 `json:"width,omitempty"`
+}
+
+// Validate checks the defaults against the allowed tools and colors
+func (d RoomDefaults) Validate() error {
+	if d.Tool != "" && !IsValidTool(d.Tool) {
+		return fmt.Errorf("invalid default tool %q", d.Tool)
+	}
+	if d.Color != "" && !IsValidColor(d.Color) {
+		return fmt.Errorf("invalid default color %q, expected #RRGGBB", d.Color)
+	}
+	if d.Width < 0 {
+		return fmt.Errorf("invalid default width %v", d.Width)
+	}
+	return nil
+}
+
+// RoomOptions are the optional settings chosen when creating a room
+type RoomOptions struct {
+	Ephemeral bool
+	Defaults  RoomDefaults
+	Tenant    string
+	Password  string
 }
 
 // RoomState represents the full state of a room (for sync)
@@ -22,6 +70,15 @@ type RoomState struct {
 	Room       Room        `json:"room"`
 	Strokes    []Stroke    `json:"strokes"`
 	TextBlocks []TextBlock `json:"textBlocks"`
+	Shapes     []Shape     `json:"shapes"`
+	Images     []Image     `json:"images"`
+
+	// ComputeChecksum of the full content (before any include filtering)
+	Checksum string `json:"checksum,omitempty"`
+
+	// Set when the room was created by the connection receiving this state,
+	// so clients can tell a brand new room from one they failed to load
+	IsNew bool `json:"isNew,omitempty"`
 }
 
 // GenerateRoomID creates a short random room code
@@ -31,46 +88,185 @@ func GenerateRoomID() string {
 	return hex.EncodeToString(bytes)
 }
 
-// CreateRoom creates a new room in the database
-func CreateRoom(ctx context.Context, pool *pgxpool.Pool, id string, title string) (*Room, error) {
+var roomIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,36}$`)
+
+// IsValidRoomID reports whether id is a usable caller-supplied room ID
+func IsValidRoomID(id string) bool {
+	return roomIDPattern.MatchString(id)
+}
+
+// CreateRoom creates a new room in the database. An empty id generates one;
+// an id already in use returns ErrRoomExists.
+func CreateRoom(ctx context.Context, pool *pgxpool.Pool, id string, title string, opts RoomOptions) (*Room, error) {
+	room := newRoom(id, title, opts)
+	if err := insertRoom(ctx, pool, room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// newRoom builds a room, generating an ID if none is given
+func newRoom(id string, title string, opts RoomOptions) *Room {
 	if id == "" {
 		id = GenerateRoomID()
 	}
 
-	room := &Room{
-		ID:        id,
-		Title:     title,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	return &Room{
+		ID:         id,
+		Title:      title,
+		Ephemeral:  opts.Ephemeral,
+		Defaults:   opts.Defaults,
+		Tenant:     opts.Tenant,
+		Protected:  opts.Password != "",
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		OwnerToken: generateOwnerToken(),
+		password:   opts.Password,
 	}
+}
 
-	_, err := pool.Exec(ctx,
-		`INSERT INTO rooms (id, title, created_at, updated_at) VALUES ($1, $2, $3, $4)`,
-		room.ID, room.Title, room.CreatedAt, room.UpdatedAt,
-	)
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertRoom(ctx context.Context, db execer, room *Room) error {
+	passwordHash, err := hashRoomPassword(room.password)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return room, nil
+	_, err = db.Exec(ctx,
+		`INSERT INTO rooms (id, title, ephemeral, default_tool, default_color, default_width, tenant, owner_token_hash, password_hash, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		room.ID, room.Title, room.Ephemeral, room.Defaults.Tool, room.Defaults.Color, room.Defaults.Width, room.Tenant, hashOwnerToken(room.OwnerToken), passwordHash, room.CreatedAt, room.UpdatedAt,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrRoomExists
+	}
+	return err
 }
 
-// GetRoom retrieves a room by ID
-func GetRoom(ctx context.Context, pool *pgxpool.Pool, id string) (*Room, error) {
+// roomColumns is the column list scanned by scanRoom
+const roomColumns = `id, title, ephemeral, default_tool, default_color, default_width, tenant, password_hash <> '', created_at, updated_at`
+
+func scanRoom(row pgx.Row, room *Room) error {
+	return row.Scan(&room.ID, &room.Title, &room.Ephemeral, &room.Defaults.Tool, &room.Defaults.Color, &room.Defaults.Width, &room.Tenant, &room.Protected, &room.CreatedAt, &room.UpdatedAt)
+}
+
+// GetRoom retrieves a room by ID within a tenant
+func GetRoom(ctx context.Context, pool *pgxpool.Pool, tenant string, id string) (*Room, error) {
 	room := &Room{}
-	err := pool.QueryRow(ctx,
-		`SELECT id, title, created_at, updated_at FROM rooms WHERE id = $1`,
-		id,
-	).Scan(&room.ID, &room.Title, &room.CreatedAt, &room.UpdatedAt)
+	err := scanRoom(pool.QueryRow(ctx,
+		`SELECT `+roomColumns+` FROM rooms WHERE id = $1 AND tenant = $2 AND deleted_at IS NULL`,
+		id, tenant,
+	), room)
 	if err != nil {
 		return nil, err
 	}
 	return room, nil
 }
 
-// GetRoomState retrieves the full state of a room
-func GetRoomState(ctx context.Context, pool *pgxpool.Pool, roomID string) (*RoomState, error) {
-	room, err := GetRoom(ctx, pool, roomID)
+// ListRooms returns a page of a tenant's rooms, most recently updated first,
+// along with the total number of rooms
+func ListRooms(ctx context.Context, pool *pgxpool.Pool, tenant string, limit, offset int) ([]Room, int, error) {
+	var total int
+	if err := pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM rooms WHERE tenant = $1 AND deleted_at IS NULL`,
+		tenant,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := pool.Query(ctx,
+		`SELECT `+roomColumns+` FROM rooms WHERE tenant = $1 AND deleted_at IS NULL
+		 ORDER BY updated_at DESC, id ASC LIMIT $2 OFFSET $3`,
+		tenant, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	rooms := []Room{}
+	for rows.Next() {
+		var room Room
+		if err := scanRoom(rows, &room); err != nil {
+			return nil, 0, err
+		}
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return rooms, total, nil
+}
+
+// SearchRooms returns up to limit of a tenant's rooms whose title matches
+// query, best matches first. Titles match on full-text search or, for
+// partial words, on a case-insensitive substring.
+func SearchRooms(ctx context.Context, pool *pgxpool.Pool, tenant string, query string, limit int) ([]Room, error) {
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	rows, err := pool.Query(ctx,
+		`SELECT `+roomColumns+` FROM rooms
+		 WHERE tenant = $1 AND deleted_at IS NULL
+		   AND (to_tsvector('simple', coalesce(title, '')) @@ websearch_to_tsquery('simple', $2)
+		        OR title ILIKE $3)
+		 ORDER BY ts_rank(to_tsvector('simple', coalesce(title, '')), websearch_to_tsquery('simple', $2)) DESC,
+		          updated_at DESC, id ASC
+		 LIMIT $4`,
+		tenant, query, pattern, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []Room{}
+	for rows.Next() {
+		var room Room
+		if err := scanRoom(rows, &room); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// likeEscaper escapes LIKE wildcards so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// RoomExists reports whether a room with the given ID exists within a tenant
+func RoomExists(ctx context.Context, pool *pgxpool.Pool, tenant string, id string) (bool, error) {
+	var exists bool
+	err := pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM rooms WHERE id = $1 AND tenant = $2 AND deleted_at IS NULL)`,
+		id, tenant,
+	).Scan(&exists)
+	return exists, err
+}
+
+// GetRoomTenant returns the tenant owning a room, and whether the room exists at all.
+// Soft-deleted rooms count as missing.
+func GetRoomTenant(ctx context.Context, pool *pgxpool.Pool, id string) (string, bool, error) {
+	var tenant string
+	err := pool.QueryRow(ctx, `SELECT tenant FROM rooms WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&tenant)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return tenant, true, nil
+}
+
+// GetRoomState retrieves the full state of a room within a tenant
+func GetRoomState(ctx context.Context, pool *pgxpool.Pool, tenant string, roomID string) (*RoomState, error) {
+	room, err := GetRoom(ctx, pool, tenant, roomID)
 	if err != nil {
 		return nil, err
 	}
@@ -85,11 +281,60 @@ func GetRoomState(ctx context.Context, pool *pgxpool.Pool, roomID string) (*Room
 		return nil, err
 	}
 
-	return &RoomState{
+	shapes, err := GetShapesByRoom(ctx, pool, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := GetImagesByRoom(ctx, pool, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RoomState{
 		Room:       *room,
 		Strokes:    strokes,
 		TextBlocks: textBlocks,
-	}, nil
+		Shapes:     shapes,
+		Images:     images,
+	}
+	state.Checksum = state.ComputeChecksum()
+	return state, nil
+}
+
+// RoomSummary is a room's metadata with content counts, for callers that
+// don't need the content itself
+type RoomSummary struct {
+	Room
+	StrokeCount    int `json:"strokeCount"`
+	TextBlockCount int `json:"textBlockCount"`
+
+	// Most participants connected at once, and when a message was last
+	// received, as of the hub's last activity flush
+	PeakParticipants int        `json:"peakParticipants"`
+	LastActiveAt     *time.Time `json:"lastActiveAt,omitempty"`
+}
+
+// GetRoomSummary retrieves a room within a tenant along with how many live
+// strokes and text blocks it holds
+func GetRoomSummary(ctx context.Context, pool *pgxpool.Pool, tenant string, roomID string) (*RoomSummary, error) {
+	room, err := GetRoom(ctx, pool, tenant, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &RoomSummary{Room: *room}
+	err = pool.QueryRow(ctx,
+		`SELECT (SELECT COUNT(*) FROM strokes WHERE room_id = $1 AND deleted_at IS NULL),
+		        (SELECT COUNT(*) FROM text_blocks WHERE room_id = $1),
+		        peak_participants, last_active_at
+		 FROM rooms WHERE id = $1`,
+		roomID,
+	).Scan(&summary.StrokeCount, &summary.TextBlockCount, &summary.PeakParticipants, &summary.LastActiveAt)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
 }
 
 // UpdateRoomTimestamp updates the room's updated_at timestamp
@@ -101,6 +346,34 @@ func UpdateRoomTimestamp(ctx context.Context, pool *pgxpool.Pool, id string) err
 	return err
 }
 
+// RecordRoomActivity raises the room's stored peak participant count to
+// peak and, when lastActive is set, moves its last activity time forward
+func RecordRoomActivity(ctx context.Context, pool *pgxpool.Pool, id string, peak int, lastActive *time.Time) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE rooms SET peak_participants = GREATEST(peak_participants, $2),
+		                  last_active_at = GREATEST(last_active_at, $3)
+		 WHERE id = $1`,
+		id, peak, lastActive,
+	)
+	return err
+}
+
+// MaxTitleLength is the longest room title the rooms.title column holds
+const MaxTitleLength = 255
+
+// NormalizeTitle trims a new room title, returning ErrTitleRequired if
+// nothing is left and ErrTitleTooLong past MaxTitleLength characters
+func NormalizeTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", ErrTitleRequired
+	}
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return "", ErrTitleTooLong
+	}
+	return title, nil
+}
+
 // UpdateRoomTitle updates the room's title
 func UpdateRoomTitle(ctx context.Context, pool *pgxpool.Pool, id string, title string) error {
 	_, err := pool.Exec(ctx,
@@ -110,29 +383,144 @@ func UpdateRoomTitle(ctx context.Context, pool *pgxpool.Pool, id string, title s
 	return err
 }
 
-// DeleteRoom deletes a room and all its content (cascade)
+// DeleteRoom soft-deletes a room so it can be restored with RestoreRoom.
+// Its content is kept until the room is purged.
+// It returns pgx.ErrNoRows if the room doesn't exist or is already deleted.
 func DeleteRoom(ctx context.Context, pool *pgxpool.Pool, id string) error {
-	_, err := pool.Exec(ctx, `DELETE FROM rooms WHERE id = $1`, id)
-	return err
+	tag, err := pool.Exec(ctx,
+		`UPDATE rooms SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`,
+		time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// RestoreRoom undoes a soft delete and returns the restored room.
+// It returns pgx.ErrNoRows if the room is not deleted (or purged).
+func RestoreRoom(ctx context.Context, pool *pgxpool.Pool, tenant string, id string) (*Room, error) {
+	tag, err := pool.Exec(ctx,
+		`UPDATE rooms SET deleted_at = NULL WHERE id = $1 AND tenant = $2 AND deleted_at IS NOT NULL`,
+		id, tenant,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return GetRoom(ctx, pool, tenant, id)
+}
+
+// PurgeDeletedRooms permanently removes rooms soft-deleted before cutoff,
+// along with all their content. It returns how many rooms were removed and
+// the storage keys of their uploaded images, whose files the caller deletes.
+func PurgeDeletedRooms(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time) (int64, []string, error) {
+	return purgeRooms(ctx, pool, `r.deleted_at < $1`, cutoff)
+}
+
+// PurgeStaleRooms permanently removes rooms that have no content at all and
+// haven't been updated since cutoff. Rooms in keep (e.g. ones with connected
+// clients) are spared. Like PurgeDeletedRooms it also returns the storage
+// keys of removed images, for uploads that raced the purge.
+func PurgeStaleRooms(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time, keep []string) (int64, []string, error) {
+	return purgeRooms(ctx, pool,
+		`r.updated_at < $1 AND NOT (r.id = ANY($2))
+		   AND NOT EXISTS (SELECT 1 FROM strokes WHERE room_id = r.id)
+		   AND NOT EXISTS (SELECT 1 FROM text_blocks WHERE room_id = r.id)
+		   AND NOT EXISTS (SELECT 1 FROM shapes WHERE room_id = r.id)
+		   AND NOT EXISTS (SELECT 1 FROM images WHERE room_id = r.id)`,
+		cutoff, keep,
+	)
 }
 
-// ClearRoom removes all strokes and text blocks from a room
-func ClearRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) error {
+// purgeRooms deletes the rooms matching where and their content in one
+// transaction, returning the number of rooms and their images' storage keys
+func purgeRooms(ctx context.Context, pool *pgxpool.Pool, where string, args ...any) (int64, []string, error) {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT r.id FROM rooms r WHERE `+where+` FOR UPDATE`, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	rows, err = tx.Query(ctx, `DELETE FROM images WHERE room_id = ANY($1) RETURNING storage_key`, ids)
+	if err != nil {
+		return 0, nil, err
+	}
+	keys, err := collectStorageKeys(rows)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The rest of the content goes by cascade
+	tag, err := tx.Exec(ctx, `DELETE FROM rooms WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return 0, nil, err
+	}
+	return tag.RowsAffected(), keys, tx.Commit(ctx)
+}
+
+// ClearRoom removes all strokes, text blocks, shapes and images from a room
+// and returns the storage keys of the removed images.
+// If expectedUpdatedAt is set, the clear only happens when the room has not
+// been modified since then; otherwise ErrConflict is returned.
+func ClearRoom(ctx context.Context, pool *pgxpool.Pool, roomID string, expectedUpdatedAt *time.Time) ([]string, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
+	if expectedUpdatedAt != nil {
+		var updatedAt time.Time
+		err := tx.QueryRow(ctx,
+			`SELECT updated_at FROM rooms WHERE id = $1 FOR UPDATE`,
+			roomID,
+		).Scan(&updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if updatedAt.After(*expectedUpdatedAt) {
+			return nil, ErrConflict
+		}
+	}
+
 	if _, err := tx.Exec(ctx, `DELETE FROM strokes WHERE room_id = $1`, roomID); err != nil {
-		return err
+		return nil, err
 	}
 	if _, err := tx.Exec(ctx, `DELETE FROM text_blocks WHERE room_id = $1`, roomID); err != nil {
-		return err
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM shapes WHERE room_id = $1`, roomID); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, `DELETE FROM images WHERE room_id = $1 RETURNING storage_key`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := collectStorageKeys(rows)
+	if err != nil {
+		return nil, err
 	}
 	if _, err := tx.Exec(ctx, `UPDATE rooms SET updated_at = $1 WHERE id = $2`, time.Now(), roomID); err != nil {
-		return err
+		return nil, err
 	}
 
-	return tx.Commit(ctx)
+	return keys, tx.Commit(ctx)
 }
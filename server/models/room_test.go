@@ -0,0 +1,318 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+		err   error
+	}{
+		{"  Sketches  ", "Sketches", nil},
+		{"", "", models.ErrTitleRequired},
+		{" \t\n", "", models.ErrTitleRequired},
+		{strings.Repeat("é", models.MaxTitleLength), strings.Repeat("é", models.MaxTitleLength), nil},
+		{strings.Repeat("a", models.MaxTitleLength+1), "", models.ErrTitleTooLong},
+	}
+	for _, tt := range tests {
+		got, err := models.NormalizeTitle(tt.title)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("NormalizeTitle(%.20q) = %.20q, %v; want %.20q, %v", tt.title, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRoomDefaultsValidate(t *testing.T) {
+	tests := []struct {
+		defaults models.RoomDefaults
+		valid    bool
+	}{
+		{models.RoomDefaults{}, true},
+		{models.RoomDefaults{Tool: "pen", Color: "#1a2B3c", Width: 4}, true},
+		{models.RoomDefaults{Tool: "crayon"}, false},
+		{models.RoomDefaults{Color: "blue"}, false},
+		{models.RoomDefaults{Color: "#12345"}, false},
+		{models.RoomDefaults{Width: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.defaults.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.defaults, err, tt.valid)
+		}
+	}
+}
+
+func TestRoomDefaultsStored(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	defaults := models.RoomDefaults{Tool: "highlighter", Color: "#ffcc00", Width: 12}
+	room, err := models.CreateRoom(ctx, pool, "", "Signatures", models.RoomOptions{Defaults: defaults})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := models.GetRoomState(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Room.Defaults != defaults {
+		t.Errorf("room state defaults %+v, want %+v", state.Room.Defaults, defaults)
+	}
+}
+
+func TestRoomSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	tenant := fmt.Sprintf("soft-delete-%d", rand.Int())
+	room, err := models.CreateRoom(ctx, pool, "", "Oops", models.RoomOptions{Tenant: tenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DeleteRoom(ctx, pool, room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted rooms are hidden everywhere
+	if _, err := models.GetRoom(ctx, pool, tenant, room.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetRoom of a deleted room: got %v, want ErrNoRows", err)
+	}
+	if rooms, total, err := models.ListRooms(ctx, pool, tenant, 10, 0); err != nil || len(rooms) != 0 || total != 0 {
+		t.Errorf("ListRooms after delete: %d rooms (total %d), %v; want none", len(rooms), total, err)
+	}
+	if err := models.DeleteRoom(ctx, pool, room.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("deleting twice: got %v, want ErrNoRows", err)
+	}
+
+	// Restoring brings it back, once
+	if _, err := models.RestoreRoom(ctx, pool, "another-tenant", room.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("restore from another tenant: got %v, want ErrNoRows", err)
+	}
+	restored, err := models.RestoreRoom(ctx, pool, tenant, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "Oops" {
+		t.Errorf("restored room titled %q", restored.Title)
+	}
+	if _, err := models.RestoreRoom(ctx, pool, tenant, room.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("restoring a live room: got %v, want ErrNoRows", err)
+	}
+
+	// Only rooms deleted before the cutoff are purged
+	if err := models.DeleteRoom(ctx, pool, room.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := models.PurgeDeletedRooms(ctx, pool, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.RestoreRoom(ctx, pool, tenant, room.ID); err != nil {
+		t.Fatalf("room inside the retention period was purged: %v", err)
+	}
+	if err := models.DeleteRoom(ctx, pool, room.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := models.PurgeDeletedRooms(ctx, pool, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.RestoreRoom(ctx, pool, tenant, room.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("restoring a purged room: got %v, want ErrNoRows", err)
+	}
+}
+
+func TestSearchRooms(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	tenant := fmt.Sprintf("search-%d", rand.Int())
+	for _, title := range []string{"Weekly planning", "Planning poker", "Design review", "50% done"} {
+		if _, err := models.CreateRoom(ctx, pool, "", title, models.RoomOptions{Tenant: tenant}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := models.CreateRoom(ctx, pool, "", "Planning elsewhere", models.RoomOptions{Tenant: tenant + "-other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"planning", []string{"Planning poker", "Weekly planning"}},
+		{"PLAN", []string{"Planning poker", "Weekly planning"}}, // partial word
+		{"design review", []string{"Design review"}},
+		{"50%", []string{"50% done"}},
+		{"%", []string{"50% done"}}, // wildcards match literally
+		{"retro", nil},
+	}
+	for _, tt := range tests {
+		rooms, err := models.SearchRooms(ctx, pool, tenant, tt.query, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, room := range rooms {
+			got = append(got, room.Title)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SearchRooms(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if rooms, err := models.SearchRooms(ctx, pool, tenant, "planning", 1); err != nil || len(rooms) != 1 {
+		t.Errorf("limit 1: got %d rooms, %v", len(rooms), err)
+	}
+}
+
+func TestPurgeStaleRooms(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	newRoom := func(title string) string {
+		room, err := models.CreateRoom(ctx, pool, "", title, models.RoomOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return room.ID
+	}
+	stale := newRoom("Stale")
+	drawnOn := newRoom("Drawn on")
+	connected := newRoom("Connected")
+	fresh := newRoom("Fresh")
+
+	stroke := &models.Stroke{RoomID: drawnOn, Points: []models.Point{{X: 1, Y: 1}}, Color: "#000000", Tool: "pen"}
+	if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE rooms SET updated_at = $1 WHERE id = ANY($2)`,
+		time.Now().Add(-2*time.Hour), []string{stale, drawnOn, connected}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := models.PurgeStaleRooms(ctx, pool, time.Now().Add(-time.Hour), []string{connected}); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := func(id string) bool {
+		var found bool
+		if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM rooms WHERE id = $1)`, id).Scan(&found); err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+	if exists(stale) {
+		t.Error("empty inactive room was not reaped")
+	}
+	if !exists(drawnOn) {
+		t.Error("room with content was reaped")
+	}
+	if !exists(connected) {
+		t.Error("room with connected clients was reaped")
+	}
+	if !exists(fresh) {
+		t.Error("recently active room was reaped")
+	}
+}
+
+func TestGetRoomSummary(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Counted", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strokes []*models.Stroke
+	for i := range 3 {
+		stroke := &models.Stroke{RoomID: room.ID, Points: []models.Point{{X: float64(i), Y: 1}}, Color: "#000000", Tool: "pen"}
+		if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+			t.Fatal(err)
+		}
+		strokes = append(strokes, stroke)
+	}
+	for range 2 {
+		if err := models.CreateTextBlock(ctx, pool, &models.TextBlock{RoomID: room.ID, Width: 100, Height: 40, Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Deleted strokes are not counted
+	if err := models.DeleteStroke(ctx, pool, room.ID, strokes[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := models.GetRoomSummary(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ID != room.ID || summary.Title != "Counted" {
+		t.Errorf("summary of room %q titled %q", summary.ID, summary.Title)
+	}
+	if summary.StrokeCount != 2 || summary.TextBlockCount != 2 {
+		t.Errorf("counts = %d strokes, %d text blocks; want 2 and 2", summary.StrokeCount, summary.TextBlockCount)
+	}
+
+	if _, err := models.GetRoomSummary(ctx, pool, "", "no-such-room"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("summary of a missing room: got %v, want ErrNoRows", err)
+	}
+}
+
+func TestRecordRoomActivity(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Busy", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := func() *models.RoomSummary {
+		t.Helper()
+		s, err := models.GetRoomSummary(ctx, pool, "", room.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if s := summary(); s.PeakParticipants != 0 || s.LastActiveAt != nil {
+		t.Errorf("new room: peak %d, last active %v", s.PeakParticipants, s.LastActiveAt)
+	}
+
+	active := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+	if err := models.RecordRoomActivity(ctx, pool, room.ID, 5, &active); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lower peaks and older or missing activity never move the record back
+	earlier := active.Add(-time.Hour)
+	if err := models.RecordRoomActivity(ctx, pool, room.ID, 3, &earlier); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RecordRoomActivity(ctx, pool, room.ID, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := summary()
+	if s.PeakParticipants != 5 || s.LastActiveAt == nil || !s.LastActiveAt.Equal(active) {
+		t.Errorf("peak %d, last active %v; want 5 at %v", s.PeakParticipants, s.LastActiveAt, active)
+	}
+
+	later := active.Add(time.Second)
+	if err := models.RecordRoomActivity(ctx, pool, room.ID, 7, &later); err != nil {
+		t.Fatal(err)
+	}
+	if s := summary(); s.PeakParticipants != 7 || !s.LastActiveAt.Equal(later) {
+		t.Errorf("peak %d, last active %v; want 7 at %v", s.PeakParticipants, s.LastActiveAt, later)
+	}
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Shape represents a geometric element on the canvas. For lines the bounds
+// run from (X, Y) to (X+Width, Y+Height), so width and height may be negative.
+type Shape struct {
+	ID          string    `json:"id"`
+	RoomID      string    `json:"roomId,omitempty"`
+	Type        string    `json:"type"` // 'rect', 'ellipse' or 'line'
+	X           float64   `json:"x"`
+	Y           float64   `json:"y"`
+	Width       float64   `json:"width"`
+	Height      float64   `json:"height"`
+	StrokeColor string    `json:"strokeColor"`
+	FillColor   string    `json:"fillColor,omitempty"` // empty for no fill
+	StrokeWidth float64   `json:"strokeWidth"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty"`
+}
+
+// ShapeUpdate represents partial updates to a shape
+type ShapeUpdate struct {
+	X           *float64 `json:"x,omitempty"`
+	Y           *float64 `json:"y,omitempty"`
+	Width       *float64 `json:"width,omitempty"`
+	Height      *float64 `json:"height,omitempty"`
+	StrokeColor *string  `json:"strokeColor,omitempty"`
+	FillColor   *string  `json:"fillColor,omitempty"`
+	StrokeWidth *float64 `json:"strokeWidth,omitempty"`
+}
+
+// IsValidShapeType reports whether t is a supported shape type
+func IsValidShapeType(t string) bool {
+	return t == "rect" || t == "ellipse" || t == "line"
+}
+
+// Validate checks the shape's type and colors
+func (s *Shape) Validate() error {
+	if !IsValidShapeType(s.Type) {
+		return fmt.Errorf("invalid shape type %q", s.Type)
+	}
+	if err := ValidateColor("stroke color", s.StrokeColor); err != nil {
+		return err
+	}
+	if s.FillColor != "" {
+		if err := ValidateColor("fill color", s.FillColor); err != nil {
+			return err
+		}
+	}
+	if s.StrokeWidth < 0 {
+		return fmt.Errorf("invalid stroke width %v", s.StrokeWidth)
+	}
+	return nil
+}
+
+// Validate checks the updated colors and stroke width
+func (u *ShapeUpdate) Validate() error {
+	if u.StrokeColor != nil {
+		if err := ValidateColor("stroke color", *u.StrokeColor); err != nil {
+			return err
+		}
+	}
+	if u.FillColor != nil && *u.FillColor != "" {
+		if err := ValidateColor("fill color", *u.FillColor); err != nil {
+			return err
+		}
+	}
+	if u.StrokeWidth != nil && *u.StrokeWidth < 0 {
+		return fmt.Errorf("invalid stroke width %v", *u.StrokeWidth)
+	}
+	return nil
+}
+
+// Apply copies the set fields of the update onto s
+func (u *ShapeUpdate) Apply(s *Shape) {
+	if u.X != nil {
+		s.X = *u.X
+	}
+	if u.Y != nil {
+		s.Y = *u.Y
+	}
+	if u.Width != nil {
+		s.Width = *u.Width
+	}
+	if u.Height != nil {
+		s.Height = *u.Height
+	}
+	if u.StrokeColor != nil {
+		s.StrokeColor = *u.StrokeColor
+	}
+	if u.FillColor != nil {
+		s.FillColor = *u.FillColor
+	}
+	if u.StrokeWidth != nil {
+		s.StrokeWidth = *u.StrokeWidth
+	}
+}
+
+// CreateShape saves a new shape to the database
+func CreateShape(ctx context.Context, pool *pgxpool.Pool, s *Shape) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+
+	_, err := pool.Exec(ctx,
+		`INSERT INTO shapes (id, room_id, type, x, y, width, height, stroke_color, fill_color, stroke_width, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		 ON CONFLICT (id) DO NOTHING`,
+		s.ID, s.RoomID, s.Type, s.X, s.Y, s.Width, s.Height, s.StrokeColor, s.FillColor, s.StrokeWidth, s.CreatedAt, s.UpdatedAt,
+	)
+	return err
+}
+
+// shapeColumns is the column list scanned by scanShape
+const shapeColumns = `id, room_id, type, x, y, width, height, stroke_color, fill_color, stroke_width, created_at, updated_at`
+
+func scanShape(row pgx.Row, s *Shape) error {
+	return row.Scan(&s.ID, &s.RoomID, &s.Type, &s.X, &s.Y, &s.Width, &s.Height, &s.StrokeColor, &s.FillColor, &s.StrokeWidth, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// GetShapesByRoom retrieves all shapes for a room
+func GetShapesByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) ([]Shape, error) {
+	return queryShapes(ctx, pool, `room_id = $1`, roomID)
+}
+
+// GetShapesUpdatedSince retrieves a room's shapes created or changed after since
+func GetShapesUpdatedSince(ctx context.Context, pool *pgxpool.Pool, roomID string, since time.Time) ([]Shape, error) {
+	return queryShapes(ctx, pool, `room_id = $1 AND updated_at > $2`, roomID, since)
+}
+
+// queryShapes retrieves the shapes matching where, oldest first
+func queryShapes(ctx context.Context, pool *pgxpool.Pool, where string, args ...any) ([]Shape, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+shapeColumns+` FROM shapes WHERE `+where+` ORDER BY created_at ASC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shapes := []Shape{}
+	for rows.Next() {
+		var s Shape
+		if err := scanShape(rows, &s); err != nil {
+			return nil, err
+		}
+		shapes = append(shapes, s)
+	}
+	return shapes, rows.Err()
+}
+
+// GetShape retrieves a single shape of a room by ID
+func GetShape(ctx context.Context, pool *pgxpool.Pool, roomID, id string) (*Shape, error) {
+	s := &Shape{}
+	row := pool.QueryRow(ctx, `SELECT `+shapeColumns+` FROM shapes WHERE id = $1 AND room_id = $2`, id, roomID)
+	if err := scanShape(row, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UpdateShape applies partial updates to a shape
+func UpdateShape(ctx context.Context, pool *pgxpool.Pool, roomID, id string, updates *ShapeUpdate) error {
+	query := `UPDATE shapes SET updated_at = $1`
+	args := []any{time.Now()}
+	argNum := 2
+
+	set := func(column string, value any) {
+		query += fmt.Sprintf(", %s = $%d", column, argNum)
+		args = append(args, value)
+		argNum++
+	}
+	if updates.X != nil {
+		set("x", *updates.X)
+	}
+	if updates.Y != nil {
+		set("y", *updates.Y)
+	}
+	if updates.Width != nil {
+		set("width", *updates.Width)
+	}
+	if updates.Height != nil {
+		set("height", *updates.Height)
+	}
+	if updates.StrokeColor != nil {
+		set("stroke_color", *updates.StrokeColor)
+	}
+	if updates.FillColor != nil {
+		set("fill_color", *updates.FillColor)
+	}
+	if updates.StrokeWidth != nil {
+		set("stroke_width", *updates.StrokeWidth)
+	}
+
+	query += fmt.Sprintf(" WHERE id = $%d AND room_id = $%d", argNum, argNum+1)
+	args = append(args, id, roomID)
+
+	_, err := pool.Exec(ctx, query, args...)
+	return err
+}
+
+// DeleteShape deletes a shape
+func DeleteShape(ctx context.Context, pool *pgxpool.Pool, roomID, id string) error {
+	_, err := pool.Exec(ctx, `DELETE FROM shapes WHERE id = $1 AND room_id = $2`, id, roomID)
+	return err
+}
@@ -0,0 +1,79 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestShapeValidate(t *testing.T) {
+	tests := []struct {
+		shape models.Shape
+		valid bool
+	}{
+		{models.Shape{Type: "rect", StrokeColor: "#000000"}, true},
+		{models.Shape{Type: "ellipse", StrokeColor: "#000000", FillColor: "#ffcc00", StrokeWidth: 2}, true},
+		{models.Shape{Type: "line", StrokeColor: "#000000", Width: -10, Height: -5}, true},
+		{models.Shape{Type: "triangle", StrokeColor: "#000000"}, false},
+		{models.Shape{Type: "rect", StrokeColor: "black"}, false},
+		{models.Shape{Type: "rect", StrokeColor: "#000000", FillColor: "#fff"}, false},
+		{models.Shape{Type: "rect", StrokeColor: "#000000", StrokeWidth: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.shape.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.shape, err, tt.valid)
+		}
+	}
+}
+
+func TestShapeCRUD(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Shapes", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shape := &models.Shape{RoomID: room.ID, Type: "rect", X: 10, Y: 20, Width: 30, Height: 40, StrokeColor: "#000000", StrokeWidth: 2}
+	if err := models.CreateShape(ctx, pool, shape); err != nil {
+		t.Fatal(err)
+	}
+	if shape.ID == "" {
+		t.Fatal("shape was not given an ID")
+	}
+
+	state, err := models.GetRoomState(ctx, pool, room.Tenant, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Shapes) != 1 || state.Shapes[0].ID != shape.ID {
+		t.Errorf("room state shapes %+v, want the new shape", state.Shapes)
+	}
+
+	// Only the fields set in the update change
+	width, fill := 55.0, "#ffcc00"
+	if err := models.UpdateShape(ctx, pool, room.ID, shape.ID, &models.ShapeUpdate{Width: &width, FillColor: &fill}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := models.GetShape(ctx, pool, room.ID, shape.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != 55 || got.FillColor != "#ffcc00" || got.X != 10 || got.StrokeColor != "#000000" {
+		t.Errorf("after update: %+v", got)
+	}
+
+	if err := models.DeleteShape(ctx, pool, room.ID, shape.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.GetShape(ctx, pool, room.ID, shape.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("GetShape after delete: got %v, want ErrNoRows", err)
+	}
+	if shapes, err := models.GetShapesByRoom(ctx, pool, room.ID); err != nil || len(shapes) != 0 {
+		t.Errorf("shapes after delete: %+v, %v", shapes, err)
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import "math"
+
+// SimplifyPoints reduces a polyline with the Ramer–Douglas–Peucker
+// algorithm, keeping only points that deviate more than epsilon from the
+// line between the points kept around them. The first and last points are
+// always kept, and pressure travels with each kept point. A non-positive
+// epsilon, or fewer than three points, returns points unchanged.
+func SimplifyPoints(points []Point, epsilon float64) []Point {
+	if epsilon <= 0 || len(points) < 3 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	markSimplified(points, 0, len(points)-1, epsilon, keep)
+
+	simplified := make([]Point, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// markSimplified marks the points between first and last that must be kept
+func markSimplified(points []Point, first, last int, epsilon float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+
+	farthest, maxDist := 0, 0.0
+	for i := first + 1; i < last; i++ {
+		if d := segmentDistance(points[i], points[first], points[last]); d > maxDist {
+			farthest, maxDist = i, d
+		}
+	}
+	if maxDist <= epsilon {
+		return
+	}
+
+	keep[farthest] = true
+	markSimplified(points, first, farthest, epsilon, keep)
+	markSimplified(points, farthest, last, epsilon, keep)
+}
+
+// segmentDistance returns the distance from p to the segment a–b
+func segmentDistance(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / lengthSq
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
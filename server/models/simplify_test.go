@@ -0,0 +1,80 @@
+package models_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dre4success/bethel/server/models"
+)
+
+// distanceToPolyline returns how far p lies from the nearest segment of poly
+func distanceToPolyline(p models.Point, poly []models.Point) float64 {
+	best := math.Inf(1)
+	for i := 1; i < len(poly); i++ {
+		a, b := poly[i-1], poly[i]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		t := 0.0
+		if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+			t = math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/lengthSq))
+		}
+		best = math.Min(best, math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy)))
+	}
+	return best
+}
+
+func TestSimplifyStraightLine(t *testing.T) {
+	// A dense diagonal with jitter well inside epsilon
+	points := make([]models.Point, 200)
+	for i := range points {
+		jitter := 0.1 * math.Sin(float64(i))
+		points[i] = models.Point{X: float64(i) + jitter, Y: float64(i) - jitter, Pressure: float64(i) / 200}
+	}
+
+	got := models.SimplifyPoints(points, 0.5)
+	if len(got) != 2 || got[0] != points[0] || got[1] != points[len(points)-1] {
+		t.Errorf("simplified to %v, want just the endpoints", got)
+	}
+}
+
+func TestSimplifyCurve(t *testing.T) {
+	// A semicircle of radius 100
+	points := make([]models.Point, 500)
+	for i := range points {
+		angle := math.Pi * float64(i) / float64(len(points)-1)
+		points[i] = models.Point{X: 100 * math.Cos(angle), Y: 100 * math.Sin(angle)}
+	}
+
+	const epsilon = 0.5
+	got := models.SimplifyPoints(points, epsilon)
+	if len(got) >= len(points)/10 {
+		t.Errorf("kept %d of %d points", len(got), len(points))
+	}
+	if len(got) < 10 {
+		t.Errorf("kept only %d points, too few to follow the curve", len(got))
+	}
+	if got[0] != points[0] || got[len(got)-1] != points[len(points)-1] {
+		t.Error("endpoints not kept")
+	}
+	for _, p := range points {
+		if d := distanceToPolyline(p, got); d > epsilon+1e-9 {
+			t.Fatalf("point %v is %.3f from the simplified curve, beyond epsilon", p, d)
+		}
+	}
+}
+
+func TestSimplifyUnchanged(t *testing.T) {
+	zigzag := []models.Point{{X: 0, Y: 0}, {X: 1, Y: 5}, {X: 2, Y: 0}}
+	for _, tc := range []struct {
+		name    string
+		points  []models.Point
+		epsilon float64
+	}{
+		{"disabled", zigzag, 0},
+		{"sharp corner", zigzag, 0.5},
+		{"two points", zigzag[:2], 0.5},
+	} {
+		if got := models.SimplifyPoints(tc.points, tc.epsilon); len(got) != len(tc.points) {
+			t.Errorf("%s: %d points became %d", tc.name, len(tc.points), len(got))
+		}
+	}
+}
@@ -3,9 +3,15 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,9 +28,53 @@ type Stroke struct {
 	RoomID    string    `json:"roomId,omitempty"`
 	Points    []Point   `json:"points"`
 	Color     string    `json:"color"`
-	Tool      string    `json:"tool"` // 'pen' or 'eraser'
+	Tool      string    `json:"tool"` // one of StrokeTools
+	Locked    bool      `json:"locked,omitempty"`
 	CreatedAt time.Time `json:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
 	CreatedBy string    `json:"createdBy,omitempty"`
+
+	// Position in the room's z-order (higher draws on top); assigned by the
+	// database and changed by ReorderStrokes
+	Seq int64 `json:"seq,omitempty"`
+
+	// Set while soft-deleted; such strokes are hidden from room state
+	DeletedAt *time.Time `json:"-"`
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// IsValidColor reports whether color is a #RRGGBB hex string
+func IsValidColor(color string) bool {
+	return colorPattern.MatchString(color)
+}
+
+// ValidateColor returns a descriptive error if color isn't #RRGGBB; field
+// names the color in the message (e.g. "stroke color")
+func ValidateColor(field, color string) error {
+	if !IsValidColor(color) {
+		return fmt.Errorf("invalid %s %q, expected #RRGGBB", field, color)
+	}
+	return nil
+}
+
+// StrokeTools lists every tool a stroke can be drawn with
+var StrokeTools = []string{"pen", "eraser", "highlighter"}
+
+// IsValidTool reports whether tool is one of the supported stroke tools
+func IsValidTool(tool string) bool {
+	return slices.Contains(StrokeTools, tool)
+}
+
+// Validate checks the stroke's tool and color
+func (s *Stroke) Validate() error {
+	if !IsValidTool(s.Tool) {
+		return fmt.Errorf("invalid tool %q", s.Tool)
+	}
+	if err := ValidatePoints(s.Points); err != nil {
+		return err
+	}
+	return ValidateColor("color", s.Color)
 }
 
 // CreateStroke adds a new stroke to the database
@@ -33,27 +83,112 @@ func CreateStroke(ctx context.Context, pool *pgxpool.Pool, stroke *Stroke) error
 		stroke.ID = uuid.New().String()
 	}
 	stroke.CreatedAt = time.Now()
+	stroke.UpdatedAt = stroke.CreatedAt
 
 	pointsJSON, err := json.Marshal(stroke.Points)
 	if err != nil {
 		return err
 	}
 
-	_, err = pool.Exec(ctx,
-		`INSERT INTO strokes (id, room_id, points, color, tool, created_at, created_by)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)
-		 ON CONFLICT (id) DO NOTHING`,
-		stroke.ID, stroke.RoomID, pointsJSON, stroke.Color, stroke.Tool, stroke.CreatedAt, stroke.CreatedBy,
-	)
+	args := append([]any{stroke.ID, stroke.RoomID, pointsJSON, stroke.Color, stroke.Tool, stroke.CreatedAt, stroke.UpdatedAt, stroke.CreatedBy}, boundsArgs(stroke.Points)...)
+	err = pool.QueryRow(ctx,
+		`INSERT INTO strokes (id, room_id, points, color, tool, created_at, updated_at, created_by, min_x, min_y, max_x, max_y)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		 ON CONFLICT (id) DO NOTHING
+		 RETURNING seq`,
+		args...,
+	).Scan(&stroke.Seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Already stored (a retried add)
+		return nil
+	}
 	return err
 }
 
+// CreateStrokesBatch adds several strokes to the database in a single
+// INSERT, so either all of them are stored or none are. Strokes without an
+// ID are given one, and they stack in the order given.
+func CreateStrokesBatch(ctx context.Context, pool *pgxpool.Pool, strokes []*Stroke) error {
+	if len(strokes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var values strings.Builder
+	args := make([]any, 0, len(strokes)*12)
+	for i, stroke := range strokes {
+		if stroke.ID == "" {
+			stroke.ID = uuid.New().String()
+		}
+		// Offset creation times so the batch keeps its order when sorted by them
+		stroke.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		stroke.UpdatedAt = now
+
+		pointsJSON, err := json.Marshal(stroke.Points)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			values.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&values, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12)
+		args = append(args, stroke.ID, stroke.RoomID, pointsJSON, stroke.Color, stroke.Tool, stroke.CreatedAt, stroke.UpdatedAt, stroke.CreatedBy)
+		args = append(args, boundsArgs(stroke.Points)...)
+	}
+
+	rows, err := pool.Query(ctx,
+		`INSERT INTO strokes (id, room_id, points, color, tool, created_at, updated_at, created_by, min_x, min_y, max_x, max_y)
+		 VALUES `+values.String()+`
+		 RETURNING id, seq`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	seqs := make(map[string]int64, len(strokes))
+	for rows.Next() {
+		var id string
+		var seq int64
+		if err := rows.Scan(&id, &seq); err != nil {
+			return err
+		}
+		seqs[id] = seq
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, stroke := range strokes {
+		stroke.Seq = seqs[stroke.ID]
+	}
+	return nil
+}
+
 // GetStrokesByRoom retrieves all strokes for a room
 func GetStrokesByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) ([]Stroke, error) {
+	return queryStrokes(ctx, pool, `room_id = $1 AND deleted_at IS NULL`, roomID)
+}
+
+// GetStrokesUpdatedSince retrieves a room's strokes created or changed after since
+func GetStrokesUpdatedSince(ctx context.Context, pool *pgxpool.Pool, roomID string, since time.Time) ([]Stroke, error) {
+	return queryStrokes(ctx, pool, `room_id = $1 AND deleted_at IS NULL AND updated_at > $2`, roomID, since)
+}
+
+// GetStrokesCreatedSince retrieves a room's strokes created after since
+func GetStrokesCreatedSince(ctx context.Context, pool *pgxpool.Pool, roomID string, since time.Time) ([]Stroke, error) {
+	return queryStrokes(ctx, pool, `room_id = $1 AND deleted_at IS NULL AND created_at > $2`, roomID, since)
+}
+
+// queryStrokes retrieves the strokes matching where, bottom to top
+func queryStrokes(ctx context.Context, pool *pgxpool.Pool, where string, args ...any) ([]Stroke, error) {
 	rows, err := pool.Query(ctx,
-		`SELECT id, room_id, points, color, tool, created_at, created_by
-		 FROM strokes WHERE room_id = $1 ORDER BY created_at ASC`,
-		roomID,
+		`SELECT id, room_id, points, color, tool, locked, created_at, updated_at, created_by, seq
+		 FROM strokes WHERE `+where+` ORDER BY seq ASC`,
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -66,7 +201,7 @@ func GetStrokesByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) ([
 		var pointsJSON []byte
 		var createdBy *string
 
-		err := rows.Scan(&stroke.ID, &stroke.RoomID, &pointsJSON, &stroke.Color, &stroke.Tool, &stroke.CreatedAt, &createdBy)
+		err := rows.Scan(&stroke.ID, &stroke.RoomID, &pointsJSON, &stroke.Color, &stroke.Tool, &stroke.Locked, &stroke.CreatedAt, &stroke.UpdatedAt, &createdBy, &stroke.Seq)
 		if err != nil {
 			return nil, err
 		}
@@ -89,22 +224,179 @@ func GetStrokesByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) ([
 	return strokes, nil
 }
 
+// GetStroke retrieves a single live stroke of a room by ID
+func GetStroke(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string) (*Stroke, error) {
+	stroke := &Stroke{}
+	var pointsJSON []byte
+	var createdBy *string
+
+	err := pool.QueryRow(ctx,
+		`SELECT id, room_id, points, color, tool, locked, created_at, updated_at, created_by, seq
+		 FROM strokes WHERE id = $1 AND room_id = $2 AND deleted_at IS NULL`,
+		strokeID, roomID,
+	).Scan(&stroke.ID, &stroke.RoomID, &pointsJSON, &stroke.Color, &stroke.Tool, &stroke.Locked, &stroke.CreatedAt, &stroke.UpdatedAt, &createdBy, &stroke.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(pointsJSON, &stroke.Points); err != nil {
+		return nil, err
+	}
+
+	if createdBy != nil {
+		stroke.CreatedBy = *createdBy
+	}
+
+	return stroke, nil
+}
+
 // UpdateStrokePoints updates the points of an existing stroke (for live drawing)
-func UpdateStrokePoints(ctx context.Context, pool *pgxpool.Pool, strokeID string, points []Point) error {
+func UpdateStrokePoints(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string, points []Point) error {
 	pointsJSON, err := json.Marshal(points)
 	if err != nil {
 		return err
 	}
 
-	_, err = pool.Exec(ctx,
-		`UPDATE strokes SET points = $1 WHERE id = $2`,
-		pointsJSON, strokeID,
+	args := append([]any{pointsJSON, time.Now(), strokeID, roomID}, boundsArgs(points)...)
+	tag, err := pool.Exec(ctx,
+		`UPDATE strokes SET points = $1, updated_at = $2, min_x = $5, min_y = $6, max_x = $7, max_y = $8
+		 WHERE id = $3 AND room_id = $4 AND NOT locked AND deleted_at IS NULL`,
+		args...,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return checkStrokeLocked(ctx, pool, roomID, strokeID)
+	}
+	return nil
+}
+
+// DeleteStroke soft-deletes a stroke so it can be restored with RestoreStroke
+func DeleteStroke(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string) error {
+	tag, err := pool.Exec(ctx,
+		`UPDATE strokes SET deleted_at = $1 WHERE id = $2 AND room_id = $3 AND NOT locked AND deleted_at IS NULL`,
+		time.Now(), strokeID, roomID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return checkStrokeLocked(ctx, pool, roomID, strokeID)
+	}
+	return nil
 }
 
-// DeleteStroke removes a stroke from the database
-func DeleteStroke(ctx context.Context, pool *pgxpool.Pool, strokeID string) error {
-	_, err := pool.Exec(ctx, `DELETE FROM strokes WHERE id = $1`, strokeID)
+// RestoreStroke undoes a soft delete and returns the restored stroke.
+// It returns pgx.ErrNoRows if the stroke is not deleted (or purged).
+func RestoreStroke(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string) (*Stroke, error) {
+	tag, err := pool.Exec(ctx,
+		`UPDATE strokes SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND room_id = $3 AND deleted_at IS NOT NULL`,
+		time.Now(), strokeID, roomID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return GetStroke(ctx, pool, roomID, strokeID)
+}
+
+// ReorderStrokes rearranges strokes among the z-order positions they
+// already hold so they stack in the given order, bottom to top. It returns
+// pgx.ErrNoRows if any stroke isn't live in the room, and ErrLocked if any
+// is locked.
+func ReorderStrokes(ctx context.Context, pool *pgxpool.Pool, roomID string, strokeIDs []string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT seq, locked FROM strokes
+		 WHERE room_id = $1 AND id = ANY($2) AND deleted_at IS NULL
+		 ORDER BY seq ASC FOR UPDATE`,
+		roomID, strokeIDs,
+	)
+	if err != nil {
+		return err
+	}
+	var seqs []int64
+	locked := false
+	for rows.Next() {
+		var seq int64
+		var l bool
+		if err := rows.Scan(&seq, &l); err != nil {
+			rows.Close()
+			return err
+		}
+		seqs = append(seqs, seq)
+		locked = locked || l
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(seqs) != len(strokeIDs) {
+		return pgx.ErrNoRows
+	}
+	if locked {
+		return ErrLocked
+	}
+
+	now := time.Now()
+	for i, id := range strokeIDs {
+		if _, err := tx.Exec(ctx,
+			`UPDATE strokes SET seq = $1, updated_at = $2 WHERE id = $3 AND room_id = $4`,
+			seqs[i], now, id, roomID,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgeDeletedStrokes permanently removes strokes soft-deleted before cutoff
+func PurgeDeletedStrokes(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM strokes WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SetStrokeLocked locks or unlocks a stroke against modification
+func SetStrokeLocked(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string, locked bool) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE strokes SET locked = $1, updated_at = $2 WHERE id = $3 AND room_id = $4`,
+		locked, time.Now(), strokeID, roomID,
+	)
 	return err
 }
+
+// IsStrokeLocked reports whether the stroke exists and is locked
+func IsStrokeLocked(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string) (bool, error) {
+	err := checkStrokeLocked(ctx, pool, roomID, strokeID)
+	if errors.Is(err, ErrLocked) {
+		return true, nil
+	}
+	return false, err
+}
+
+// checkStrokeLocked returns ErrLocked if the stroke exists and is locked
+func checkStrokeLocked(ctx context.Context, pool *pgxpool.Pool, roomID, strokeID string) error {
+	var locked bool
+	err := pool.QueryRow(ctx, `SELECT locked FROM strokes WHERE id = $1 AND room_id = $2`, strokeID, roomID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrLocked
+	}
+	return nil
+}
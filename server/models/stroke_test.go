@@ -0,0 +1,211 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestStrokeSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Undo", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stroke := &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 2}}}
+	if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.DeleteStroke(ctx, pool, room.ID, stroke.ID); err != nil {
+		t.Fatal(err)
+	}
+	strokes, err := models.GetStrokesByRoom(ctx, pool, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strokes) != 0 {
+		t.Errorf("deleted stroke still listed: %+v", strokes)
+	}
+
+	restored, err := models.RestoreStroke(ctx, pool, room.ID, stroke.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID != stroke.ID || len(restored.Points) != 1 {
+		t.Errorf("restored %+v, want the original stroke", restored)
+	}
+	if _, err := models.RestoreStroke(ctx, pool, room.ID, stroke.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("restoring a live stroke: got %v, want ErrNoRows", err)
+	}
+
+	// Only strokes deleted before the cutoff are purged
+	if err := models.DeleteStroke(ctx, pool, room.ID, stroke.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.PurgeDeletedStrokes(ctx, pool, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.RestoreStroke(ctx, pool, room.ID, stroke.ID); err != nil {
+		t.Fatalf("stroke inside the retention period was purged: %v", err)
+	}
+	if err := models.DeleteStroke(ctx, pool, room.ID, stroke.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.PurgeDeletedStrokes(ctx, pool, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.RestoreStroke(ctx, pool, room.ID, stroke.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("restoring a purged stroke: got %v, want ErrNoRows", err)
+	}
+}
+
+func TestStrokeOrder(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Layers", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Strokes stored together (same created_at) still stack as given
+	strokes := make([]*models.Stroke, 3)
+	for i := range strokes {
+		strokes[i] = &models.Stroke{RoomID: room.ID, Color: "#000000", Tool: "pen", Points: []models.Point{{X: 1, Y: 1}}}
+	}
+	if err := models.CreateStrokesBatch(ctx, pool, strokes); err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := strokes[0].ID, strokes[1].ID, strokes[2].ID
+	order := func() []string {
+		t.Helper()
+		stored, err := models.GetStrokesByRoom(ctx, pool, room.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, s := range stored {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	if got := order(); !slices.Equal(got, []string{a, b, c}) {
+		t.Errorf("order %v, want %v", got, []string{a, b, c})
+	}
+
+	// Reordering swaps strokes between the slots they hold
+	if err := models.ReorderStrokes(ctx, pool, room.ID, []string{c, a}); err != nil {
+		t.Fatal(err)
+	}
+	if got := order(); !slices.Equal(got, []string{c, b, a}) {
+		t.Errorf("after reorder %v, want %v", got, []string{c, b, a})
+	}
+
+	if err := models.ReorderStrokes(ctx, pool, room.ID, []string{a, "missing"}); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("reorder with a missing stroke: got %v, want ErrNoRows", err)
+	}
+	if err := models.SetStrokeLocked(ctx, pool, room.ID, b, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.ReorderStrokes(ctx, pool, room.ID, []string{a, b}); !errors.Is(err, models.ErrLocked) {
+		t.Errorf("reorder with a locked stroke: got %v, want ErrLocked", err)
+	}
+	if got := order(); !slices.Equal(got, []string{c, b, a}) {
+		t.Errorf("refused reorders changed the order to %v", got)
+	}
+}
+
+func TestValidateColor(t *testing.T) {
+	for color, valid := range map[string]bool{
+		"#000000":       true,
+		"#a1B2c3":       true,
+		"":              false,
+		"#fff":          false,
+		"#1234567":      false,
+		"000000":        false,
+		"#gggggg":       false,
+		"rgba(0,0,0,1)": false,
+		"red":           false,
+	} {
+		err := models.ValidateColor("stroke color", color)
+		if (err == nil) != valid {
+			t.Errorf("ValidateColor(%q) = %v, want valid %v", color, err, valid)
+		}
+	}
+
+	want := `invalid stroke color "rgba(0,0,0,1)", expected #RRGGBB`
+	if err := models.ValidateColor("stroke color", "rgba(0,0,0,1)"); err == nil || err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+}
+
+func TestCreateStrokesBatch(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	batched, err := models.CreateRoom(ctx, pool, "", "Batched", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := models.CreateRoom(ctx, pool, "", "One by one", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newStrokes := func(roomID string) []*models.Stroke {
+		return []*models.Stroke{
+			{RoomID: roomID, Color: "#000000", Tool: "pen", CreatedBy: "ada", Points: []models.Point{{X: 1, Y: 2}, {X: 3, Y: 4, Pressure: 0.5}}},
+			{RoomID: roomID, Color: "#ff0000", Tool: "highlighter", CreatedBy: "ada", Points: []models.Point{{X: -5, Y: 10}}},
+			{RoomID: roomID, Color: "#00ff00", Tool: "pen", Points: []models.Point{{X: 0, Y: 0}, {X: 100, Y: 50}}},
+		}
+	}
+	if err := models.CreateStrokesBatch(ctx, pool, newStrokes(batched.ID)); err != nil {
+		t.Fatal(err)
+	}
+	for _, stroke := range newStrokes(single.ID) {
+		if err := models.CreateStroke(ctx, pool, stroke); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both ways store the same strokes in the same order
+	got, err := models.GetStrokesByRoom(ctx, pool, batched.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := models.GetStrokesByRoom(ctx, pool, single.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("batch stored %d strokes, individually %d", len(got), len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if !slices.Equal(g.Points, w.Points) || g.Color != w.Color || g.Tool != w.Tool || g.CreatedBy != w.CreatedBy {
+			t.Errorf("stroke %d: batch stored %+v, individually %+v", i, g, w)
+		}
+	}
+	if bounds, err := models.GetStrokesInRegion(ctx, pool, batched.ID, models.Region{X: 90, Y: 40, Width: 20, Height: 20}); err != nil || len(bounds) != 1 {
+		t.Errorf("region query found %d batched strokes (%v), want the one with stored bounds", len(bounds), err)
+	}
+
+	// One bad row stores nothing
+	bad := newStrokes(batched.ID)
+	bad[2].ID = got[0].ID
+	if err := models.CreateStrokesBatch(ctx, pool, bad); err == nil {
+		t.Fatal("batch with a duplicate ID was stored")
+	}
+	if after, err := models.GetStrokesByRoom(ctx, pool, batched.ID); err != nil || len(after) != len(got) {
+		t.Errorf("%d strokes after a failed batch (%v), want the original %d", len(after), err, len(got))
+	}
+}
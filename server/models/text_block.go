@@ -2,10 +2,12 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -21,8 +23,43 @@ type TextBlock struct {
 	FontSize   float64   `json:"fontSize"`
 	Color      string    `json:"color"`
 	FontFamily string    `json:"fontFamily"`
+	Locked     bool      `json:"locked,omitempty"`
 	CreatedAt  time.Time `json:"createdAt,omitempty"`
 	UpdatedAt  time.Time `json:"updatedAt,omitempty"`
+	CreatedBy  string    `json:"createdBy,omitempty"`
+	UpdatedBy  string    `json:"updatedBy,omitempty"`
+
+	// Incremented by every update and diff, starting at 1
+	Version int `json:"version"`
+}
+
+// TextStyle is the font and color a text block is given when created
+// without them
+type TextStyle struct {
+	FontFamily string
+	FontSize   float64
+	Color      string
+}
+
+// TextDefaults fills in style fields omitted from new text blocks
+var TextDefaults = TextStyle{
+	FontFamily: "Inter",
+	FontSize:   16,
+	Color:      "#000000",
+}
+
+// ApplyDefaults sets any empty font family, font size or color from
+// TextDefaults
+func (tb *TextBlock) ApplyDefaults() {
+	if tb.FontFamily == "" {
+		tb.FontFamily = TextDefaults.FontFamily
+	}
+	if tb.FontSize <= 0 {
+		tb.FontSize = TextDefaults.FontSize
+	}
+	if tb.Color == "" {
+		tb.Color = TextDefaults.Color
+	}
 }
 
 // TextBlockUpdate represents partial updates to a text block
@@ -37,29 +74,118 @@ type TextBlockUpdate struct {
 	FontFamily *string  `json:"fontFamily,omitempty"`
 }
 
+// TextDiff is an incremental edit to a text block's content.
+// Positions count Unicode code points, not bytes.
+type TextDiff struct {
+	Position int    `json:"position"`
+	Delete   int    `json:"delete"`
+	Insert   string `json:"insert"`
+}
+
+// Apply returns content with the diff applied, or ErrInvalidDiff if the
+// range falls outside the content
+func (d *TextDiff) Apply(content string) (string, error) {
+	runes := []rune(content)
+	if d.Position < 0 || d.Delete < 0 || d.Position+d.Delete > len(runes) {
+		return "", ErrInvalidDiff
+	}
+
+	return string(runes[:d.Position]) + d.Insert + string(runes[d.Position+d.Delete:]), nil
+}
+
+// Apply copies the provided fields onto tb
+func (u *TextBlockUpdate) Apply(tb *TextBlock) {
+	if u.X != nil {
+		tb.X = *u.X
+	}
+	if u.Y != nil {
+		tb.Y = *u.Y
+	}
+	if u.Width != nil {
+		tb.Width = *u.Width
+	}
+	if u.Height != nil {
+		tb.Height = *u.Height
+	}
+	if u.Content != nil {
+		tb.Content = *u.Content
+	}
+	if u.FontSize != nil {
+		tb.FontSize = *u.FontSize
+	}
+	if u.Color != nil {
+		tb.Color = *u.Color
+	}
+	if u.FontFamily != nil {
+		tb.FontFamily = *u.FontFamily
+	}
+}
+
+// Validate checks the text block's color
+func (tb *TextBlock) Validate() error {
+	err := validateCoordinates(map[string]*float64{"x": &tb.X, "y": &tb.Y, "width": &tb.Width, "height": &tb.Height})
+	if err != nil {
+		return err
+	}
+	return ValidateColor("color", tb.Color)
+}
+
+// Validate checks the updated position, size and color
+func (u *TextBlockUpdate) Validate() error {
+	err := validateCoordinates(map[string]*float64{"x": u.X, "y": u.Y, "width": u.Width, "height": u.Height})
+	if err != nil {
+		return err
+	}
+	if u.Color != nil {
+		return ValidateColor("color", *u.Color)
+	}
+	return nil
+}
+
 // CreateTextBlock adds a new text block to the database
 func CreateTextBlock(ctx context.Context, pool *pgxpool.Pool, tb *TextBlock) error {
 	if tb.ID == "" {
 		tb.ID = uuid.New().String()
 	}
+	tb.ApplyDefaults()
 	tb.CreatedAt = time.Now()
 	tb.UpdatedAt = time.Now()
+	tb.UpdatedBy = tb.CreatedBy
+	tb.Version = 1
 
 	_, err := pool.Exec(ctx,
-		`INSERT INTO text_blocks (id, room_id, x, y, width, height, content, font_size, color, font_family, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`INSERT INTO text_blocks (id, room_id, x, y, width, height, content, font_size, color, font_family, created_at, updated_at, created_by, updated_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		 ON CONFLICT (id) DO NOTHING`,
-		tb.ID, tb.RoomID, tb.X, tb.Y, tb.Width, tb.Height, tb.Content, tb.FontSize, tb.Color, tb.FontFamily, tb.CreatedAt, tb.UpdatedAt,
+		tb.ID, tb.RoomID, tb.X, tb.Y, tb.Width, tb.Height, tb.Content, tb.FontSize, tb.Color, tb.FontFamily, tb.CreatedAt, tb.UpdatedAt, tb.CreatedBy, tb.UpdatedBy,
 	)
 	return err
 }
 
 // GetTextBlocksByRoom retrieves all text blocks for a room
 func GetTextBlocksByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string) ([]TextBlock, error) {
+	return queryTextBlocks(ctx, pool, `room_id = $1`, roomID)
+}
+
+// GetTextBlocksUpdatedSince retrieves a room's text blocks created or changed after since
+func GetTextBlocksUpdatedSince(ctx context.Context, pool *pgxpool.Pool, roomID string, since time.Time) ([]TextBlock, error) {
+	return queryTextBlocks(ctx, pool, `room_id = $1 AND updated_at > $2`, roomID, since)
+}
+
+// textBlockColumns is the column list scanned by scanTextBlock
+const textBlockColumns = `id, room_id, x, y, width, height, content, font_size, color, font_family, locked, created_at, updated_at,
+	COALESCE(created_by, ''), COALESCE(updated_by, ''), version`
+
+func scanTextBlock(row pgx.Row, tb *TextBlock) error {
+	return row.Scan(&tb.ID, &tb.RoomID, &tb.X, &tb.Y, &tb.Width, &tb.Height, &tb.Content, &tb.FontSize, &tb.Color, &tb.FontFamily, &tb.Locked, &tb.CreatedAt, &tb.UpdatedAt,
+		&tb.CreatedBy, &tb.UpdatedBy, &tb.Version)
+}
+
+// queryTextBlocks retrieves the text blocks matching where, oldest first
+func queryTextBlocks(ctx context.Context, pool *pgxpool.Pool, where string, args ...any) ([]TextBlock, error) {
 	rows, err := pool.Query(ctx,
-		`SELECT id, room_id, x, y, width, height, content, font_size, color, font_family, created_at, updated_at
-		 FROM text_blocks WHERE room_id = $1 ORDER BY created_at ASC`,
-		roomID,
+		`SELECT `+textBlockColumns+` FROM text_blocks WHERE `+where+` ORDER BY created_at ASC`,
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -69,8 +195,7 @@ func GetTextBlocksByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string)
 	var textBlocks []TextBlock
 	for rows.Next() {
 		var tb TextBlock
-		err := rows.Scan(&tb.ID, &tb.RoomID, &tb.X, &tb.Y, &tb.Width, &tb.Height, &tb.Content, &tb.FontSize, &tb.Color, &tb.FontFamily, &tb.CreatedAt, &tb.UpdatedAt)
-		if err != nil {
+		if err := scanTextBlock(rows, &tb); err != nil {
 			return nil, err
 		}
 		textBlocks = append(textBlocks, tb)
@@ -83,12 +208,63 @@ func GetTextBlocksByRoom(ctx context.Context, pool *pgxpool.Pool, roomID string)
 	return textBlocks, nil
 }
 
-// UpdateTextBlock updates an existing text block
-func UpdateTextBlock(ctx context.Context, pool *pgxpool.Pool, id string, updates *TextBlockUpdate) error {
+// GetTextBlock retrieves a single text block of a room by ID
+func GetTextBlock(ctx context.Context, pool *pgxpool.Pool, roomID, id string) (*TextBlock, error) {
+	tb := &TextBlock{}
+	row := pool.QueryRow(ctx, `SELECT `+textBlockColumns+` FROM text_blocks WHERE id = $1 AND room_id = $2`, id, roomID)
+	if err := scanTextBlock(row, tb); err != nil {
+		return nil, err
+	}
+	return tb, nil
+}
+
+// ApplyTextDiff applies an incremental edit by editorID to a text block's
+// stored content and returns the block's new version
+func ApplyTextDiff(ctx context.Context, pool *pgxpool.Pool, roomID, id string, diff *TextDiff, editorID string) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var content string
+	var locked bool
+	var version int
+	err = tx.QueryRow(ctx,
+		`SELECT content, locked, version FROM text_blocks WHERE id = $1 AND room_id = $2 FOR UPDATE`,
+		id, roomID,
+	).Scan(&content, &locked, &version)
+	if err != nil {
+		return 0, err
+	}
+	if locked {
+		return 0, ErrLocked
+	}
+
+	content, err = diff.Apply(content)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE text_blocks SET content = $1, updated_at = $2, updated_by = $3, version = version + 1 WHERE id = $4`,
+		content, time.Now(), editorID, id,
+	); err != nil {
+		return 0, err
+	}
+
+	return version + 1, tx.Commit(ctx)
+}
+
+// UpdateTextBlock updates an existing text block on behalf of editorID and
+// returns its new version. If expectedVersion is set, the update only
+// happens when the block is still at that version; otherwise
+// ErrStaleVersion is returned.
+func UpdateTextBlock(ctx context.Context, pool *pgxpool.Pool, roomID, id string, updates *TextBlockUpdate, editorID string, expectedVersion *int) (int, error) {
 	// Build dynamic update query based on provided fields
-	query := `UPDATE text_blocks SET updated_at = $1`
-	args := []interface{}{time.Now()}
-	argNum := 2
+	query := `UPDATE text_blocks SET updated_at = $1, updated_by = $2, version = version + 1`
+	args := []interface{}{time.Now(), editorID}
+	argNum := 3
 
 	if updates.X != nil {
 		query += fmt.Sprintf(", x = $%d", argNum)
@@ -131,15 +307,77 @@ func UpdateTextBlock(ctx context.Context, pool *pgxpool.Pool, id string, updates
 		argNum++
 	}
 
-	query += fmt.Sprintf(" WHERE id = $%d", argNum)
-	args = append(args, id)
+	query += fmt.Sprintf(" WHERE id = $%d AND room_id = $%d AND NOT locked", argNum, argNum+1)
+	args = append(args, id, roomID)
+	argNum += 2
 
-	_, err := pool.Exec(ctx, query, args...)
-	return err
+	if expectedVersion != nil {
+		query += fmt.Sprintf(" AND version = $%d", argNum)
+		args = append(args, *expectedVersion)
+	}
+	query += " RETURNING version"
+
+	var version int
+	err := pool.QueryRow(ctx, query, args...).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if err := checkTextBlockLocked(ctx, pool, roomID, id); err != nil {
+			return 0, err
+		}
+		if expectedVersion != nil {
+			return 0, checkTextBlockVersion(ctx, pool, roomID, id, *expectedVersion)
+		}
+		return 0, nil
+	}
+	return version, err
+}
+
+// checkTextBlockVersion returns ErrStaleVersion if the text block exists
+// and is no longer at version
+func checkTextBlockVersion(ctx context.Context, pool *pgxpool.Pool, roomID, id string, version int) error {
+	var current int
+	err := pool.QueryRow(ctx, `SELECT version FROM text_blocks WHERE id = $1 AND room_id = $2`, id, roomID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return ErrStaleVersion
+	}
+	return nil
 }
 
 // DeleteTextBlock removes a text block from the database
-func DeleteTextBlock(ctx context.Context, pool *pgxpool.Pool, id string) error {
-	_, err := pool.Exec(ctx, `DELETE FROM text_blocks WHERE id = $1`, id)
+func DeleteTextBlock(ctx context.Context, pool *pgxpool.Pool, roomID, id string) error {
+	tag, err := pool.Exec(ctx, `DELETE FROM text_blocks WHERE id = $1 AND room_id = $2 AND NOT locked`, id, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return checkTextBlockLocked(ctx, pool, roomID, id)
+	}
+	return nil
+}
+
+// SetTextBlockLocked locks or unlocks a text block against modification
+func SetTextBlockLocked(ctx context.Context, pool *pgxpool.Pool, roomID, id string, locked bool) error {
+	_, err := pool.Exec(ctx, `UPDATE text_blocks SET locked = $1 WHERE id = $2 AND room_id = $3`, locked, id, roomID)
 	return err
 }
+
+// checkTextBlockLocked returns ErrLocked if the text block exists and is locked
+func checkTextBlockLocked(ctx context.Context, pool *pgxpool.Pool, roomID, id string) error {
+	var locked bool
+	err := pool.QueryRow(ctx, `SELECT locked FROM text_blocks WHERE id = $1 AND room_id = $2`, id, roomID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrLocked
+	}
+	return nil
+}
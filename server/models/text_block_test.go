@@ -0,0 +1,218 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dre4success/bethel/server/db/dbtest"
+	"github.com/dre4success/bethel/server/models"
+)
+
+func TestUpdateTextBlockAllFields(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Text", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := &models.TextBlock{RoomID: room.ID, X: 1, Y: 2, Width: 100, Height: 40, Content: "before", CreatedBy: "alice"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	x, y, width, height := 10.5, 20.5, 300.0, 80.0
+	content, fontSize, color, fontFamily := "after", 24.0, "#ff0000", "serif"
+	updates := &models.TextBlockUpdate{
+		X: &x, Y: &y, Width: &width, Height: &height,
+		Content: &content, FontSize: &fontSize, Color: &color, FontFamily: &fontFamily,
+	}
+
+	// Every field plus the version check takes the query past $9
+	expected := tb.Version
+	version, err := models.UpdateTextBlock(ctx, pool, room.ID, tb.ID, updates, "bob", &expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != tb.Version+1 {
+		t.Errorf("version = %d, want %d", version, tb.Version+1)
+	}
+
+	got, err := models.GetTextBlock(ctx, pool, room.ID, tb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.X != x || got.Y != y || got.Width != width || got.Height != height {
+		t.Errorf("geometry = (%v, %v, %v, %v), want (%v, %v, %v, %v)",
+			got.X, got.Y, got.Width, got.Height, x, y, width, height)
+	}
+	if got.Content != content || got.FontSize != fontSize || got.Color != color || got.FontFamily != fontFamily {
+		t.Errorf("content and style = (%q, %v, %q, %q), want (%q, %v, %q, %q)",
+			got.Content, got.FontSize, got.Color, got.FontFamily, content, fontSize, color, fontFamily)
+	}
+	if got.UpdatedBy != "bob" || got.Version != version {
+		t.Errorf("updatedBy = %q, version = %d", got.UpdatedBy, got.Version)
+	}
+
+	// The old version is now stale
+	if _, err := models.UpdateTextBlock(ctx, pool, room.ID, tb.ID, updates, "bob", &expected); !errors.Is(err, models.ErrStaleVersion) {
+		t.Errorf("stale update returned %v, want ErrStaleVersion", err)
+	}
+}
+
+func TestUpdateTextBlockOtherRoom(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Text", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := models.CreateRoom(ctx, pool, "", "Other", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := &models.TextBlock{RoomID: room.ID, Content: "mine"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "hijacked"
+	version, err := models.UpdateTextBlock(ctx, pool, other.ID, tb.ID, &models.TextBlockUpdate{Content: &content}, "mallory", nil)
+	if err != nil || version != 0 {
+		t.Errorf("update from another room = (%d, %v), want (0, nil)", version, err)
+	}
+
+	got, err := models.GetTextBlock(ctx, pool, room.ID, tb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Content != "mine" {
+		t.Errorf("content changed from another room: %q", got.Content)
+	}
+}
+
+func TestTextDiffApply(t *testing.T) {
+	tests := []struct {
+		content string
+		diff    models.TextDiff
+		want    string
+		err     error
+	}{
+		{"hello", models.TextDiff{Position: 5, Insert: " world"}, "hello world", nil},
+		{"hello", models.TextDiff{Position: 0, Delete: 1, Insert: "j"}, "jello", nil},
+		{"hello", models.TextDiff{Position: 1, Delete: 3}, "ho", nil},
+		{"héllo", models.TextDiff{Position: 1, Delete: 1, Insert: "e"}, "hello", nil}, // code points, not bytes
+		{"", models.TextDiff{Insert: "new"}, "new", nil},
+		{"hello", models.TextDiff{Position: 6}, "", models.ErrInvalidDiff},
+		{"hello", models.TextDiff{Position: 3, Delete: 3}, "", models.ErrInvalidDiff},
+		{"hello", models.TextDiff{Position: -1}, "", models.ErrInvalidDiff},
+		{"hello", models.TextDiff{Delete: -1}, "", models.ErrInvalidDiff},
+	}
+	for _, tt := range tests {
+		got, err := tt.diff.Apply(tt.content)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%+v on %q = %q, %v; want %q, %v", tt.diff, tt.content, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTextBlockAuthor(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Notes", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := &models.TextBlock{RoomID: room.ID, Content: "by alice", CreatedBy: "alice"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := models.GetRoomState(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.TextBlocks) != 1 || state.TextBlocks[0].CreatedBy != "alice" {
+		t.Errorf("room state text blocks %+v, want alice's note", state.TextBlocks)
+	}
+}
+
+func TestTextBlockLastEditor(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Notes", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := &models.TextBlock{RoomID: room.ID, Content: "draft", CreatedBy: "alice"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, editor := range []string{"alice", "bob"} {
+		content := "edited by " + editor
+		if _, err := models.UpdateTextBlock(ctx, pool, room.ID, tb.ID, &models.TextBlockUpdate{Content: &content}, editor, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state, err := models.GetRoomState(ctx, pool, "", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.TextBlocks) != 1 {
+		t.Fatalf("%d text blocks, want 1", len(state.TextBlocks))
+	}
+	if got := state.TextBlocks[0]; got.UpdatedBy != "bob" || got.CreatedBy != "alice" {
+		t.Errorf("created by %q, updated by %q; want alice and bob", got.CreatedBy, got.UpdatedBy)
+	}
+}
+
+func TestApplyTextDefaults(t *testing.T) {
+	defaults := models.TextDefaults
+	t.Cleanup(func() { models.TextDefaults = defaults })
+	models.TextDefaults = models.TextStyle{FontFamily: "Georgia", FontSize: 20, Color: "#333333"}
+
+	tb := &models.TextBlock{Width: 100, Height: 40}
+	tb.ApplyDefaults()
+	if tb.FontFamily != "Georgia" || tb.FontSize != 20 || tb.Color != "#333333" {
+		t.Errorf("defaults gave %q %v %q", tb.FontFamily, tb.FontSize, tb.Color)
+	}
+	if err := tb.Validate(); err != nil {
+		t.Errorf("block with defaults is invalid: %v", err)
+	}
+
+	// Given values are kept
+	styled := &models.TextBlock{FontFamily: "serif", FontSize: 12, Color: "#ff0000"}
+	styled.ApplyDefaults()
+	if styled.FontFamily != "serif" || styled.FontSize != 12 || styled.Color != "#ff0000" {
+		t.Errorf("explicit style replaced: %q %v %q", styled.FontFamily, styled.FontSize, styled.Color)
+	}
+}
+
+func TestCreateTextBlockDefaults(t *testing.T) {
+	ctx := context.Background()
+	pool := dbtest.Pool(t)
+
+	room, err := models.CreateRoom(ctx, pool, "", "Plain", models.RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := &models.TextBlock{RoomID: room.ID, X: 1, Y: 2, Width: 100, Height: 40, Content: "unstyled"}
+	if err := models.CreateTextBlock(ctx, pool, tb); err != nil {
+		t.Fatalf("creating a block without a style: %v", err)
+	}
+
+	got, err := models.GetTextBlock(ctx, pool, room.ID, tb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.TextDefaults
+	if got.FontFamily != want.FontFamily || got.FontSize != want.FontSize || got.Color != want.Color {
+		t.Errorf("stored %q %v %q, want the defaults %+v", got.FontFamily, got.FontSize, got.Color, want)
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreKey(t *testing.T) {
+	s := &LocalStore{Dir: t.TempDir(), BaseURL: "/uploads"}
+
+	tests := []struct {
+		url string
+		key string
+		ok  bool
+	}{
+		{"/uploads/room/a.png", "room/a.png", true},
+		{"/uploads/../a.png", "", false},
+		{"/other/room/a.png", "", false},
+		{"https://example.com/uploads/room/a.png", "", false},
+	}
+	for _, tt := range tests {
+		key, ok := s.Key(tt.url)
+		if ok != tt.ok || (ok && key != tt.key) {
+			t.Errorf("Key(%q) = %q, %v; want %q, %v", tt.url, key, ok, tt.key, tt.ok)
+		}
+	}
+}
+
+func TestLocalStoreCopy(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocalStore(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(ctx, "a/1.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := s.Copy(ctx, "a/1.png", "b/2.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/uploads/b/2.png" {
+		t.Errorf("copy URL = %s", url)
+	}
+	if err := s.Delete(ctx, "a/1.png"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, "b", "2.png"))
+	if err != nil || string(data) != "png" {
+		t.Errorf("copy = %q, %v after deleting the original", data, err)
+	}
+
+	if _, err := s.Copy(ctx, "missing.png", "c/3.png"); err == nil {
+		t.Error("copying a missing object succeeded")
+	}
+}